@@ -1,7 +1,95 @@
 package domain
 
-type SendAlert interface {
-	SendAlert() error
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// How serious the result of a run is, channels can ignore the levels below their MinLevel.
+type AlertLevel int
+
+const (
+	AlertLevelSuccess AlertLevel = iota
+	AlertLevelWarning
+	AlertLevelError
+)
+
+func (l AlertLevel) String() string {
+	switch l {
+	case AlertLevelSuccess:
+		return "success"
+	case AlertLevelWarning:
+		return "warning"
+	case AlertLevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+// Parses success, warning or error, an empty value is success.
+func ParseAlertLevel(value string) (AlertLevel, error) {
+	switch strings.ToLower(value) {
+	case "", "success":
+		return AlertLevelSuccess, nil
+	case "warn", "warning":
+		return AlertLevelWarning, nil
+	case "error":
+		return AlertLevelError, nil
+	}
+	return AlertLevelSuccess, fmt.Errorf("unknown alert level '%v'", value)
+}
+
+// A notifier sends the result of a run to one channel, like discord or email.
+type Notifier interface {
+	// The config key of the channel, used in the logs and metrics.
+	Name() string
+	Notify(ctx context.Context, result RunResult) error
+}
+
+// What every notifier is given about the run.
+type RunResult struct {
+	RunRecord
+
+	// Everything that was logged during the run.
+	Records []LogRecord `json:"records"`
+}
+
+func (r RunResult) IsError() bool {
+	return !r.Success
+}
+
+// A failed run is an error.  A run that worked but logged a warning, like a retry or a slow run, is a warning.
+func (r RunResult) Level() AlertLevel {
+	if r.IsError() {
+		return AlertLevelError
+	}
+
+	for _, record := range r.Records {
+		if record.Level >= LogLevelWarn {
+			return AlertLevelWarning
+		}
+	}
+	return AlertLevelSuccess
+}
+
+// Checks if the channel wants the result.
+// Results from the daemon itself are not about one job, so they are only checked against the level.
+func (r ConfigAlertRoute) Accepts(result RunResult) bool {
+	min, err := ParseAlertLevel(r.MinLevel)
+	if err != nil || result.Level() < min {
+		return false
+	}
+
+	if len(r.Containers) == 0 || result.Job == "" {
+		return true
+	}
+	for _, container := range r.Containers {
+		if container == result.Container {
+			return true
+		}
+	}
+	return false
 }
 
 type DiscordField struct {
@@ -45,3 +133,96 @@ type DiscordBasicMessage struct {
 	Content   string         `json:"content,omitempty"`
 	Embeds    []DiscordEmbed `json:"embeds,omitempty"`
 }
+
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short,omitempty"`
+}
+
+// Attachments are supported by both Slack and Mattermost.
+type SlackAttachment struct {
+	Fallback   string       `json:"fallback,omitempty"`
+	Color      string       `json:"color,omitempty"`
+	Title      string       `json:"title,omitempty"`
+	Text       string       `json:"text,omitempty"`
+	Fields     []SlackField `json:"fields,omitempty"`
+	Footer     string       `json:"footer,omitempty"`
+	Timestamp  int64        `json:"ts,omitempty"`
+	MarkdownIn []string     `json:"mrkdwn_in,omitempty"`
+}
+
+// Root object for Slack and Mattermost incoming webhook messages
+type SlackMessage struct {
+	Username    string            `json:"username,omitempty"`
+	Channel     string            `json:"channel,omitempty"`
+	IconEmoji   string            `json:"icon_emoji,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+// Published as json to the root of the ntfy server
+type NtfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title,omitempty"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Click    string   `json:"click,omitempty"`
+}
+
+type GotifyMessage struct {
+	Title    string                 `json:"title,omitempty"`
+	Message  string                 `json:"message"`
+	Priority int                    `json:"priority"`
+	Extras   map[string]interface{} `json:"extras,omitempty"`
+}
+
+// Root object for Teams incoming webhook messages
+type TeamsMessage struct {
+	Type        string            `json:"type"`
+	Attachments []TeamsAttachment `json:"attachments"`
+}
+
+type TeamsAttachment struct {
+	ContentType string       `json:"contentType"`
+	Content     AdaptiveCard `json:"content"`
+}
+
+type AdaptiveCard struct {
+	Schema  string            `json:"$schema"`
+	Type    string            `json:"type"`
+	Version string            `json:"version"`
+	Body    []AdaptiveElement `json:"body"`
+}
+
+// A TextBlock or a FactSet, the fields that do not apply are left empty.
+type AdaptiveElement struct {
+	Type   string         `json:"type"`
+	Text   string         `json:"text,omitempty"`
+	Weight string         `json:"weight,omitempty"`
+	Size   string         `json:"size,omitempty"`
+	Color  string         `json:"color,omitempty"`
+	Wrap   bool           `json:"wrap,omitempty"`
+	Facts  []AdaptiveFact `json:"facts,omitempty"`
+}
+
+type AdaptiveFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+// The content of a m.room.message event
+type MatrixMessage struct {
+	MsgType       string          `json:"msgtype"`
+	Body          string          `json:"body"`
+	Format        string          `json:"format,omitempty"`
+	FormattedBody string          `json:"formatted_body,omitempty"`
+	Url           string          `json:"url,omitempty"`
+	Info          *MatrixFileInfo `json:"info,omitempty"`
+}
+
+type MatrixFileInfo struct {
+	MimeType string `json:"mimetype"`
+	Size     int    `json:"size"`
+}
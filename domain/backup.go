@@ -0,0 +1,90 @@
+package domain
+
+import "time"
+
+const (
+	// Appended to the backup file name to store the manifest next to the backup.
+	BackupManifestExtension = ".dvb.json"
+	BackupManifestVersion   = 1
+)
+
+// The manifest is written next to every backup that dvb creates.
+// It is the source of truth for when the backup was made and who made it.
+type BackupManifest struct {
+	Version   int       `json:"version"`
+	Container string    `json:"container"`
+	Host      string    `json:"host"`
+	FileName  string    `json:"fileName"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+	Checksum  string    `json:"checksum,omitempty"`
+
+	// Pinned backups are never removed by retention.
+	Pinned bool     `json:"pinned,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// Describes a single backup that lives on a destination.
+type BackupFile struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Container string `json:"container,omitempty"`
+	Size      int64  `json:"size"`
+
+	// When the backup was made, taken from the manifest or the file name.
+	// This is zero when neither could tell us.
+	CreatedAt time.Time `json:"createdAt,omitempty"`
+
+	// Nil when the backup does not have a manifest.
+	Manifest *BackupManifest `json:"manifest,omitempty"`
+}
+
+func (f BackupFile) IsPinned() bool {
+	return f.Manifest != nil && f.Manifest.Pinned
+}
+
+func (f BackupFile) HasTag(tag string) bool {
+	if f.Manifest == nil {
+		return false
+	}
+
+	for _, item := range f.Manifest.Tags {
+		if item == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Any destination that can list and delete backups can have retention applied to it.
+type BackupStore interface {
+	// Name of the destination used in logs and summaries.
+	Name() string
+
+	// The most space dvb can use on the destination, 0 means there is no limit.
+	MaxBytes() int64
+
+	// The space every file on the destination uses, including files dvb did not make.
+	UsedBytes() (int64, error)
+
+	// Lists every file of the container, CreatedAt is only set from a manifest.
+	ListBackups(container string) ([]BackupFile, error)
+	DeleteBackup(file BackupFile) error
+
+	// Replaces the manifest of the backup, creating it if the backup did not have one.
+	WriteManifest(file BackupFile, manifest BackupManifest) error
+}
+
+// One backup that dvb owns on a destination.
+type CatalogEntry struct {
+	Destination string     `json:"destination"`
+	Backup      BackupFile `json:"backup"`
+}
+
+// The totals for a single destination after a prune.
+type PruneSummary struct {
+	Destination string `json:"destination"`
+	Removed     int    `json:"removed"`
+	FreedBytes  int64  `json:"freedBytes"`
+	Foreign     int    `json:"foreign"`
+}
@@ -2,14 +2,123 @@ package domain
 
 // This is the root yaml config that contains the information needed to operate
 type Config struct {
-	Daemon      ConfigDaemon `yaml:"Daemon,omitempty"`
-	Backup      BackupConfig `yaml:"Backup"`
-	Alert       ConfigAlert  `yaml:"Alert,omitempty"`
-	Destination ConfigDest   `yaml:"Destination,omitempty"`
+	Daemon      ConfigDaemon  `yaml:"Daemon,omitempty"`
+	Backup      BackupConfig  `yaml:"Backup"`
+	Alert       ConfigAlert   `yaml:"Alert,omitempty"`
+	Destination ConfigDest    `yaml:"Destination,omitempty"`
+	Retry       ConfigRetry   `yaml:"Retry,omitempty"`
+	Metrics     ConfigMetrics `yaml:"Metrics,omitempty"`
+	Log         ConfigLog     `yaml:"Log,omitempty"`
+	History     ConfigHistory `yaml:"History,omitempty"`
+	Mqtt        ConfigMqtt    `yaml:"Mqtt,omitempty"`
 }
 
+const (
+	DaemonOverlapSkip  = "skip"
+	DaemonOverlapQueue = "queue"
+)
+
+const (
+	EmailSecurityNone     = "none"
+	EmailSecurityStartTls = "starttls"
+	EmailSecurityTls      = "tls"
+)
+
 type ConfigDaemon struct {
+	// The schedule used by every container that does not define its own.
 	Cron string `yaml:"Cron,omitempty"`
+
+	// What to do when a job is triggered while it is still running, skip or queue.
+	Overlap string `yaml:"Overlap,omitempty"`
+
+	// How many containers can be backed up at the same time.
+	MaxParallel int `yaml:"MaxParallel,omitempty"`
+
+	// Where dvb keeps the files it needs between runs, like the lock file.
+	StateDir string `yaml:"StateDir,omitempty"`
+
+	// How long to wait for running backups to finish when the daemon is asked to stop.
+	ShutdownGrace Duration `yaml:"ShutdownGrace,omitempty"`
+
+	// Reload the config when the file changes, SIGHUP always reloads the config.
+	WatchConfig   bool     `yaml:"WatchConfig,omitempty"`
+	WatchInterval Duration `yaml:"WatchInterval,omitempty"`
+
+	// Run any job that missed its schedule while dvb was not running.
+	CatchUp      bool     `yaml:"CatchUp,omitempty"`
+	CatchUpDelay Duration `yaml:"CatchUpDelay,omitempty"`
+
+	// The optional http api, it is only started when Listen is set.
+	Api ConfigDaemonApi `yaml:"Api,omitempty"`
+}
+
+type ConfigLog struct {
+	// The lowest level that is written, debug, info, warn or error.
+	Level string `yaml:"Level,omitempty"`
+
+	// How each line is written, text, logfmt or json.
+	Format string `yaml:"Format,omitempty"`
+
+	// Also write the logs to this file, it is rotated once it reaches MaxSize.
+	File       string   `yaml:"File,omitempty"`
+	MaxSize    ByteSize `yaml:"MaxSize,omitempty"`
+	MaxBackups int      `yaml:"MaxBackups,omitempty"`
+}
+
+type ConfigHistory struct {
+	// How many runs are kept in the history, defaults to 1000.
+	MaxRuns int `yaml:"MaxRuns,omitempty"`
+
+	// Runs older than this are removed, like 2160h for 90 days.
+	MaxAge Duration `yaml:"MaxAge,omitempty"`
+}
+
+type ConfigMqtt struct {
+	// The broker to publish to, like tcp://192.168.1.10:1883 or ssl://broker:8883.
+	Broker   string `yaml:"Broker,omitempty"`
+	Username string `yaml:"Username,omitempty"`
+	Password string `yaml:"Password,omitempty"`
+
+	// Defaults to dvb-<hostname>.
+	ClientId string `yaml:"ClientId,omitempty"`
+
+	// Every topic starts with this, defaults to dvb.
+	TopicPrefix string `yaml:"TopicPrefix,omitempty"`
+
+	// Publish the Home Assistant discovery config so each container shows up as sensors.
+	Discovery       bool   `yaml:"Discovery,omitempty"`
+	DiscoveryPrefix string `yaml:"DiscoveryPrefix,omitempty"`
+}
+
+type ConfigMetrics struct {
+	// Write the metrics to this file after every backup for the node exporter textfile collector.
+	TextfilePath string `yaml:"TextfilePath,omitempty"`
+}
+
+type ConfigDaemonApi struct {
+	// The address to listen on, like 127.0.0.1:8080.
+	Listen string `yaml:"Listen,omitempty"`
+
+	// Every request needs this as a bearer token, it is always required when Listen is set.
+	Token string `yaml:"Token,omitempty"`
+
+	// Serve https when both are set.
+	TlsCert string `yaml:"TlsCert,omitempty"`
+	TlsKey  string `yaml:"TlsKey,omitempty"`
+}
+
+// Returns true when the global cron or any container has a schedule.
+func (c Config) HasSchedules() bool {
+	if c.Daemon.Cron != "" {
+		return true
+	}
+
+	for _, container := range c.Backup.Docker {
+		if len(container.Schedule) >= 1 {
+			return true
+		}
+	}
+	return false
 }
 
 type BackupConfig struct {
@@ -21,6 +130,50 @@ type ContainerDocker struct {
 	Directory string              `yaml:"Directory"`
 	Tar       ConfigContainerTar  `yaml:"Tar"`
 	Post      ConfigContainerPost `yaml:"Post,omitempty"`
+
+	// One or more cron expressions for this container, falls back to Daemon.Cron.
+	Schedule StringList `yaml:"Schedule,omitempty"`
+
+	// Overrides the Destination.Retain values for this container.
+	Retain ConfigRetain `yaml:"Retain,omitempty"`
+}
+
+// Returns the retention policy for the container.
+// Keep rules defined on the container replace the global rules, MaxBytes and MinKeep override the global values.
+func (c ContainerDocker) RetainPolicy(global ConfigRetain) ConfigRetain {
+	policy := global
+	override := c.Retain
+
+	if override.Days > 0 || override.KeepLast > 0 || override.KeepDaily > 0 || override.KeepWeekly > 0 || override.KeepMonthly > 0 || override.KeepYearly > 0 {
+		policy.Days = override.Days
+		policy.KeepLast = override.KeepLast
+		policy.KeepDaily = override.KeepDaily
+		policy.KeepWeekly = override.KeepWeekly
+		policy.KeepMonthly = override.KeepMonthly
+		policy.KeepYearly = override.KeepYearly
+	}
+
+	if override.MaxBytes > 0 {
+		policy.MaxBytes = override.MaxBytes
+	}
+
+	if override.MinKeep > 0 {
+		policy.MinKeep = override.MinKeep
+	}
+
+	if override.AdoptLegacy {
+		policy.AdoptLegacy = true
+	}
+
+	return policy
+}
+
+// Returns the pattern used to claim backups without a manifest, empty unless AdoptLegacy is set.
+func (c ContainerDocker) LegacyPattern(global ConfigRetain) string {
+	if !c.RetainPolicy(global).AdoptLegacy {
+		return ""
+	}
+	return c.Tar.Pattern
 }
 
 type ConfigContainerTar struct {
@@ -39,14 +192,40 @@ type ConfigDest struct {
 	Sftp   ConfigDestSftp  `yaml:"Sftp,omitempty"`
 }
 
-// Defines how long backups should be retained
+// Defines how long backups should be retained.
+// The Keep rules follow the grandfather-father-son style, a backup is kept if any rule wants it.
 type ConfigRetain struct {
+	// Deprecated: Days is the number of backups to keep, use KeepLast instead.
 	Days int `yaml:"Days,omitempty"`
+
+	KeepLast    int `yaml:"KeepLast,omitempty"`
+	KeepDaily   int `yaml:"KeepDaily,omitempty"`
+	KeepWeekly  int `yaml:"KeepWeekly,omitempty"`
+	KeepMonthly int `yaml:"KeepMonthly,omitempty"`
+	KeepYearly  int `yaml:"KeepYearly,omitempty"`
+
+	// The most space the backups of a single container can use on a destination.
+	MaxBytes ByteSize `yaml:"MaxBytes,omitempty"`
+
+	// The newest backups that will never be removed to make room for a new one.
+	MinKeep int `yaml:"MinKeep,omitempty"`
+
+	// Treats backups without a manifest that match the Tar.Pattern as made by dvb on this host.
+	// Only set this when no other host or tool writes to the destination.
+	AdoptLegacy bool `yaml:"AdoptLegacy,omitempty"`
+}
+
+// Returns true when at least one retention rule has been defined.
+func (c ConfigRetain) IsEnabled() bool {
+	return c.Days > 0 || c.KeepLast > 0 || c.KeepDaily > 0 || c.KeepWeekly > 0 || c.KeepMonthly > 0 || c.KeepYearly > 0
 }
 
 // Defines where and how to move data
 type ConfigDestLocal struct {
 	Path string `yaml:"Path,omitempty"`
+
+	// The most space all backups made by dvb can use on this destination.
+	MaxBytes ByteSize `yaml:"MaxBytes,omitempty"`
 }
 
 type ConfigDestSftp struct {
@@ -57,26 +236,200 @@ type ConfigDestSftp struct {
 }
 
 type ConfigAlert struct {
-	SendOnlyOnError bool               `yaml:"SendOnlyOnError,omitempty"`
-	Discord         ConfigAlertDiscord `yaml:"Discord,omitempty"`
-	Email           ConfigAlertEmail   `yaml:"Email,omitempty"`
+	// Only send failed runs, on top of the MinLevel of each channel.
+	SendOnlyOnError bool `yaml:"SendOnlyOnError,omitempty"`
+
+	// A run that takes longer than this is a warning, like 30m.
+	SlowRun Duration `yaml:"SlowRun,omitempty"`
+
+	// How long each attempt to send an alert can take, defaults to 30s.
+	Timeout Duration `yaml:"Timeout,omitempty"`
+
+	Discord  ConfigAlertDiscord  `yaml:"Discord,omitempty"`
+	Email    ConfigAlertEmail    `yaml:"Email,omitempty"`
+	Slack    ConfigAlertSlack    `yaml:"Slack,omitempty"`
+	Ntfy     ConfigAlertNtfy     `yaml:"Ntfy,omitempty"`
+	Gotify   ConfigAlertGotify   `yaml:"Gotify,omitempty"`
+	Teams    ConfigAlertTeams    `yaml:"Teams,omitempty"`
+	Webhook  ConfigAlertWebhook  `yaml:"Webhook,omitempty"`
+	Telegram ConfigAlertTelegram `yaml:"Telegram,omitempty"`
+	Matrix   ConfigAlertMatrix   `yaml:"Matrix,omitempty"`
+}
+
+// Which results a channel is sent, every channel has these.
+type ConfigAlertRoute struct {
+	// The lowest level that is sent, success, warning or error.  Defaults to success.
+	MinLevel string `yaml:"MinLevel,omitempty"`
+
+	// Only send the runs of these containers, defaults to every container.
+	Containers StringList `yaml:"Containers,omitempty"`
+}
+
+// Slack and Mattermost incoming webhooks.
+type ConfigAlertSlack struct {
+	Webhooks []string `yaml:"Webhooks,omitempty"`
+
+	// Optional, the webhook may not allow these to be changed.
+	Username  string `yaml:"Username,omitempty"`
+	Channel   string `yaml:"Channel,omitempty"`
+	IconEmoji string `yaml:"IconEmoji,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
 }
 
 type ConfigAlertDiscord struct {
 	Username string   `yaml:"Username,omitempty"`
 	Webhooks []string `yaml:"Webhooks,omitempty"`
+
+	// Defaults to https://discord.com, the webhooks must start with it.
+	// Only change this to send through a proxy.
+	BaseUrl string `yaml:"BaseUrl,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
+}
+
+type ConfigAlertNtfy struct {
+	// The ntfy server, like https://ntfy.sh.
+	Url   string `yaml:"Url,omitempty"`
+	Topic string `yaml:"Topic,omitempty"`
+
+	// Optional access token for protected topics.
+	Token string `yaml:"Token,omitempty"`
+
+	// Added to the status tag of every message.
+	Tags []string `yaml:"Tags,omitempty"`
+
+	// From 1 to 5, defaults to 3 for a success and 5 for an error when it is 0.
+	SuccessPriority int `yaml:"SuccessPriority,omitempty"`
+	ErrorPriority   int `yaml:"ErrorPriority,omitempty"`
+
+	// Opened when the notification is tapped.
+	ClickUrl string `yaml:"ClickUrl,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
+}
+
+type ConfigAlertGotify struct {
+	// The gotify server, like https://gotify.example.com.
+	Url string `yaml:"Url,omitempty"`
+
+	// The token of the application the messages are sent as.
+	Token string `yaml:"Token,omitempty"`
+
+	// From 0 to 10, defaults to 4 for a success and 8 for an error.
+	// Nil when it is not set, 0 is a priority gotify uses.
+	SuccessPriority *int `yaml:"SuccessPriority,omitempty"`
+	ErrorPriority   *int `yaml:"ErrorPriority,omitempty"`
+
+	// Opened when the notification is tapped.
+	ClickUrl string `yaml:"ClickUrl,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
+}
+
+// Microsoft Teams incoming webhooks, the message is sent as an adaptive card.
+type ConfigAlertTeams struct {
+	Webhooks []string `yaml:"Webhooks,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
+}
+
+// Sends the run to any http endpoint.
+type ConfigAlertWebhook struct {
+	Url string `yaml:"Url,omitempty"`
+
+	// Defaults to POST.
+	Method  string            `yaml:"Method,omitempty"`
+	Headers map[string]string `yaml:"Headers,omitempty"`
+
+	// A go text/template that is given the run result, defaults to the run result as json.
+	Body string `yaml:"Body,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
+}
+
+type ConfigAlertTelegram struct {
+	// The token from BotFather.
+	Token   string   `yaml:"Token,omitempty"`
+	ChatIds []string `yaml:"ChatIds,omitempty"`
+
+	// Defaults to https://api.telegram.org, only change this for a local bot api server.
+	ApiUrl string `yaml:"ApiUrl,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
+}
+
+type ConfigAlertMatrix struct {
+	// Like https://matrix.example.com.
+	Homeserver  string `yaml:"Homeserver,omitempty"`
+	AccessToken string `yaml:"AccessToken,omitempty"`
+
+	// The room id, like !abcdef:example.com, the user must already be in the room.
+	RoomId string `yaml:"RoomId,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
 }
 
 type ConfigAlertEmail struct {
 	Account ConfigAlertEmailAccount `yaml:"Account"`
 	From    string                  `yaml:"From"`
-	To      string                  `yaml:"To"`
+
+	// One address or a list, Bcc is not shown to the other recipients.
+	To  StringList `yaml:"To"`
+	Cc  StringList `yaml:"Cc,omitempty"`
+	Bcc StringList `yaml:"Bcc,omitempty"`
+
+	// Go text/templates that are given the run result, like "Backup failed: {{.Container}}".
+	SubjectSuccess string `yaml:"SubjectSuccess,omitempty"`
+	SubjectError   string `yaml:"SubjectError,omitempty"`
+
+	ConfigAlertRoute `yaml:",inline"`
 }
 
 type ConfigAlertEmailAccount struct {
 	Username string `yaml:"Username"`
 	Password string `yaml:"Password"`
 	Host     string `yaml:"Host"`
-	Port     int    `yaml:"Port"`
-	UseTls   bool   `yaml:"UseTls"`
+
+	// Defaults to 465 for tls, 587 for starttls and 25 for none.
+	Port int `yaml:"Port"`
+
+	// none, starttls or tls.  Defaults to tls on port 465 and starttls on any other port.
+	Security string `yaml:"Security,omitempty"`
+
+	// Optional, a pem file with the CA that signed the server certificate, on top of the system CAs.
+	CaFile string `yaml:"CaFile,omitempty"`
+
+	// Allows the password to be sent without encryption when Security is none.
+	// A server on localhost is always allowed, this is only needed for a relay on another host.
+	AllowPlaintextAuth bool `yaml:"AllowPlaintextAuth,omitempty"`
+
+	// Replaced by Security, the connection is always verified now.
+	// The config is rejected when this is set without Security.
+	UseTls bool `yaml:"UseTls,omitempty"`
+}
+
+// Defines how each phase of a backup is retried when it fails.
+type ConfigRetry struct {
+	// Stopping the container before the backup.
+	Quiesce ConfigRetryPolicy `yaml:"Quiesce,omitempty"`
+	// Creating the tar of the volume.
+	Archive ConfigRetryPolicy `yaml:"Archive,omitempty"`
+	// Moving the backup to the destination.
+	Transfer ConfigRetryPolicy `yaml:"Transfer,omitempty"`
+	// Sending each alert.
+	Alert ConfigRetryPolicy `yaml:"Alert,omitempty"`
+}
+
+type ConfigRetryPolicy struct {
+	// The total number of attempts, defaults to 1 so nothing is retried.
+	Attempts int `yaml:"Attempts,omitempty"`
+
+	// How long to wait before the first retry, this grows by Multiplier after every attempt.
+	Delay      Duration `yaml:"Delay,omitempty"`
+	MaxDelay   Duration `yaml:"MaxDelay,omitempty"`
+	Multiplier float64  `yaml:"Multiplier,omitempty"`
+
+	// Randomly moves the wait by up to this fraction so retries don't line up, 0.2 is +/- 20%.
+	Jitter float64 `yaml:"Jitter,omitempty"`
 }
@@ -0,0 +1,77 @@
+package domain
+
+import (
+	"io"
+	"time"
+)
+
+const (
+	ControlTrigger = "trigger"
+	ControlPause   = "pause"
+	ControlResume  = "resume"
+	ControlStatus  = "status"
+)
+
+// A command sent to a running daemon over the control socket.
+type ControlRequest struct {
+	Command string `json:"command"`
+
+	// Only used by trigger, empty runs every job.
+	Container string `json:"container,omitempty"`
+
+	// Only used by pause, zero pauses until resume is sent.
+	Duration Duration `json:"duration,omitempty"`
+}
+
+// The reply from the daemon, Error is set when the command failed.
+type ControlResponse struct {
+	Error string `json:"error,omitempty"`
+
+	// Jobs that were started or skipped by a trigger.
+	Triggered []string `json:"triggered,omitempty"`
+	Skipped   []string `json:"skipped,omitempty"`
+
+	Status DaemonStatus `json:"status"`
+}
+
+// What the daemon is doing right now.
+type DaemonStatus struct {
+	Paused      bool      `json:"paused"`
+	PausedUntil time.Time `json:"pausedUntil,omitempty"`
+	Active      []string  `json:"active,omitempty"`
+}
+
+// Daemon is what the control socket needs from a running daemon.
+type Daemon interface {
+	// Runs the job now, or every job when name is empty.
+	// Returns the jobs that were started and the ones that were already running.
+	Trigger(name string) (triggered []string, skipped []string, err error)
+
+	// Stops scheduled runs from starting until Resume is called or the duration has passed.
+	Pause(duration time.Duration)
+	Resume()
+	Status() DaemonStatus
+}
+
+// DaemonApi is what the http api needs from a running daemon.
+type DaemonApi interface {
+	Daemon
+
+	// Every job with its schedule and the state from the last run.
+	Jobs() ([]JobStatus, error)
+
+	// The backups that are running right now.
+	Runs() []RunProgress
+
+	// The runs that finished, newest first.  An empty container returns every job.
+	History(container string, limit int) []RunRecord
+
+	// The backups dvb owns on every destination.
+	Backups(container string, tag string, pinned bool) ([]CatalogEntry, error)
+
+	// Applies retention to every container, or a single container when it is set.
+	Prune(container string, dryRun bool) ([]PruneSummary, error)
+
+	// Writes the metrics in the prometheus text format.
+	WriteMetrics(w io.Writer) error
+}
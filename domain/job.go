@@ -0,0 +1,10 @@
+package domain
+
+// A job is a single container that dvb backs up on its own schedule.
+type Job struct {
+	Name      string
+	Container ContainerDocker
+
+	// Cron expressions that trigger the job, empty when the job is not scheduled.
+	Schedule []string
+}
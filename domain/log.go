@@ -0,0 +1,88 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+const (
+	LogFormatText   = "text"
+	LogFormatLogfmt = "logfmt"
+	LogFormatJson   = "json"
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	}
+	return fmt.Sprintf("level(%d)", int(l))
+}
+
+func (l LogLevel) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *LogLevel) UnmarshalText(text []byte) error {
+	level, err := ParseLogLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+// Parses debug, info, warn or error, an empty value is info.
+func ParseLogLevel(value string) (LogLevel, error) {
+	switch strings.ToLower(value) {
+	case "debug":
+		return LogLevelDebug, nil
+	case "", "info":
+		return LogLevelInfo, nil
+	case "warn", "warning":
+		return LogLevelWarn, nil
+	case "error":
+		return LogLevelError, nil
+	}
+	return LogLevelInfo, fmt.Errorf("unknown log level '%v'", value)
+}
+
+// A single key and value attached to a log record.
+type LogField struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// One line of the log.
+type LogRecord struct {
+	Time    time.Time  `json:"time"`
+	Level   LogLevel   `json:"level"`
+	Message string     `json:"message"`
+	Fields  []LogField `json:"fields,omitempty"`
+}
+
+// Returns the value of the field, or an empty string when the record does not have it.
+func (r LogRecord) Field(key string) string {
+	for _, field := range r.Fields {
+		if field.Key == key {
+			return field.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,65 @@
+package domain
+
+import "time"
+
+// A backup that is running right now.
+type RunProgress struct {
+	Id        string    `json:"id"`
+	Job       string    `json:"job"`
+	Container string    `json:"container"`
+	StartedAt time.Time `json:"startedAt"`
+
+	// The step the backup is on, like quiesce, archive or transfer.
+	Phase          string    `json:"phase"`
+	PhaseStartedAt time.Time `json:"phaseStartedAt"`
+}
+
+// A backup that has finished.
+type RunRecord struct {
+	Id         string    `json:"id"`
+	Job        string    `json:"job"`
+	Container  string    `json:"container"`
+	Host       string    `json:"host,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Success    bool      `json:"success"`
+
+	// The error that ended the run.
+	Error string `json:"error,omitempty"`
+
+	// Every error that was logged during the run.
+	Errors []string `json:"errors,omitempty"`
+
+	// How long each step took, in the order they ran.
+	Phases   []PhaseTiming `json:"phases,omitempty"`
+	Attempts PhaseAttempts `json:"attempts"`
+
+	FileName    string `json:"fileName,omitempty"`
+	ArchiveSize int64  `json:"archiveSize,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+
+	// The destinations the backup was written to.
+	Destinations []string `json:"destinations,omitempty"`
+
+	// The backups removed by retention or to make room.
+	Deleted []string `json:"deleted,omitempty"`
+
+	Alerts []AlertOutcome `json:"alerts,omitempty"`
+}
+
+func (r RunRecord) Duration() time.Duration {
+	return r.FinishedAt.Sub(r.StartedAt)
+}
+
+type PhaseTiming struct {
+	Name      string        `json:"name"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// How sending an alert went.
+type AlertOutcome struct {
+	Channel  string `json:"channel"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
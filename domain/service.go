@@ -1,12 +1,15 @@
 package domain
 
 import (
-	"log"
+	"fmt"
+	"time"
 )
 
 type RunDetails struct {
 	ContainerName       string
 	ContainerBackupPath string
+	Hostname            string
+	StartedAt           time.Time
 	Backup              RunBackupDetails
 	Dest                RunDestDetails
 }
@@ -34,25 +37,13 @@ type RunDetailsDestLocal struct {
 	FullFilePath          string
 }
 
-type Logs struct {
-	Message []string
+// How many attempts each phase of a backup needed.
+type PhaseAttempts struct {
+	Quiesce  int `json:"quiesce"`
+	Archive  int `json:"archive"`
+	Transfer int `json:"transfer"`
 }
 
-func NewLogs() *Logs {
-	c := Logs{}
-	return &c
-}
-
-func (c *Logs) Add(Message string) {
-	c.Message = append(c.Message, c.generateMessage(Message))
-	log.Print(Message)
-}
-
-func (c *Logs) Error(err error) {
-	c.Message = append(c.Message, c.generateMessage(err.Error()))
-	log.Print(err.Error())
-}
-
-func (c Logs) generateMessage(msg string) string {
-	return msg
+func (a PhaseAttempts) String() string {
+	return fmt.Sprintf("quiesce %v, archive %v, transfer %v", a.Quiesce, a.Archive, a.Transfer)
 }
@@ -0,0 +1,62 @@
+package domain
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize lets the config define sizes like 500MB or 2TiB.
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	value  int64
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"TIB", 1 << 40},
+	{"KB", 1000},
+	{"MB", 1000 * 1000},
+	{"GB", 1000 * 1000 * 1000},
+	{"TB", 1000 * 1000 * 1000 * 1000},
+	{"B", 1},
+}
+
+// Converts a value like 10GB into the number of bytes.
+func ParseByteSize(value string) (ByteSize, error) {
+	v := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(v, unit.suffix) {
+			multiplier = unit.value
+			v = strings.TrimSpace(strings.TrimSuffix(v, unit.suffix))
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(v, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size '%v'", value)
+	}
+
+	return ByteSize(number * float64(multiplier)), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	err := unmarshal(&value)
+	if err != nil {
+		return err
+	}
+
+	size, err := ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+
+	*b = size
+	return nil
+}
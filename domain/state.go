@@ -0,0 +1,26 @@
+package domain
+
+import "time"
+
+// What dvb remembers about a job between runs.
+type JobState struct {
+	LastAttempt time.Time `json:"lastAttempt,omitempty"`
+	LastSuccess time.Time `json:"lastSuccess,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+}
+
+// The state file that is kept in the state directory.
+type RunState struct {
+	Jobs map[string]JobState `json:"jobs"`
+
+	// The metric counters by name and labels, so the textfile does not start from zero on every run.
+	Counters map[string]map[string]float64 `json:"counters,omitempty"`
+}
+
+// What we know about a job from the config and the state file.
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule []string  `json:"schedule,omitempty"`
+	NextRun  time.Time `json:"nextRun,omitempty"`
+	State    JobState  `json:"state"`
+}
@@ -0,0 +1,51 @@
+package domain
+
+import "time"
+
+// StringList lets the config accept a single value or a list of values.
+type StringList []string
+
+func (l *StringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single string
+	err := unmarshal(&single)
+	if err == nil {
+		*l = StringList{single}
+		return nil
+	}
+
+	var list []string
+	err = unmarshal(&list)
+	if err != nil {
+		return err
+	}
+
+	*l = list
+	return nil
+}
+
+// Duration lets the config define values like 90s or 10m.
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	err := unmarshal(&value)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Returns the value, or the fallback when it was not set.
+func (d Duration) OrDefault(fallback time.Duration) time.Duration {
+	if d <= 0 {
+		return fallback
+	}
+	return time.Duration(d)
+}
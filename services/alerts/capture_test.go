@@ -0,0 +1,172 @@
+package alerts_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func newRunResult(success bool) domain.RunResult {
+	return domain.RunResult{
+		RunRecord: domain.RunRecord{
+			Id:         "5f1c0a9e2b7d",
+			Container:  "webdav",
+			Host:       "nas01",
+			FinishedAt: time.Now(),
+			Success:    success,
+		},
+		Records: []domain.LogRecord{
+			{Level: domain.LogLevelInfo, Message: "Backup was created."},
+			{Level: domain.LogLevelError, Message: "The backup could not be moved"},
+		},
+	}
+}
+
+// A request a channel sent to the capture server.
+type capturedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// Decodes the json body into value.
+func (r capturedRequest) Json(t *testing.T, value interface{}) {
+	t.Helper()
+
+	err := json.Unmarshal(r.Body, value)
+	if err != nil {
+		t.Fatalf("%v %v does not have a json body: %v", r.Method, r.Path, err)
+	}
+}
+
+// Parses the multipart body, files included.
+func (r capturedRequest) Form(t *testing.T) *multipart.Form {
+	t.Helper()
+
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(r.Body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return form
+}
+
+// Returns the content of the file sent in the form field.
+func (r capturedRequest) File(t *testing.T, field string) (string, string) {
+	t.Helper()
+
+	files := r.Form(t).File[field]
+	if len(files) != 1 {
+		t.Fatalf("expected one file in %v but got %v", field, len(files))
+	}
+	file, err := files[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files[0].Filename, string(content)
+}
+
+// Answers a request with a status and body, nil answers every request with 200.
+type captureResponder func(r *http.Request) (int, string)
+
+// A server that records every request the channels send to it.
+type captureServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []capturedRequest
+}
+
+func newCaptureServer(t *testing.T, respond captureResponder) *captureServer {
+	s := &captureServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.mu.Lock()
+		s.requests = append(s.requests, capturedRequest{
+			Method: r.Method,
+			Path:   r.URL.EscapedPath(),
+			Header: r.Header.Clone(),
+			Body:   body,
+		})
+		s.mu.Unlock()
+
+		status, content := http.StatusOK, ""
+		if respond != nil {
+			status, content = respond(r)
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(content))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *captureServer) Requests() []capturedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]capturedRequest(nil), s.requests...)
+}
+
+// One result sent to a channel that points at the capture server.
+type notifyCase struct {
+	name string
+
+	// The channel and its config for the url of the capture server.
+	factory alerts.NotifierFactory
+	config  func(url string) domain.ConfigAlert
+	result  domain.RunResult
+	respond captureResponder
+
+	// Part of the error Notify should return, empty when it should work.
+	err string
+
+	// Checks what the server was sent.
+	check func(t *testing.T, requests []capturedRequest)
+}
+
+func runNotifyCases(t *testing.T, cases []notifyCase) {
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := newCaptureServer(t, c.respond)
+			notifier, ok := c.factory(c.config(server.URL))
+			if !ok {
+				t.Fatal("expected the channel to be configured")
+			}
+
+			err := notifier.Notify(context.Background(), c.result)
+			switch {
+			case c.err == "" && err != nil:
+				t.Fatal(err)
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Fatalf("expected an error with %q but got %v", c.err, err)
+			}
+
+			if c.check != nil {
+				c.check(t, server.Requests())
+			}
+		})
+	}
+}
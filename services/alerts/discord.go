@@ -1,29 +1,45 @@
 package alerts
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
 )
 
 const (
 	DiscordErrorColor   = 16711680
 	DiscordSuccessColor = 65290
 
+	DiscordDefaultBaseUrl = "https://discord.com"
+
+	// The limits discord puts on a webhook message, in characters.
+	DiscordMaxContent     = 2000
+	DiscordMaxDescription = 4096
+	DiscordMaxEmbedsSize  = 6000
+	DiscordMaxEmbeds      = 10
+
+	// How many times a webhook is tried again when discord rate limits it.
+	DiscordRateLimitRetries = 5
+
+	// The description that is sent when the log is attached.
+	DiscordAttachedLog = "The log is too long for discord, it is attached."
+
 	ErrDiscordContentLengthTooLong = "the message length is greater then 2000 characters"
-	ErrDiscordEmbedLenthTooLong    = "the message length is greater then 4096 characters"
+	ErrDiscordEmbedLenthTooLong    = "the embeds are longer than the 6000 characters discord allows in a message"
+	ErrDiscordNoWebhooks           = "no webhooks given to post to"
 )
 
 type DiscordBasicAlertClient struct {
 	webhooks []string
 	username string
+	baseUrl  string
 
 	message domain.DiscordBasicMessage
 }
@@ -32,6 +48,7 @@ func NewDiscordBasicAlertClient(params domain.ConfigAlertDiscord) DiscordBasicAl
 	c := DiscordBasicAlertClient{
 		webhooks: params.Webhooks,
 		username: params.Username,
+		baseUrl:  params.BaseUrl,
 	}
 	c.message = c.NewMessage()
 	return c
@@ -48,71 +65,38 @@ func (c *DiscordBasicAlertClient) SetContent(content string) {
 	c.message.Content = content
 }
 
-func (c DiscordBasicAlertClient) validateWebhooks() error {
-	if len(c.webhooks) == 0 {
-		return errors.New("no webhooks given to post to")
-	}
-
-	// Check to confirm the webhook uri is correct
-	for _, uri := range c.webhooks {
-		if strings.Contains(uri, "https://discord.com/api/webhooks/") {
-			continue
-		}
-
-		return errors.New("invalid uri given to post to")
-	}
-
-	return nil
-}
-
 func (c DiscordBasicAlertClient) SendPayload() error {
-	err := c.validateWebhooks()
-	if err != nil {
-		return err
-	}
+	return c.SendPayloadContext(context.Background())
+}
 
-	if len(c.message.Content) >= 2000 {
+// Sends the message to every webhook, a webhook that fails does not stop the others.
+func (c DiscordBasicAlertClient) SendPayloadContext(ctx context.Context) error {
+	if utf8.RuneCountInString(c.message.Content) > DiscordMaxContent {
 		return errors.New(ErrDiscordContentLengthTooLong)
 	}
 
-	// Convert the message to a io.reader object
-	buffer := new(bytes.Buffer)
-	json.NewEncoder(buffer).Encode(c.message)
-
-	// Send the message
-	for _, Url := range c.webhooks {
-
-		resp, err := http.Post(Url, "application/json", buffer)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
-
-		// Check for 204
-		if resp.StatusCode != 204 {
-			errMsg, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return err
-			}
-
-			return fmt.Errorf(string(errMsg))
-		}
+	content, err := json.Marshal(c.message)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return postDiscordWebhooks(ctx, discordWebhooks{base: c.baseUrl, urls: c.webhooks}, content, "application/json")
 }
 
 type DiscordEmbedClient struct {
-	webhooks []string
+	webhooks discordWebhooks
 	username string
 
 	embed domain.DiscordEmbed
+
+	// Sent in place of the description when it does not fit in the message.
+	attachment *formFile
 }
 
 // Generates a new Discord Embed Client
 func NewDiscordEmbedMessage(config domain.ConfigAlertDiscord) DiscordEmbedClient {
 	c := DiscordEmbedClient{
-		webhooks: config.Webhooks,
+		webhooks: discordWebhooks{base: config.BaseUrl, urls: config.Webhooks},
 		username: config.Username,
 	}
 
@@ -166,67 +150,227 @@ func (c *DiscordEmbedClient) SetFooter(params DiscordEmbedFooterParams) {
 	c.embed.Footer.IconUrl = params.IconUrl
 }
 
+// Attaches the file when the description is too long for discord, the description then says it is attached.
+func (c *DiscordEmbedClient) SetAttachment(name string, content []byte) {
+	c.attachment = &formFile{Field: "files[0]", Name: name, Content: content}
+}
+
 func (c DiscordEmbedClient) SendPayload() error {
-	var embeds []domain.DiscordEmbed
+	return c.SendPayloadContext(context.Background())
+}
+
+// Sends the embed to every webhook, stopping when the context is done.
+// A long description is split across embeds, or sent as the attachment when even that does not fit.
+func (c DiscordEmbedClient) SendPayloadContext(ctx context.Context) error {
+	msg, err := c.NewPayload()
+	if err != nil && c.attachment == nil {
+		return err
+	}
+
+	if err == nil {
+		content, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+
+		logger.Default().Debug("Sending the discord payload", "payload", string(content))
+		return postDiscordWebhooks(ctx, c.webhooks, content, "application/json")
+	}
 
-	err := c.validateWebhooks()
+	short := c
+	short.embed.Description = DiscordAttachedLog
+	msg, err = short.NewPayload()
 	if err != nil {
 		return err
 	}
 
-	if len(c.embed.Description) >= 4096 {
-		return errors.New(ErrDiscordEmbedLenthTooLong)
+	content, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	logger.Default().Debug("Sending the discord payload with an attachment", "payload", string(content), "file", c.attachment.Name)
+	body, contentType, err := newMultipart(map[string]string{"payload_json": string(content)}, *c.attachment)
+	if err != nil {
+		return err
+	}
+	return postDiscordWebhooks(ctx, c.webhooks, body, contentType)
+}
+
+// Builds the message, splitting the description across embeds when it is too long for one.
+// Returns an error when the embeds are more than discord allows in one message.
+func (c DiscordEmbedClient) NewPayload() (domain.DiscordBasicMessage, error) {
+	chunks := splitDiscordText(c.embed.Description, DiscordMaxDescription)
+
+	first := c.embed
+	first.Description = ""
+	if len(chunks) >= 1 {
+		first.Description = chunks[0]
+	}
+
+	embeds := []domain.DiscordEmbed{first}
+	for i := 1; i < len(chunks); i++ {
+		embeds = append(embeds, domain.DiscordEmbed{Description: chunks[i], Color: c.embed.Color})
 	}
 
-	embeds = append(embeds, c.embed)
 	msg := domain.DiscordBasicMessage{
 		Username: c.username,
-		Content:  "",
 		Embeds:   embeds,
 	}
+	if len(embeds) > DiscordMaxEmbeds || discordEmbedsSize(embeds) > DiscordMaxEmbedsSize {
+		return msg, errors.New(ErrDiscordEmbedLenthTooLong)
+	}
+	return msg, nil
+}
 
-	// Convert the message to a io.reader object
-	buffer := new(bytes.Buffer)
-	json.NewEncoder(buffer).Encode(msg)
-
-	log.Print(buffer)
+// Counts the characters discord counts towards the size of a message.
+func discordEmbedsSize(embeds []domain.DiscordEmbed) int {
+	size := 0
+	for _, embed := range embeds {
+		size += utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+		size += utf8.RuneCountInString(embed.Author.Name) + utf8.RuneCountInString(embed.Footer.Value)
+		for _, field := range embed.Fields {
+			size += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+		}
+	}
+	return size
+}
 
-	// Send the message
-	for _, Url := range c.webhooks {
+// Splits the text into chunks of at most max characters, between lines when it can.
+func splitDiscordText(text string, max int) []string {
+	if text == "" {
+		return nil
+	}
 
-		resp, err := http.Post(Url, "application/json", buffer)
-		if err != nil {
-			return err
-		}
-		defer resp.Body.Close()
+	var chunks []string
+	var current []rune
+	for _, line := range strings.Split(text, "\n") {
+		runes := []rune(line)
 
-		// Check for 204
-		if resp.StatusCode != 204 {
-			errMsg, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return err
+		// A line that does not fit in a chunk of its own is cut
+		for len(runes) > max {
+			if len(current) >= 1 {
+				chunks = append(chunks, string(current))
+				current = nil
 			}
+			chunks = append(chunks, string(runes[:max]))
+			runes = runes[max:]
+		}
 
-			return fmt.Errorf(string(errMsg))
+		switch {
+		case len(current) == 0:
+			current = runes
+		case len(current)+1+len(runes) <= max:
+			current = append(append(current, '\n'), runes...)
+		default:
+			chunks = append(chunks, string(current))
+			current = runes
 		}
 	}
+	if len(current) >= 1 {
+		chunks = append(chunks, string(current))
+	}
+	return chunks
+}
 
-	return nil
+// The webhooks of a channel and the base url they must be on.
+type discordWebhooks struct {
+	base string
+	urls []string
 }
 
-func (c DiscordEmbedClient) validateWebhooks() error {
-	if len(c.webhooks) == 0 {
-		return errors.New("no webhooks given to post to")
+// Posts the body to every webhook on its own, a webhook that fails does not stop the others.
+// The error names each webhook that failed by its id, the token stays out of the logs.
+func postDiscordWebhooks(ctx context.Context, webhooks discordWebhooks, body []byte, contentType string) error {
+	if len(webhooks.urls) == 0 {
+		return errors.New(ErrDiscordNoWebhooks)
 	}
 
-	// Check to confirm the webhook uri is correct
-	for _, uri := range c.webhooks {
-		if strings.Contains(uri, "https://discord.com/api/webhooks/") {
-			continue
+	label := func(i int, uri string) string {
+		return "webhook " + discordWebhookId(webhooks.base, uri, i)
+	}
+	return sendEach(ctx, "discord webhooks", webhooks.urls, label, func(uri string) error {
+		err := ValidateDiscordWebhook(webhooks.base, uri)
+		if err != nil {
+			return err
 		}
+		return sendRateLimited(ctx, http.MethodPost, uri, body, map[string]string{"Content-Type": contentType}, DiscordRateLimitRetries)
+	})
+}
 
-		return errors.New("invalid uri given to post to")
+func discordWebhookPrefix(base string) string {
+	if base == "" {
+		base = DiscordDefaultBaseUrl
 	}
+	return strings.TrimSuffix(base, "/") + "/api/webhooks/"
+}
 
+// Checks that the webhook is a discord webhook on the base url, which defaults to discord.com.
+func ValidateDiscordWebhook(base string, uri string) error {
+	if !strings.HasPrefix(uri, discordWebhookPrefix(base)) {
+		return errors.New("invalid uri given to post to")
+	}
 	return nil
 }
+
+// Returns the id part of the webhook url, or its position when it does not have one.
+func discordWebhookId(base string, uri string, index int) string {
+	id := strings.SplitN(strings.TrimPrefix(uri, discordWebhookPrefix(base)), "/", 2)[0]
+	if id == "" || id == uri {
+		return fmt.Sprintf("#%v", index+1)
+	}
+	return id
+}
+
+func init() {
+	Register("discord", NewDiscordNotifier)
+}
+
+// Sends the result of a run as a discord embed.
+type DiscordNotifier struct {
+	config domain.ConfigAlertDiscord
+}
+
+func NewDiscordNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if len(config.Discord.Webhooks) == 0 {
+		return nil, false
+	}
+	return DiscordNotifier{config: config.Discord}, true
+}
+
+func (n DiscordNotifier) Name() string {
+	return "discord"
+}
+
+func (n DiscordNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+func (n DiscordNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	client := NewDiscordEmbedMessage(n.config)
+
+	color := DiscordSuccessColor
+	if result.IsError() {
+		color = DiscordErrorColor
+	}
+
+	client.AppendFields(DiscordEmbedFieldParams{
+		Name:   "Server",
+		Value:  resultHost(result),
+		Inline: true,
+	})
+
+	client.AppendFields(DiscordEmbedFieldParams{
+		Name:   "Container",
+		Value:  result.Container,
+		Inline: true,
+	})
+
+	client.SetBody(DiscordEmbedBodyParams{
+		Title:       AlertTitle,
+		Color:       color,
+		Description: strings.Join(RenderRecords(result.Records, domain.LogLevelInfo), "\n"),
+	})
+	client.SetAttachment(strings.TrimSuffix(LogFileName(result), ".log")+".txt", logger.FormatRecords(result.Records))
+	return client.SendPayloadContext(ctx)
+}
@@ -1,8 +1,20 @@
 package alerts_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/jtom38/dvb/domain"
 	"github.com/jtom38/dvb/services/alerts"
@@ -83,3 +95,213 @@ func TestDiscordEmbedMessage(t *testing.T) {
 	}
 
 }
+
+// A discord server that records every webhook request and answers with the status of the webhook id.
+type fakeDiscord struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests map[string][]*http.Request
+	bodies   map[string][][]byte
+	status   map[string][]int
+}
+
+func newFakeDiscord(t *testing.T) *fakeDiscord {
+	d := &fakeDiscord{
+		requests: make(map[string][]*http.Request),
+		bodies:   make(map[string][][]byte),
+		status:   make(map[string][]int),
+	}
+	d.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/webhooks/"), "/")[0]
+		body, _ := io.ReadAll(r.Body)
+
+		d.mu.Lock()
+		d.requests[id] = append(d.requests[id], r)
+		d.bodies[id] = append(d.bodies[id], body)
+		status := http.StatusNoContent
+		if len(d.status[id]) >= 1 {
+			status = d.status[id][0]
+			d.status[id] = d.status[id][1:]
+		}
+		d.mu.Unlock()
+
+		switch status {
+		case http.StatusTooManyRequests:
+			if r.URL.Query().Get("header") != "" {
+				w.Header().Set("Retry-After", "0.05")
+				w.WriteHeader(status)
+				return
+			}
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message": "You are being rate limited.", "retry_after": 0.05, "global": false}`))
+		case http.StatusNoContent:
+			w.WriteHeader(status)
+		default:
+			w.WriteHeader(status)
+			w.Write([]byte(`{"message": "Unknown Webhook", "code": 10015}`))
+		}
+	}))
+	t.Cleanup(d.server.Close)
+	return d
+}
+
+func (d *fakeDiscord) Webhook(id string) string {
+	return fmt.Sprintf("%v/api/webhooks/%v/token-%v", d.server.URL, id, id)
+}
+
+func (d *fakeDiscord) Config(ids ...string) domain.ConfigAlert {
+	config := domain.ConfigAlert{Discord: domain.ConfigAlertDiscord{BaseUrl: d.server.URL}}
+	for _, id := range ids {
+		config.Discord.Webhooks = append(config.Discord.Webhooks, d.Webhook(id))
+	}
+	return config
+}
+
+func (d *fakeDiscord) Bodies(id string) [][]byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.bodies[id]
+}
+
+func TestDiscordNotifyWebhooks(t *testing.T) {
+	discord := newFakeDiscord(t)
+	discord.status["3"] = []int{http.StatusNotFound}
+
+	notifier, ok := alerts.NewDiscordNotifier(discord.Config("1", "2", "3"))
+	if !ok {
+		t.Fatal("expected discord to be configured")
+	}
+
+	err := notifier.Notify(context.Background(), newRunResult(false))
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") || !strings.Contains(err.Error(), "webhook 3: unexpected response 404") {
+		t.Errorf("expected only webhook 3 to fail but got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "token-3") {
+		t.Error("expected the webhook token to be left out of the error")
+	}
+
+	first, second := discord.Bodies("1"), discord.Bodies("2")
+	if len(first) != 1 || len(second) != 1 || len(first[0]) == 0 || string(first[0]) != string(second[0]) {
+		t.Fatalf("expected both webhooks to get the same message but got %q and %q", first, second)
+	}
+
+	var message domain.DiscordBasicMessage
+	err = json.Unmarshal(first[0], &message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Embeds) != 1 || message.Embeds[0].Color != alerts.DiscordErrorColor {
+		t.Errorf("unexpected message %+v", message)
+	}
+
+	// A retry of the same alert only goes to the webhook that failed
+	discord.status["3"] = []int{http.StatusNotFound}
+	outcomes := alerts.Dispatch(context.Background(), alerts.DispatchParams{
+		Notifiers: []domain.Notifier{notifier},
+		Retry:     domain.ConfigRetryPolicy{Attempts: 2, Delay: domain.Duration(time.Millisecond)},
+	}, newRunResult(false))
+	if outcomes[0].Error != "" || outcomes[0].Attempts != 2 {
+		t.Fatalf("expected the retry to reach webhook 3 but got %+v", outcomes[0])
+	}
+	if len(discord.Bodies("1")) != 2 || len(discord.Bodies("3")) != 3 {
+		t.Errorf("expected only webhook 3 to be sent to again")
+	}
+
+	// Nothing is remembered between alerts
+	err = notifier.Notify(context.Background(), newRunResult(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(discord.Bodies("1")) != 3 || len(discord.Bodies("2")) != 3 {
+		t.Errorf("expected the next alert to reach every webhook")
+	}
+}
+
+func TestDiscordRateLimit(t *testing.T) {
+	discord := newFakeDiscord(t)
+	// The first webhook is told to wait by the header, the second by the body
+	discord.status["1"] = []int{http.StatusTooManyRequests, http.StatusNoContent, http.StatusTooManyRequests}
+
+	config := discord.Config("1")
+	config.Discord.Webhooks[0] += "?header=1"
+	config.Discord.Webhooks = append(config.Discord.Webhooks, discord.Webhook("1"))
+
+	client := alerts.NewDiscordBasicAlertClient(config.Discord)
+	client.SetContent("hi")
+
+	started := time.Now()
+	err := client.SendPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(started) < 100*time.Millisecond {
+		t.Errorf("expected the client to wait for both rate limits, it took %v", time.Since(started))
+	}
+	if len(discord.Bodies("1")) != 4 {
+		t.Errorf("expected 4 requests but got %v", len(discord.Bodies("1")))
+	}
+}
+
+func TestDiscordLongLog(t *testing.T) {
+	discord := newFakeDiscord(t)
+	notifier, _ := alerts.NewDiscordNotifier(discord.Config("1"))
+
+	result := newRunResult(true)
+	for i := 0; i < 60; i++ {
+		result.Records = append(result.Records, domain.LogRecord{Level: domain.LogLevelInfo, Message: strings.Repeat("x", 80)})
+	}
+
+	// About 5000 characters is split across two embeds
+	err := notifier.Notify(context.Background(), result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var message domain.DiscordBasicMessage
+	err = json.Unmarshal(discord.Bodies("1")[0], &message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(message.Embeds) != 2 || len(message.Embeds[0].Description) > alerts.DiscordMaxDescription || message.Embeds[0].Title != alerts.AlertTitle {
+		t.Fatalf("expected the log to be split across two embeds but got %v", len(message.Embeds))
+	}
+	if strings.HasPrefix(message.Embeds[1].Description, "\n") || message.Embeds[1].Color != alerts.DiscordSuccessColor {
+		t.Errorf("expected the second embed to start at a line")
+	}
+
+	// Anything longer is attached
+	for i := 0; i < 200; i++ {
+		result.Records = append(result.Records, domain.LogRecord{Level: domain.LogLevelInfo, Message: strings.Repeat("y", 80)})
+	}
+	notifier, _ = alerts.NewDiscordNotifier(discord.Config("1"))
+	err = notifier.Notify(context.Background(), result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	discord.mu.Lock()
+	req := discord.requests["1"][1]
+	body := discord.bodies["1"][1]
+	discord.mu.Unlock()
+
+	_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(form.Value["payload_json"][0], alerts.DiscordAttachedLog) {
+		t.Errorf("expected the embed to say the log is attached but got %v", form.Value["payload_json"])
+	}
+	files := form.File["files[0]"]
+	if len(files) != 1 || files[0].Filename != "webdav-5f1c0a9e2b7d.txt" {
+		t.Fatalf("expected the log to be attached but got %+v", files)
+	}
+	if files[0].Size < 20000 {
+		t.Errorf("expected the whole log to be attached but it is %v bytes", files[0].Size)
+	}
+}
@@ -1,16 +1,25 @@
 package alerts
 
 import (
-	"crypto/tls"
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"text/template"
 
 	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
 	"gopkg.in/gomail.v2"
 )
 
 const (
 	EmailSubjectSuccess = "Backup Successful"
 	EmailSubjectError   = "Backup Error"
+
+	ErrEmailNoRecipients = "the email does not have any recipients"
 )
 
 type SmtpClient struct {
@@ -18,6 +27,8 @@ type SmtpClient struct {
 
 	subject string
 	body    string
+	text    string
+	files   []formFile
 }
 
 func NewSmtpClient(config domain.ConfigAlertEmail) SmtpClient {
@@ -30,36 +41,186 @@ func (c *SmtpClient) SetSubject(value string) {
 	c.subject = value
 }
 
+// Sets the html body.
 func (c *SmtpClient) SetBody(value string) {
 	c.body = value
 }
 
+// Sets the plain text body, the html body is sent as an alternative to it.
+func (c *SmtpClient) SetText(value string) {
+	c.text = value
+}
+
+func (c *SmtpClient) Attach(name string, content []byte) {
+	c.files = append(c.files, formFile{Name: name, Content: content})
+}
+
 func (c SmtpClient) SendAlert() error {
+	return c.SendAlertContext(context.Background())
+}
 
+func (c SmtpClient) SendAlertContext(ctx context.Context) error {
 	if c.subject == "" {
 		return errors.New("subject was null and needs a value")
 	}
 
-	if c.body == "" {
+	if c.body == "" && c.text == "" {
 		return errors.New("no body was found")
 	}
 
-	dial := gomail.NewDialer(c.Config.Account.Host, c.Config.Account.Port, c.Config.Account.Username, c.Config.Account.Password)
+	if len(c.Config.To)+len(c.Config.Cc)+len(c.Config.Bcc) == 0 {
+		return errors.New(ErrEmailNoRecipients)
+	}
 
-	dial.TLSConfig = &tls.Config{
-		InsecureSkipVerify: c.Config.Account.UseTls,
+	// gomail builds the message and reads the recipients from it, the smtp connection is ours.
+	// Its errors only say which message failed, so the error from the server is returned as it is.
+	var sendErr error
+	sender := gomail.SendFunc(func(from string, to []string, msg io.WriterTo) error {
+		sendErr = sendMail(ctx, c.Config.Account, from, to, msg)
+		return sendErr
+	})
+
+	err := gomail.Send(sender, c.NewMessage())
+	if sendErr != nil {
+		return sendErr
 	}
+	return err
+}
 
+// Builds the message with the plain text and html bodies and the attachments.
+func (c SmtpClient) NewMessage() *gomail.Message {
 	msg := gomail.NewMessage()
 	msg.SetHeader("From", c.Config.From)
-	msg.SetAddressHeader("To", c.Config.To, "test")
+	for field, addresses := range map[string]domain.StringList{"To": c.Config.To, "Cc": c.Config.Cc, "Bcc": c.Config.Bcc} {
+		if len(addresses) >= 1 {
+			msg.SetHeader(field, addresses...)
+		}
+	}
 	msg.SetHeader("Subject", c.subject)
-	msg.SetBody("text/html", c.body)
 
-	err := dial.DialAndSend(msg)
+	switch {
+	case c.text != "" && c.body != "":
+		msg.SetBody("text/plain", c.text)
+		msg.AddAlternative("text/html", c.body)
+	case c.text != "":
+		msg.SetBody("text/plain", c.text)
+	default:
+		msg.SetBody("text/html", c.body)
+	}
+
+	for _, file := range c.files {
+		content := file.Content
+		msg.Attach(file.Name,
+			gomail.SetHeader(map[string][]string{"Content-Type": {fmt.Sprintf(`text/plain; charset=UTF-8; name="%v"`, file.Name)}}),
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(content)
+				return err
+			}),
+		)
+	}
+
+	return msg
+}
+
+func init() {
+	Register("email", NewEmailNotifier)
+}
+
+// Sends the result of a run as an email.
+type EmailNotifier struct {
+	config domain.ConfigAlertEmail
+}
+
+func NewEmailNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if config.Email.Account.Host == "" || len(config.Email.To)+len(config.Email.Cc)+len(config.Email.Bcc) == 0 {
+		return nil, false
+	}
+	return EmailNotifier{config: config.Email}, true
+}
+
+func (n EmailNotifier) Name() string {
+	return "email"
+}
+
+func (n EmailNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+// Sends the summary as plain text and html with the full log attached.
+func (n EmailNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	subject, err := RenderEmailSubject(n.config, result)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	client := NewSmtpClient(n.config)
+	client.SetSubject(subject)
+	client.SetText(RenderSummary(result))
+	client.SetBody(NewEmailHtml(result))
+	if len(result.Records) >= 1 {
+		client.Attach(LogFileName(result), logger.FormatRecords(result.Records))
+	}
+	return client.SendAlertContext(ctx)
+}
+
+// Parses a subject template, it can use the same functions as the webhook body.
+func ParseEmailSubject(subject string) (*template.Template, error) {
+	return template.New("subject").Funcs(webhookFuncs).Parse(subject)
+}
+
+// Renders the success or error subject, without a template the container is added to the default subject.
+func RenderEmailSubject(config domain.ConfigAlertEmail, result domain.RunResult) (string, error) {
+	subject, text := EmailSubjectSuccess, config.SubjectSuccess
+	if result.IsError() {
+		subject, text = EmailSubjectError, config.SubjectError
+	}
+
+	if text == "" {
+		if result.Container == "" {
+			return subject, nil
+		}
+		return fmt.Sprintf("%v: %v", subject, result.Container), nil
+	}
+
+	tmpl, err := ParseEmailSubject(text)
+	if err != nil {
+		return "", err
+	}
+
+	result.Host = resultHost(result)
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, result)
+	if err != nil {
+		return "", err
+	}
+
+	// A header can not have line breaks
+	return strings.Join(strings.Fields(buffer.String()), " "), nil
+}
+
+// Builds the html body, the same summary as the plain text with the status in colour.
+func NewEmailHtml(result domain.RunResult) string {
+	status := "✅"
+	color := DiscordSuccessColor
+	if result.IsError() {
+		status = "❌"
+		color = DiscordErrorColor
+	}
+
+	var b strings.Builder
+	b.WriteString("<html><body>")
+	fmt.Fprintf(&b, `<h3 style="color: #%06x">%v %v</h3>`, color, status, html.EscapeString(AlertTitle))
+	fmt.Fprintf(&b, "<p><b>Server:</b> %v<br><b>Container:</b> %v</p>", html.EscapeString(resultHost(result)), html.EscapeString(result.Container))
+
+	lines := RenderRecords(result.Records, domain.LogLevelInfo)
+	if len(lines) >= 1 {
+		escaped := make([]string, len(lines))
+		for i, line := range lines {
+			escaped[i] = html.EscapeString(line)
+		}
+		fmt.Fprintf(&b, "<p>%v</p>", strings.Join(escaped, "<br>"))
+	}
+
+	b.WriteString("</body></html>")
+	return b.String()
 }
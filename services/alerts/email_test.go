@@ -1,7 +1,18 @@
 package alerts_test
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/jtom38/dvb/domain"
@@ -37,3 +48,289 @@ func TestEmailSetTo(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// What the fake mail server was sent.
+type smtpDelivery struct {
+	Auth string
+	From string
+	To   []string
+	Data string
+}
+
+// A small smtp server that takes every message, with starttls when tlsConfig is set.
+type fakeSmtp struct {
+	listener  net.Listener
+	tlsConfig *tls.Config
+
+	mu         sync.Mutex
+	deliveries []smtpDelivery
+}
+
+func newFakeSmtp(t *testing.T, listener net.Listener, tlsConfig *tls.Config) *fakeSmtp {
+	s := &fakeSmtp{listener: listener, tlsConfig: tlsConfig}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSmtp) Port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSmtp) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake ESMTP")
+
+	var delivery smtpDelivery
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		switch command {
+		case "EHLO":
+			text.PrintfLine("250-fake")
+			if _, ok := conn.(*tls.Conn); !ok && s.tlsConfig != nil {
+				text.PrintfLine("250-STARTTLS")
+			}
+			text.PrintfLine("250 AUTH PLAIN LOGIN")
+		case "STARTTLS":
+			text.PrintfLine("220 ready")
+			tlsConn := tls.Server(conn, s.tlsConfig)
+			if tlsConn.Handshake() != nil {
+				return
+			}
+			conn = tlsConn
+			text = textproto.NewConn(conn)
+		case "AUTH":
+			fields := strings.Fields(line)
+			decoded, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			delivery.Auth = strings.ReplaceAll(string(decoded), "\x00", " ")
+			text.PrintfLine("235 ok")
+		case "MAIL":
+			delivery.From = line
+			text.PrintfLine("250 ok")
+		case "RCPT":
+			delivery.To = append(delivery.To, strings.TrimSuffix(strings.TrimPrefix(line, "RCPT TO:<"), ">"))
+			text.PrintfLine("250 ok")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			lines, err := text.ReadDotLines()
+			if err != nil {
+				return
+			}
+			delivery.Data = strings.Join(lines, "\n")
+			s.mu.Lock()
+			s.deliveries = append(s.deliveries, delivery)
+			s.mu.Unlock()
+			text.PrintfLine("250 ok")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *fakeSmtp) Deliveries() []smtpDelivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpDelivery(nil), s.deliveries...)
+}
+
+func listen(t *testing.T) net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return listener
+}
+
+// Returns a tls config for 127.0.0.1 and a CA file that trusts it.
+func newTestCertificate(t *testing.T) (*tls.Config, string) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(server.Close)
+
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	content := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err := os.WriteFile(path, content, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Config{Certificates: server.TLS.Certificates}, path
+}
+
+func newTestEmail(port int, security string) domain.ConfigAlert {
+	return domain.ConfigAlert{
+		Email: domain.ConfigAlertEmail{
+			Account: domain.ConfigAlertEmailAccount{
+				Username: "dvb",
+				Password: "secret",
+				Host:     "127.0.0.1",
+				Port:     port,
+				Security: security,
+			},
+			From: "dvb@example.com",
+			To:   domain.StringList{"admin@example.com", "ops@example.com"},
+			Cc:   domain.StringList{"lead@example.com"},
+			Bcc:  domain.StringList{"audit@example.com"},
+		},
+	}
+}
+
+func TestEmailNotify(t *testing.T) {
+	server := newFakeSmtp(t, listen(t), nil)
+
+	notifier, ok := alerts.NewEmailNotifier(newTestEmail(server.Port(), domain.EmailSecurityNone))
+	if !ok {
+		t.Fatal("expected email to be configured")
+	}
+
+	err := notifier.Notify(context.Background(), newRunResult(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := server.Deliveries()
+	if len(deliveries) != 1 {
+		t.Fatalf("expected one email but got %v", len(deliveries))
+	}
+	delivery := deliveries[0]
+
+	if delivery.Auth != " dvb secret" {
+		t.Errorf("unexpected login %q", delivery.Auth)
+	}
+	if strings.Join(delivery.To, ",") != "admin@example.com,ops@example.com,lead@example.com,audit@example.com" {
+		t.Errorf("unexpected recipients %v", delivery.To)
+	}
+
+	expected := []string{
+		"Subject: Backup Error: webdav",
+		"To: admin@example.com, ops@example.com",
+		"Cc: lead@example.com",
+		"multipart/mixed",
+		"multipart/alternative",
+		"Content-Type: text/plain",
+		"Content-Type: text/html",
+		`filename="webdav-5f1c0a9e2b7d.log"`,
+	}
+	for _, value := range expected {
+		if !strings.Contains(delivery.Data, value) {
+			t.Errorf("expected the email to have %q\n%v", value, delivery.Data)
+		}
+	}
+	if strings.Contains(delivery.Data, "audit@example.com") {
+		t.Error("expected the bcc address to be left out of the headers")
+	}
+}
+
+func TestEmailStartTls(t *testing.T) {
+	tlsConfig, caFile := newTestCertificate(t)
+	server := newFakeSmtp(t, listen(t), tlsConfig)
+
+	config := newTestEmail(server.Port(), domain.EmailSecurityStartTls)
+	notifier, _ := alerts.NewEmailNotifier(config)
+	err := notifier.Notify(context.Background(), newRunResult(true))
+	if err == nil {
+		t.Fatal("expected the self signed certificate to be rejected without the CaFile")
+	}
+
+	config.Email.Account.CaFile = caFile
+	notifier, _ = alerts.NewEmailNotifier(config)
+	err = notifier.Notify(context.Background(), newRunResult(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deliveries := server.Deliveries()
+	if len(deliveries) != 1 || !strings.Contains(deliveries[0].Data, "Subject: Backup Successful: webdav") {
+		t.Errorf("expected the email to be sent over starttls but got %+v", deliveries)
+	}
+}
+
+func TestEmailStartTlsRequired(t *testing.T) {
+	server := newFakeSmtp(t, listen(t), nil)
+
+	notifier, _ := alerts.NewEmailNotifier(newTestEmail(server.Port(), ""))
+	err := notifier.Notify(context.Background(), newRunResult(true))
+	if err == nil || err.Error() != alerts.ErrSmtpStartTls {
+		t.Errorf("expected the email to need starttls but got %v", err)
+	}
+	if len(server.Deliveries()) != 0 {
+		t.Error("expected nothing to be sent without tls")
+	}
+}
+
+func TestEmailPlaintextAuthAllowed(t *testing.T) {
+	cases := []struct {
+		account domain.ConfigAlertEmailAccount
+		allowed bool
+	}{
+		{domain.ConfigAlertEmailAccount{Host: "127.0.0.1"}, true},
+		{domain.ConfigAlertEmailAccount{Host: "::1"}, true},
+		{domain.ConfigAlertEmailAccount{Host: "localhost"}, true},
+		{domain.ConfigAlertEmailAccount{Host: "smtp.example.com"}, false},
+		{domain.ConfigAlertEmailAccount{Host: "192.168.1.10"}, false},
+		{domain.ConfigAlertEmailAccount{Host: "smtp.example.com", AllowPlaintextAuth: true}, true},
+	}
+
+	for _, c := range cases {
+		if alerts.EmailPlaintextAuthAllowed(c.account) != c.allowed {
+			t.Errorf("%v: expected allowed to be %v", c.account.Host, c.allowed)
+		}
+	}
+}
+
+func TestEmailTls(t *testing.T) {
+	tlsConfig, caFile := newTestCertificate(t)
+	server := newFakeSmtp(t, tls.NewListener(listen(t), tlsConfig), nil)
+
+	config := newTestEmail(server.Port(), domain.EmailSecurityTls)
+	config.Email.Account.CaFile = caFile
+	notifier, _ := alerts.NewEmailNotifier(config)
+
+	err := notifier.Notify(context.Background(), newRunResult(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(server.Deliveries()) != 1 {
+		t.Error("expected the email to be sent over tls")
+	}
+}
+
+func TestRenderEmailSubject(t *testing.T) {
+	config := domain.ConfigAlertEmail{
+		SubjectError: "[{{.Host}}] {{.Container}}\nfailed",
+	}
+
+	subject, err := alerts.RenderEmailSubject(config, newRunResult(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "[nas01] webdav failed" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+
+	subject, err = alerts.RenderEmailSubject(config, domain.RunResult{RunRecord: domain.RunRecord{Success: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != alerts.EmailSubjectSuccess {
+		t.Errorf("unexpected subject %q", subject)
+	}
+}
@@ -0,0 +1,77 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	GotifyDefaultSuccessPriority = 4
+	GotifyDefaultErrorPriority   = 8
+)
+
+func init() {
+	Register("gotify", NewGotifyNotifier)
+}
+
+// Sends the result of a run to a gotify application.
+type GotifyNotifier struct {
+	config domain.ConfigAlertGotify
+}
+
+func NewGotifyNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if config.Gotify.Url == "" || config.Gotify.Token == "" {
+		return nil, false
+	}
+	return GotifyNotifier{config: config.Gotify}, true
+}
+
+func (n GotifyNotifier) Name() string {
+	return "gotify"
+}
+
+func (n GotifyNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+func (n GotifyNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	content, err := json.Marshal(NewGotifyMessage(n.config, result))
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(n.config.Url, "/") + "/message"
+	return postJson(ctx, url, content, map[string]string{"X-Gotify-Key": n.config.Token})
+}
+
+func NewGotifyMessage(config domain.ConfigAlertGotify, result domain.RunResult) domain.GotifyMessage {
+	priority := gotifyPriority(config.SuccessPriority, GotifyDefaultSuccessPriority)
+	if result.IsError() {
+		priority = gotifyPriority(config.ErrorPriority, GotifyDefaultErrorPriority)
+	}
+
+	message := domain.GotifyMessage{
+		Title:    AlertTitle,
+		Message:  RenderSummary(result),
+		Priority: priority,
+	}
+
+	if config.ClickUrl != "" {
+		message.Extras = map[string]interface{}{
+			"client::notification": map[string]interface{}{
+				"click": map[string]string{"url": config.ClickUrl},
+			},
+		}
+	}
+	return message
+}
+
+func gotifyPriority(value *int, fallback int) int {
+	if value == nil {
+		return fallback
+	}
+	return *value
+}
@@ -0,0 +1,71 @@
+package alerts_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestGotifyNotify(t *testing.T) {
+	priority := 10
+
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "error",
+			factory: alerts.NewGotifyNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Gotify: domain.ConfigAlertGotify{
+					Url:           url,
+					Token:         "app-token",
+					ErrorPriority: &priority,
+					ClickUrl:      "https://grafana.example.com",
+				}}
+			},
+			result: newRunResult(false),
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 1 || requests[0].Header.Get("X-Gotify-Key") != "app-token" || requests[0].Path != "/message" {
+					t.Fatalf("unexpected requests %+v", requests)
+				}
+
+				var message map[string]interface{}
+				requests[0].Json(t, &message)
+				if message["priority"] != float64(10) || !strings.Contains(message["message"].(string), "Server: nas01") {
+					t.Errorf("unexpected message %+v", message)
+				}
+
+				extras, _ := json.Marshal(message["extras"])
+				if !strings.Contains(string(extras), `"click":{"url":"https://grafana.example.com"}`) {
+					t.Errorf("expected the click url but got %v", string(extras))
+				}
+			},
+		},
+		{
+			name:    "unauthorized",
+			factory: alerts.NewGotifyNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Gotify: domain.ConfigAlertGotify{Url: url, Token: "wrong"}}
+			},
+			result:  newRunResult(true),
+			respond: func(r *http.Request) (int, string) { return http.StatusUnauthorized, `{"error":"Unauthorized"}` },
+			err:     "Unauthorized",
+		},
+	})
+}
+
+func TestGotifyPriority(t *testing.T) {
+	message := alerts.NewGotifyMessage(domain.ConfigAlertGotify{}, newRunResult(true))
+	if message.Priority != alerts.GotifyDefaultSuccessPriority {
+		t.Errorf("expected the default priority but got %v", message.Priority)
+	}
+
+	// Zero is a priority gotify uses to keep the message silent
+	zero := 0
+	message = alerts.NewGotifyMessage(domain.ConfigAlertGotify{SuccessPriority: &zero}, newRunResult(true))
+	if message.Priority != 0 {
+		t.Errorf("expected priority 0 but got %v", message.Priority)
+	}
+}
@@ -0,0 +1,188 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// How much of an error response is kept in the error.
+	maxErrorBody = 512
+
+	// How much of a response is read, alert responses are small.
+	maxResponseBody = 1 << 20
+
+	// How long to wait after a 429 that does not say.
+	defaultRetryAfter = time.Second
+)
+
+// Posts the json body to the url and returns an error for anything but a 2xx response.
+func postJson(ctx context.Context, url string, body []byte, headers map[string]string) error {
+	all := map[string]string{"Content-Type": "application/json"}
+	for key, value := range headers {
+		all[key] = value
+	}
+	return sendRequest(ctx, http.MethodPost, url, body, all)
+}
+
+// Sends the body to the url and returns an error for anything but a 2xx response.
+func sendRequest(ctx context.Context, method string, url string, body []byte, headers map[string]string) error {
+	_, err := request(ctx, method, url, body, headers)
+	return err
+}
+
+// Sends the body to the url and returns the response body.
+func request(ctx context.Context, method string, url string, body []byte, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	err = checkResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+}
+
+// A file that is sent as part of a multipart form.
+type formFile struct {
+	Field   string
+	Name    string
+	Content []byte
+}
+
+// Posts the fields and file as a multipart form.
+func postMultipart(ctx context.Context, url string, fields map[string]string, file formFile) error {
+	body, contentType, err := newMultipart(fields, file)
+	if err != nil {
+		return err
+	}
+	return sendRequest(ctx, http.MethodPost, url, body, map[string]string{"Content-Type": contentType})
+}
+
+// Builds a multipart form and returns it with its content type.
+func newMultipart(fields map[string]string, file formFile) ([]byte, string, error) {
+	var buffer bytes.Buffer
+	writer := multipart.NewWriter(&buffer)
+
+	// Sorted so the request is the same every time
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err := writer.WriteField(key, fields[key])
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	part, err := writer.CreateFormFile(file.Field, file.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	_, err = part.Write(file.Content)
+	if err != nil {
+		return nil, "", err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, "", err
+	}
+	return buffer.Bytes(), writer.FormDataContentType(), nil
+}
+
+// Sends the body like sendRequest, but waits and tries again when the server answers 429.
+// It waits as long as the server asks, up to the deadline of the context.
+func sendRateLimited(ctx context.Context, method string, url string, body []byte, headers map[string]string, retries int) error {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= retries {
+			err = checkResponse(resp)
+			resp.Body.Close()
+			return err
+		}
+
+		wait := retryAfter(resp)
+		resp.Body.Close()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("rate limited for %v: %v", wait, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// Reads how long a 429 asks to wait from Retry-After, in seconds or as a date.
+// Discord also sends retry_after in the body, which is used when the header is missing.
+func retryAfter(resp *http.Response) time.Duration {
+	value := resp.Header.Get("Retry-After")
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(at); wait > 0 {
+			return wait
+		}
+		return 0
+	}
+
+	var content struct {
+		RetryAfter float64 `json:"retry_after"`
+	}
+	err := json.NewDecoder(io.LimitReader(resp.Body, maxErrorBody)).Decode(&content)
+	if err == nil && content.RetryAfter > 0 {
+		return time.Duration(content.RetryAfter * float64(time.Second))
+	}
+	return defaultRetryAfter
+}
+
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	content, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	message := strings.TrimSpace(string(content))
+	if message == "" {
+		return fmt.Errorf("unexpected response %v", resp.Status)
+	}
+	return fmt.Errorf("unexpected response %v: %v", resp.Status, message)
+}
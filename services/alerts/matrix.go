@@ -0,0 +1,163 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	// Matrix events can be 64KiB, this leaves room for the rest of the event.
+	MatrixMaxBody = 32 * 1024
+
+	ErrMatrixUpload = "the homeserver did not return a content uri"
+)
+
+// Makes every transaction id unique within this process.
+var matrixTxn uint64
+
+func init() {
+	Register("matrix", NewMatrixNotifier)
+}
+
+// Sends the result of a run to a matrix room.
+type MatrixNotifier struct {
+	config domain.ConfigAlertMatrix
+}
+
+func NewMatrixNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if config.Matrix.Homeserver == "" || config.Matrix.AccessToken == "" || config.Matrix.RoomId == "" {
+		return nil, false
+	}
+	return MatrixNotifier{config: config.Matrix}, true
+}
+
+func (n MatrixNotifier) Name() string {
+	return "matrix"
+}
+
+func (n MatrixNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+// Sends the summary and log as one message, the log is uploaded as a file when it does not fit.
+func (n MatrixNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	lines := RenderRecords(result.Records, domain.LogLevelInfo)
+
+	message := NewMatrixMessage(result, lines)
+	if len(message.Body)+len(message.FormattedBody) <= MatrixMaxBody {
+		return n.send(ctx, message)
+	}
+
+	uri, err := n.upload(ctx, result)
+	if err != nil {
+		return err
+	}
+
+	err = n.send(ctx, NewMatrixMessage(result, []string{"The log is attached."}))
+	if err != nil {
+		return err
+	}
+
+	content := logger.FormatRecords(result.Records)
+	return n.send(ctx, domain.MatrixMessage{
+		MsgType: "m.file",
+		Body:    LogFileName(result),
+		Url:     uri,
+		Info:    &domain.MatrixFileInfo{MimeType: "text/plain", Size: len(content)},
+	})
+}
+
+// Builds a text message with a plain body and the same message as html.
+func NewMatrixMessage(result domain.RunResult, lines []string) domain.MatrixMessage {
+	status := "✅"
+	color := DiscordSuccessColor
+	if result.IsError() {
+		status = "❌"
+		color = DiscordErrorColor
+	}
+
+	plain := []string{
+		fmt.Sprintf("%v %v", status, AlertTitle),
+		fmt.Sprintf("Server: %v", resultHost(result)),
+		fmt.Sprintf("Container: %v", result.Container),
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<h4><font data-mx-color="#%06x">%v %v</font></h4>`, color, status, html.EscapeString(AlertTitle))
+	fmt.Fprintf(&b, "<b>Server:</b> %v<br><b>Container:</b> %v", html.EscapeString(resultHost(result)), html.EscapeString(result.Container))
+
+	if len(lines) >= 1 {
+		plain = append(plain, "")
+		plain = append(plain, lines...)
+
+		escaped := make([]string, len(lines))
+		for i, line := range lines {
+			escaped[i] = html.EscapeString(line)
+		}
+		b.WriteString("<br><br>")
+		b.WriteString(strings.Join(escaped, "<br>"))
+	}
+
+	return domain.MatrixMessage{
+		MsgType:       "m.text",
+		Body:          strings.Join(plain, "\n"),
+		Format:        "org.matrix.custom.html",
+		FormattedBody: b.String(),
+	}
+}
+
+func (n MatrixNotifier) send(ctx context.Context, message domain.MatrixMessage) error {
+	content, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	txn := fmt.Sprintf("dvb.%v.%v", time.Now().UnixNano(), atomic.AddUint64(&matrixTxn, 1))
+	endpoint := fmt.Sprintf("%v/_matrix/client/v3/rooms/%v/send/m.room.message/%v", n.homeserver(), url.PathEscape(n.config.RoomId), txn)
+
+	return sendRequest(ctx, http.MethodPut, endpoint, content, n.headers("application/json"))
+}
+
+// Uploads the log to the media repository and returns its mxc uri.
+func (n MatrixNotifier) upload(ctx context.Context, result domain.RunResult) (string, error) {
+	endpoint := fmt.Sprintf("%v/_matrix/media/v3/upload?filename=%v", n.homeserver(), url.QueryEscape(LogFileName(result)))
+
+	body, err := request(ctx, http.MethodPost, endpoint, logger.FormatRecords(result.Records), n.headers("text/plain"))
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		ContentUri string `json:"content_uri"`
+	}
+	err = json.Unmarshal(body, &resp)
+	if err != nil {
+		return "", err
+	}
+	if resp.ContentUri == "" {
+		return "", errors.New(ErrMatrixUpload)
+	}
+	return resp.ContentUri, nil
+}
+
+func (n MatrixNotifier) headers(contentType string) map[string]string {
+	return map[string]string{
+		"Authorization": "Bearer " + n.config.AccessToken,
+		"Content-Type":  contentType,
+	}
+}
+
+func (n MatrixNotifier) homeserver() string {
+	return strings.TrimSuffix(n.config.Homeserver, "/")
+}
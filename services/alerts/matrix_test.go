@@ -0,0 +1,110 @@
+package alerts_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+// Answers like a homeserver that only knows the syt_token access token.
+func respondMatrix(r *http.Request) (int, string) {
+	if r.Header.Get("Authorization") != "Bearer syt_token" {
+		return http.StatusUnauthorized, `{"errcode":"M_UNKNOWN_TOKEN"}`
+	}
+	if strings.HasPrefix(r.URL.Path, "/_matrix/media/v3/upload") {
+		return http.StatusOK, `{"content_uri":"mxc://example.com/abc"}`
+	}
+	return http.StatusOK, `{"event_id":"$1"}`
+}
+
+// Splits the requests into the room messages and the number of uploads.
+func matrixMessages(t *testing.T, requests []capturedRequest) ([]domain.MatrixMessage, int) {
+	var (
+		messages []domain.MatrixMessage
+		uploads  int
+	)
+
+	for _, request := range requests {
+		if strings.HasPrefix(request.Path, "/_matrix/media/v3/upload") {
+			uploads++
+			continue
+		}
+
+		if request.Method != http.MethodPut || !strings.HasPrefix(request.Path, "/_matrix/client/v3/rooms/%21room:example.com/send/m.room.message/") {
+			t.Errorf("unexpected request %v %v", request.Method, request.Path)
+		}
+
+		var message domain.MatrixMessage
+		request.Json(t, &message)
+		messages = append(messages, message)
+	}
+	return messages, uploads
+}
+
+func TestMatrixNotify(t *testing.T) {
+	escaped := newRunResult(false)
+	escaped.Records = append(escaped.Records, domain.LogRecord{Level: domain.LogLevelWarn, Message: "<script>"})
+
+	longLog := newRunResult(true)
+	for i := 0; i < 1000; i++ {
+		longLog.Records = append(longLog.Records, domain.LogRecord{Level: domain.LogLevelInfo, Message: "Copying a large volume"})
+	}
+
+	config := func(token string, slash string) func(url string) domain.ConfigAlert {
+		return func(url string) domain.ConfigAlert {
+			return domain.ConfigAlert{Matrix: domain.ConfigAlertMatrix{Homeserver: url + slash, AccessToken: token, RoomId: "!room:example.com"}}
+		}
+	}
+
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "html",
+			factory: alerts.NewMatrixNotifier,
+			config:  config("syt_token", ""),
+			result:  escaped,
+			respond: respondMatrix,
+			check: func(t *testing.T, requests []capturedRequest) {
+				messages, uploads := matrixMessages(t, requests)
+				if len(messages) != 1 || uploads != 0 {
+					t.Fatalf("expected a single message but got %+v", messages)
+				}
+				if messages[0].Format != "org.matrix.custom.html" || !strings.Contains(messages[0].FormattedBody, `data-mx-color="#ff0000"`) {
+					t.Errorf("unexpected message %+v", messages[0])
+				}
+				if !strings.Contains(messages[0].FormattedBody, "Warning: &lt;script&gt;") || !strings.Contains(messages[0].Body, "Warning: <script>") {
+					t.Errorf("expected the html body to be escaped but got %q", messages[0].FormattedBody)
+				}
+			},
+		},
+		{
+			name:    "long log",
+			factory: alerts.NewMatrixNotifier,
+			config:  config("syt_token", "/"),
+			result:  longLog,
+			respond: respondMatrix,
+			check: func(t *testing.T, requests []capturedRequest) {
+				messages, uploads := matrixMessages(t, requests)
+				if uploads != 1 || len(messages) != 2 {
+					t.Fatalf("expected the log to be uploaded but got %v uploads and %+v", uploads, messages)
+				}
+				if !strings.Contains(messages[0].Body, "The log is attached.") || strings.Contains(messages[0].Body, "Copying") {
+					t.Errorf("expected the summary without the log but got %q", messages[0].Body)
+				}
+				if messages[1].MsgType != "m.file" || messages[1].Url != "mxc://example.com/abc" || messages[1].Body != "webdav-5f1c0a9e2b7d.log" {
+					t.Errorf("unexpected file message %+v", messages[1])
+				}
+			},
+		},
+		{
+			name:    "unknown token",
+			factory: alerts.NewMatrixNotifier,
+			config:  config("wrong", ""),
+			result:  newRunResult(true),
+			respond: respondMatrix,
+			err:     "M_UNKNOWN_TOKEN",
+		},
+	})
+}
@@ -0,0 +1,242 @@
+package alerts
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	// How long each attempt to send an alert can take when Alert.Timeout is not set.
+	DefaultNotifyTimeout = 30 * time.Second
+
+	ErrNotifyTimeout = "the alert was not sent in time"
+)
+
+// Creates the notifier from the alert config.
+// Returns false when the channel has not been configured.
+type NotifierFactory func(config domain.ConfigAlert) (domain.Notifier, bool)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]NotifierFactory)
+)
+
+// Adds a channel that alerts can be sent to, the key is the name of the channel in the config.
+// Each channel registers itself when the package loads.
+func Register(key string, factory NotifierFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[key] = factory
+}
+
+// Removes the channel, tests use it to clean up the channels they register.
+func Unregister(key string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, key)
+}
+
+// Returns a notifier for every channel that is configured, sorted by key.
+func Notifiers(config domain.ConfigAlert) []domain.Notifier {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	keys := make([]string, 0, len(registry))
+	for key := range registry {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var notifiers []domain.Notifier
+	for _, key := range keys {
+		notifier, ok := registry[key](config)
+		if ok {
+			notifiers = append(notifiers, notifier)
+		}
+	}
+	return notifiers
+}
+
+// A notifier that only wants some results, every notifier dvb ships with is one.
+type RoutedNotifier interface {
+	domain.Notifier
+	Route() domain.ConfigAlertRoute
+}
+
+// Returns the notifiers that want the result.
+// SendOnlyOnError drops everything that is not an error, MinLevel and Containers are checked for each notifier.
+func Route(config domain.ConfigAlert, notifiers []domain.Notifier, result domain.RunResult) []domain.Notifier {
+	if config.SendOnlyOnError && result.Level() < domain.AlertLevelError {
+		return nil
+	}
+
+	var routed []domain.Notifier
+	for _, notifier := range notifiers {
+		if r, ok := notifier.(RoutedNotifier); ok && !r.Route().Accepts(result) {
+			continue
+		}
+		routed = append(routed, notifier)
+	}
+	return routed
+}
+
+type DispatchParams struct {
+	Notifiers []domain.Notifier
+
+	// How long each attempt can take, defaults to DefaultNotifyTimeout.
+	Timeout time.Duration
+	Retry   domain.ConfigRetryPolicy
+
+	// Defaults to logger.Default.
+	Logger *logger.Logger
+}
+
+// Sends the result to every notifier at the same time and waits for all of them.
+// Returns how each notifier did, in the same order as params.Notifiers.
+func Dispatch(ctx context.Context, params DispatchParams, result domain.RunResult) []domain.AlertOutcome {
+	log := params.Logger
+	if log == nil {
+		log = logger.Default()
+	}
+
+	outcomes := make([]domain.AlertOutcome, len(params.Notifiers))
+	var wg sync.WaitGroup
+	for i, notifier := range params.Notifiers {
+		wg.Add(1)
+		go func(i int, notifier domain.Notifier) {
+			defer wg.Done()
+			outcomes[i] = notify(ctx, params, log, notifier, result)
+		}(i, notifier)
+	}
+	wg.Wait()
+
+	return outcomes
+}
+
+func notify(ctx context.Context, params DispatchParams, log *logger.Logger, notifier domain.Notifier, result domain.RunResult) domain.AlertOutcome {
+	outcome := domain.AlertOutcome{
+		Channel: notifier.Name(),
+	}
+
+	// Each retry only goes to the targets the earlier attempts could not reach
+	ctx = withDelivered(ctx)
+
+	log.Debug("Sending the alert", "channel", notifier.Name())
+	attempts, err := common.Retry(ctx, common.RetryParams{
+		Name:   fmt.Sprintf("%v alert", notifier.Name()),
+		Policy: params.Retry,
+		Logger: log,
+	}, func() error {
+		return notifyWithTimeout(ctx, params.Timeout, notifier, result)
+	})
+	outcome.Attempts = attempts
+	if err != nil {
+		log.Error("Unable to send the alert", "channel", notifier.Name(), logger.KeyError, err)
+		outcome.Error = err.Error()
+		return outcome
+	}
+
+	log.Debug("The alert was sent", "channel", notifier.Name())
+	return outcome
+}
+
+// Gives up on the notifier once the timeout passes, even when it does not watch the context.
+func notifyWithTimeout(ctx context.Context, timeout time.Duration, notifier domain.Notifier, result domain.RunResult) error {
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- notifier.Notify(ctx, result)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%v: %v", ErrNotifyTimeout, ctx.Err())
+	}
+}
+
+// The targets of one notifier that a single result has been sent to.
+type deliveredTargets struct {
+	mu      sync.Mutex
+	targets map[string]bool
+}
+
+func (d *deliveredTargets) has(target string) bool {
+	if d == nil {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.targets[target]
+}
+
+func (d *deliveredTargets) add(target string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.targets == nil {
+		d.targets = make(map[string]bool)
+	}
+	d.targets[target] = true
+}
+
+type deliveredKey struct{}
+
+// Returns a context that remembers which targets the result was sent to across retries.
+func withDelivered(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deliveredKey{}, &deliveredTargets{})
+}
+
+// Returns nil when Notify is called outside of Dispatch, nothing is skipped then.
+func deliveredFrom(ctx context.Context) *deliveredTargets {
+	delivered, _ := ctx.Value(deliveredKey{}).(*deliveredTargets)
+	return delivered
+}
+
+// Sends to every target on its own, a target that fails does not stop the others.
+// Targets an earlier attempt of the same alert reached are skipped.
+// The label names a target in the error and must not leak secrets like tokens.
+func sendEach(ctx context.Context, kind string, targets []string, label func(i int, target string) string, send func(target string) error) error {
+	delivered := deliveredFrom(ctx)
+
+	var failed []string
+	for i, target := range targets {
+		if delivered.has(target) {
+			continue
+		}
+
+		err := send(target)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%v: %v", label(i, target), err))
+			continue
+		}
+		delivered.add(target)
+	}
+
+	if len(failed) >= 1 {
+		return fmt.Errorf("%v of %v %v failed: %v", len(failed), len(targets), kind, strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// Names a webhook by its position, the url holds the secret.
+func webhookLabel(i int, target string) string {
+	return fmt.Sprintf("webhook #%v", i+1)
+}
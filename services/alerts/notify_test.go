@@ -0,0 +1,190 @@
+package alerts_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+type fakeNotifier struct {
+	name  string
+	err   error
+	wait  time.Duration
+	calls int32
+}
+
+func (n *fakeNotifier) Name() string {
+	return n.name
+}
+
+func (n *fakeNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	atomic.AddInt32(&n.calls, 1)
+	if n.wait > 0 {
+		time.Sleep(n.wait)
+	}
+	return n.err
+}
+
+func TestDispatch(t *testing.T) {
+	ok := &fakeNotifier{name: "ok"}
+	broken := &fakeNotifier{name: "broken", err: errors.New("connection refused")}
+	slow := &fakeNotifier{name: "slow", wait: time.Second}
+
+	started := time.Now()
+	outcomes := alerts.Dispatch(context.Background(), alerts.DispatchParams{
+		Notifiers: []domain.Notifier{ok, broken, slow},
+		Timeout:   50 * time.Millisecond,
+		Retry:     domain.ConfigRetryPolicy{Attempts: 2, Delay: domain.Duration(time.Millisecond)},
+	}, domain.RunResult{})
+
+	if time.Since(started) >= time.Second {
+		t.Error("expected the slow notifier to time out")
+	}
+
+	if len(outcomes) != 3 {
+		t.Fatalf("expected 3 outcomes but got %+v", outcomes)
+	}
+
+	if outcomes[0].Channel != "ok" || outcomes[0].Error != "" || outcomes[0].Attempts != 1 {
+		t.Errorf("unexpected outcome %+v", outcomes[0])
+	}
+
+	if outcomes[1].Error != "connection refused" || outcomes[1].Attempts != 2 || atomic.LoadInt32(&broken.calls) != 2 {
+		t.Errorf("expected the broken notifier to be retried but got %+v", outcomes[1])
+	}
+
+	if outcomes[2].Error == "" {
+		t.Errorf("expected the slow notifier to fail but got %+v", outcomes[2])
+	}
+}
+
+func TestDispatchRetriesOnlyFailedTargets(t *testing.T) {
+	var failed int32
+	server := newCaptureServer(t, func(r *http.Request) (int, string) {
+		if r.URL.Path == "/hooks/a" && atomic.AddInt32(&failed, 1) == 1 {
+			return http.StatusInternalServerError, "try again"
+		}
+		return http.StatusOK, "ok"
+	})
+	hits := func() map[string]int {
+		counts := make(map[string]int)
+		for _, request := range server.Requests() {
+			counts[request.Path]++
+		}
+		return counts
+	}
+
+	slack, _ := alerts.NewSlackNotifier(domain.ConfigAlert{
+		Slack: domain.ConfigAlertSlack{Webhooks: []string{server.URL + "/hooks/a", server.URL + "/hooks/b"}},
+	})
+	params := alerts.DispatchParams{
+		Notifiers: []domain.Notifier{slack},
+		Retry:     domain.ConfigRetryPolicy{Attempts: 3, Delay: domain.Duration(time.Millisecond)},
+	}
+
+	outcomes := alerts.Dispatch(context.Background(), params, newRunResult(false))
+	if outcomes[0].Error != "" || outcomes[0].Attempts != 2 {
+		t.Fatalf("expected the alert to be sent on the second attempt but got %+v", outcomes[0])
+	}
+
+	// The webhook that worked the first time is not sent the alert again
+	if counts := hits(); counts["/hooks/a"] != 2 || counts["/hooks/b"] != 1 {
+		t.Errorf("unexpected webhook calls %v", counts)
+	}
+
+	// The next result goes to every webhook again
+	alerts.Dispatch(context.Background(), params, newRunResult(true))
+	if counts := hits(); counts["/hooks/a"] != 3 || counts["/hooks/b"] != 2 {
+		t.Errorf("expected the next result to reach every webhook but got %v", counts)
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	enabled := false
+	alerts.Register("test", func(config domain.ConfigAlert) (domain.Notifier, bool) {
+		return &fakeNotifier{name: "test"}, enabled
+	})
+	t.Cleanup(func() { alerts.Unregister("test") })
+
+	notifiers := alerts.Notifiers(domain.ConfigAlert{
+		Discord: domain.ConfigAlertDiscord{Webhooks: []string{"https://discord.com/api/webhooks/1/a"}},
+	})
+	if len(notifiers) != 1 || notifiers[0].Name() != "discord" {
+		t.Fatalf("expected only discord to be configured but got %+v", notifiers)
+	}
+
+	enabled = true
+	notifiers = alerts.Notifiers(domain.ConfigAlert{})
+	if len(notifiers) != 1 || notifiers[0].Name() != "test" {
+		t.Errorf("expected the registered notifier but got %+v", notifiers)
+	}
+
+	alerts.Unregister("test")
+	notifiers = alerts.Notifiers(domain.ConfigAlert{})
+	if len(notifiers) != 0 {
+		t.Errorf("expected the notifier to be removed but got %+v", notifiers)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	config := domain.ConfigAlert{
+		Discord: domain.ConfigAlertDiscord{Webhooks: []string{"https://discord.com/api/webhooks/1/a"}},
+		Email: domain.ConfigAlertEmail{
+			Account:          domain.ConfigAlertEmailAccount{Username: "dvb", Password: "secret", Host: "smtp.example.com"},
+			To:               domain.StringList{"admin@example.com"},
+			ConfigAlertRoute: domain.ConfigAlertRoute{MinLevel: "error"},
+		},
+		Ntfy: domain.ConfigAlertNtfy{
+			Url:              "https://ntfy.sh",
+			Topic:            "dvb",
+			ConfigAlertRoute: domain.ConfigAlertRoute{MinLevel: "warning", Containers: domain.StringList{"app-db"}},
+		},
+	}
+	notifiers := append(alerts.Notifiers(config), &fakeNotifier{name: "fake"})
+
+	success := domain.RunResult{RunRecord: domain.RunRecord{Job: "webdav", Container: "webdav", Success: true}}
+	warning := success
+	warning.Records = []domain.LogRecord{{Level: domain.LogLevelWarn, Message: "transfer attempt 1/3 failed"}}
+	failed := domain.RunResult{RunRecord: domain.RunRecord{Job: "webdav", Container: "webdav"}}
+	daemon := domain.RunResult{}
+
+	onlyErrors := config
+	onlyErrors.SendOnlyOnError = true
+
+	cases := []struct {
+		name     string
+		config   domain.ConfigAlert
+		result   domain.RunResult
+		expected []string
+	}{
+		{"success", config, success, []string{"discord", "fake"}},
+		{"warning for another container", config, warning, []string{"discord", "fake"}},
+		{"error", config, failed, []string{"discord", "email", "fake"}},
+		{"daemon error", config, daemon, []string{"discord", "email", "ntfy", "fake"}},
+		{"only errors with a warning", onlyErrors, warning, nil},
+	}
+
+	for _, c := range cases {
+		var names []string
+		for _, notifier := range alerts.Route(c.config, notifiers, c.result) {
+			names = append(names, notifier.Name())
+		}
+		if strings.Join(names, ",") != strings.Join(c.expected, ",") {
+			t.Errorf("%v: expected %v but got %v", c.name, c.expected, names)
+		}
+	}
+
+	warning.Container = "app-db"
+	warning.Job = "app-db"
+	routed := alerts.Route(config, notifiers, warning)
+	if len(routed) != 3 || routed[1].Name() != "ntfy" {
+		t.Errorf("expected ntfy to get the warning for app-db but got %+v", routed)
+	}
+}
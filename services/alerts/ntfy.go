@@ -0,0 +1,82 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	NtfyDefaultSuccessPriority = 3
+	NtfyDefaultErrorPriority   = 5
+
+	// Shown as emoji by the ntfy apps.
+	ntfySuccessTag = "white_check_mark"
+	ntfyErrorTag   = "x"
+)
+
+func init() {
+	Register("ntfy", NewNtfyNotifier)
+}
+
+// Publishes the result of a run to a ntfy topic.
+type NtfyNotifier struct {
+	config domain.ConfigAlertNtfy
+}
+
+func NewNtfyNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if config.Ntfy.Url == "" || config.Ntfy.Topic == "" {
+		return nil, false
+	}
+	return NtfyNotifier{config: config.Ntfy}, true
+}
+
+func (n NtfyNotifier) Name() string {
+	return "ntfy"
+}
+
+func (n NtfyNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+func (n NtfyNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	content, err := json.Marshal(NewNtfyMessage(n.config, result))
+	if err != nil {
+		return err
+	}
+
+	var headers map[string]string
+	if n.config.Token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + n.config.Token}
+	}
+
+	// Json messages are published to the root of the server, the topic is in the body
+	return postJson(ctx, strings.TrimSuffix(n.config.Url, "/"), content, headers)
+}
+
+func NewNtfyMessage(config domain.ConfigAlertNtfy, result domain.RunResult) domain.NtfyMessage {
+	priority := orDefault(config.SuccessPriority, NtfyDefaultSuccessPriority)
+	tag := ntfySuccessTag
+	if result.IsError() {
+		priority = orDefault(config.ErrorPriority, NtfyDefaultErrorPriority)
+		tag = ntfyErrorTag
+	}
+
+	return domain.NtfyMessage{
+		Topic:    config.Topic,
+		Title:    AlertTitle,
+		Message:  RenderSummary(result),
+		Priority: priority,
+		Tags:     append([]string{tag}, config.Tags...),
+		Click:    config.ClickUrl,
+	}
+}
+
+func orDefault(value int, fallback int) int {
+	if value <= 0 {
+		return fallback
+	}
+	return value
+}
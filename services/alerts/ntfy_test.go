@@ -0,0 +1,54 @@
+package alerts_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestNtfyNotify(t *testing.T) {
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "error",
+			factory: alerts.NewNtfyNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Ntfy: domain.ConfigAlertNtfy{
+					Url:      url + "/",
+					Topic:    "backups",
+					Token:    "tk_secret",
+					Tags:     []string{"dvb"},
+					ClickUrl: "https://grafana.example.com",
+				}}
+			},
+			result: newRunResult(false),
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 1 || requests[0].Header.Get("Authorization") != "Bearer tk_secret" || requests[0].Path != "/" {
+					t.Fatalf("unexpected requests %+v", requests)
+				}
+
+				var message domain.NtfyMessage
+				requests[0].Json(t, &message)
+				if message.Topic != "backups" || message.Priority != alerts.NtfyDefaultErrorPriority || message.Click != "https://grafana.example.com" {
+					t.Errorf("unexpected message %+v", message)
+				}
+				if len(message.Tags) != 2 || message.Tags[0] != "x" || message.Tags[1] != "dvb" {
+					t.Errorf("unexpected tags %v", message.Tags)
+				}
+				if !strings.Contains(message.Message, "Container: webdav") || !strings.Contains(message.Message, "Error: The backup could not be moved") {
+					t.Errorf("expected the run summary but got %q", message.Message)
+				}
+			},
+		},
+	})
+}
+
+func TestNtfyPriority(t *testing.T) {
+	config := domain.ConfigAlertNtfy{Topic: "backups", SuccessPriority: 2}
+
+	message := alerts.NewNtfyMessage(config, newRunResult(true))
+	if message.Priority != 2 || message.Tags[0] != "white_check_mark" || message.Click != "" {
+		t.Errorf("unexpected message %+v", message)
+	}
+}
@@ -0,0 +1,97 @@
+package alerts
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+// These are already shown by the alert itself, so they are left out of each line.
+var hiddenFields = map[string]bool{
+	logger.KeyJob:       true,
+	logger.KeyContainer: true,
+	logger.KeyRun:       true,
+}
+
+// Turns the records of a run into readable lines for an alert.
+// Records below the level are left out, warnings and errors are called out.
+func RenderRecords(records []domain.LogRecord, level domain.LogLevel) []string {
+	var lines []string
+
+	for _, record := range records {
+		if record.Level < level {
+			continue
+		}
+
+		var b strings.Builder
+		switch record.Level {
+		case domain.LogLevelWarn:
+			b.WriteString("Warning: ")
+		case domain.LogLevelError:
+			b.WriteString("Error: ")
+		}
+		b.WriteString(record.Message)
+
+		var extra []string
+		for _, field := range record.Fields {
+			if hiddenFields[field.Key] || field.Value == "" {
+				continue
+			}
+			extra = append(extra, field.Key+"="+field.Value)
+		}
+		if len(extra) >= 1 {
+			b.WriteString(" (")
+			b.WriteString(strings.Join(extra, ", "))
+			b.WriteString(")")
+		}
+
+		lines = append(lines, b.String())
+	}
+
+	return lines
+}
+
+// The title every alert uses.
+const AlertTitle = "Backup Results"
+
+// Returns the server the run was on, falling back to this host.
+func resultHost(result domain.RunResult) string {
+	if result.Host != "" {
+		return result.Host
+	}
+
+	host, _ := os.Hostname()
+	return host
+}
+
+// Renders the same summary the discord embed shows as plain text, for channels without fields.
+func RenderSummary(result domain.RunResult) string {
+	lines := []string{
+		fmt.Sprintf("Server: %v", resultHost(result)),
+		fmt.Sprintf("Container: %v", result.Container),
+		"",
+	}
+	lines = append(lines, RenderRecords(result.Records, domain.LogLevelInfo)...)
+	return strings.Join(lines, "\n")
+}
+
+// The name of the log file that is attached when the log is too long for a message.
+func LogFileName(result domain.RunResult) string {
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '-'
+	}, result.Container)
+	if name == "" {
+		name = "dvb"
+	}
+	if result.Id != "" {
+		return fmt.Sprintf("%v-%v.log", name, result.Id)
+	}
+	return fmt.Sprintf("%v.log", name)
+}
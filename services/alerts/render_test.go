@@ -0,0 +1,33 @@
+package alerts_test
+
+import (
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestRenderRecords(t *testing.T) {
+	records := []domain.LogRecord{
+		{Level: domain.LogLevelDebug, Message: "Checking for the container"},
+		{Level: domain.LogLevelInfo, Message: "Backup was moved.", Fields: []domain.LogField{{Key: "container", Value: "app-db"}, {Key: "attempts", Value: "quiesce 1, archive 1, transfer 2"}}},
+		{Level: domain.LogLevelWarn, Message: "transfer attempt 1/3 failed", Fields: []domain.LogField{{Key: "error", Value: "nas is offline"}}},
+		{Level: domain.LogLevelError, Message: "The backup failed"},
+	}
+
+	lines := alerts.RenderRecords(records, domain.LogLevelInfo)
+	expected := []string{
+		"Backup was moved. (attempts=quiesce 1, archive 1, transfer 2)",
+		"Warning: transfer attempt 1/3 failed (error=nas is offline)",
+		"Error: The backup failed",
+	}
+
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %v lines but got %v", len(expected), lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("expected '%v' but got '%v'", expected[i], lines[i])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+func init() {
+	Register("slack", NewSlackNotifier)
+}
+
+// Sends the result of a run to Slack or Mattermost incoming webhooks.
+type SlackNotifier struct {
+	config domain.ConfigAlertSlack
+}
+
+func NewSlackNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if len(config.Slack.Webhooks) == 0 {
+		return nil, false
+	}
+	return SlackNotifier{config: config.Slack}, true
+}
+
+func (n SlackNotifier) Name() string {
+	return "slack"
+}
+
+func (n SlackNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+func (n SlackNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	content, err := json.Marshal(NewSlackMessage(n.config, result))
+	if err != nil {
+		return err
+	}
+
+	return sendEach(ctx, "slack webhooks", n.config.Webhooks, webhookLabel, func(url string) error {
+		return postJson(ctx, url, content, nil)
+	})
+}
+
+// Builds the message with the same colours and fields as the discord embed.
+func NewSlackMessage(config domain.ConfigAlertSlack, result domain.RunResult) domain.SlackMessage {
+	color := DiscordSuccessColor
+	status := "succeeded"
+	if result.IsError() {
+		color = DiscordErrorColor
+		status = "failed"
+	}
+
+	return domain.SlackMessage{
+		Username:  config.Username,
+		Channel:   config.Channel,
+		IconEmoji: config.IconEmoji,
+		Attachments: []domain.SlackAttachment{
+			{
+				Fallback: fmt.Sprintf("The backup of %v %v", result.Container, status),
+				Color:    fmt.Sprintf("#%06x", color),
+				Title:    AlertTitle,
+				Text:     strings.Join(RenderRecords(result.Records, domain.LogLevelInfo), "\n"),
+				Fields: []domain.SlackField{
+					{Title: "Server", Value: resultHost(result), Short: true},
+					{Title: "Container", Value: result.Container, Short: true},
+				},
+				Footer:     result.Id,
+				Timestamp:  result.FinishedAt.Unix(),
+				MarkdownIn: []string{"text"},
+			},
+		},
+	}
+}
@@ -0,0 +1,58 @@
+package alerts_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestSlackNotify(t *testing.T) {
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "every webhook",
+			factory: alerts.NewSlackNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Slack: domain.ConfigAlertSlack{Webhooks: []string{url + "/hooks/a", url + "/hooks/b"}, Username: "dvb"}}
+			},
+			result: newRunResult(false),
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 2 || requests[0].Path != "/hooks/a" || requests[1].Path != "/hooks/b" {
+					t.Fatalf("expected a message for each webhook but got %v", len(requests))
+				}
+
+				var message domain.SlackMessage
+				requests[0].Json(t, &message)
+				attachment := message.Attachments[0]
+				if message.Username != "dvb" || attachment.Color != "#ff0000" {
+					t.Errorf("unexpected message %+v", message)
+				}
+				if len(attachment.Fields) != 2 || attachment.Fields[0].Value != "nas01" || attachment.Fields[1].Value != "webdav" {
+					t.Errorf("expected the server and container fields but got %+v", attachment.Fields)
+				}
+				if !strings.Contains(attachment.Text, "Error: The backup could not be moved") {
+					t.Errorf("expected the logs in the text but got %q", attachment.Text)
+				}
+			},
+		},
+		{
+			name:    "error",
+			factory: alerts.NewSlackNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Slack: domain.ConfigAlertSlack{Webhooks: []string{url}}}
+			},
+			result:  newRunResult(true),
+			respond: func(r *http.Request) (int, string) { return http.StatusForbidden, "invalid_token" },
+			err:     "invalid_token",
+		},
+	})
+}
+
+func TestSlackSuccessColor(t *testing.T) {
+	message := alerts.NewSlackMessage(domain.ConfigAlertSlack{}, newRunResult(true))
+	if message.Attachments[0].Color != "#00ff0a" {
+		t.Errorf("unexpected color %v", message.Attachments[0].Color)
+	}
+}
@@ -0,0 +1,254 @@
+package alerts
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	ErrSmtpStartTls = "the mail server does not support starttls, set Security to none to send without encryption"
+	ErrSmtpNoAuth   = "the mail server does not support a login method dvb knows"
+
+	ErrSmtpPlaintextAuth = "the password would be sent without encryption, use starttls or tls or set AllowPlaintextAuth"
+
+	smtpDialTimeout = 30 * time.Second
+)
+
+// Returns the security the account asks for.
+// Without one, port 465 is tls and every other port is starttls.
+func EmailSecurity(account domain.ConfigAlertEmailAccount) string {
+	if account.Security != "" {
+		return strings.ToLower(account.Security)
+	}
+	if account.Port == 465 {
+		return domain.EmailSecurityTls
+	}
+	return domain.EmailSecurityStartTls
+}
+
+// Checks if the password can be sent to the server without encryption.
+// Only a server on this machine or one the account explicitly allows gets it in the clear.
+func EmailPlaintextAuthAllowed(account domain.ConfigAlertEmailAccount) bool {
+	if account.AllowPlaintextAuth || strings.EqualFold(account.Host, "localhost") {
+		return true
+	}
+
+	ip := net.ParseIP(account.Host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func emailPort(account domain.ConfigAlertEmailAccount) int {
+	if account.Port != 0 {
+		return account.Port
+	}
+
+	switch EmailSecurity(account) {
+	case domain.EmailSecurityTls:
+		return 465
+	case domain.EmailSecurityNone:
+		return 25
+	}
+	return 587
+}
+
+// Builds a tls config that verifies the server with the system CAs and the CaFile.
+func EmailTlsConfig(account domain.ConfigAlertEmailAccount) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName: account.Host,
+		MinVersion: tls.VersionTLS12,
+	}
+	if account.CaFile == "" {
+		return config, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+
+	content, err := os.ReadFile(account.CaFile)
+	if err != nil {
+		return nil, err
+	}
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("%v does not have a pem certificate", account.CaFile)
+	}
+
+	config.RootCAs = pool
+	return config, nil
+}
+
+// Sends the message over smtp, the connection is closed once the context is done.
+func sendMail(ctx context.Context, account domain.ConfigAlertEmailAccount, from string, to []string, msg io.WriterTo) error {
+	security := EmailSecurity(account)
+	tlsConfig, err := EmailTlsConfig(account)
+	if err != nil {
+		return err
+	}
+
+	address := net.JoinHostPort(account.Host, strconv.Itoa(emailPort(account)))
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	var conn net.Conn
+	if security == domain.EmailSecurityTls {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return err
+	}
+
+	// net/smtp does not take a context, closing the connection stops it
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	err = deliver(conn, account, security, tlsConfig, from, to, msg)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+func deliver(conn net.Conn, account domain.ConfigAlertEmailAccount, security string, tlsConfig *tls.Config, from string, to []string, msg io.WriterTo) error {
+	client, err := smtp.NewClient(conn, account.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if security == domain.EmailSecurityStartTls {
+		ok, _ := client.Extension("STARTTLS")
+		if !ok {
+			return errors.New(ErrSmtpStartTls)
+		}
+
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	if account.Username != "" {
+		auth, err := smtpAuth(client, account, security == domain.EmailSecurityNone)
+		if err != nil {
+			return err
+		}
+
+		err = client.Auth(auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from)
+	if err != nil {
+		return err
+	}
+	for _, address := range to {
+		err = client.Rcpt(address)
+		if err != nil {
+			return fmt.Errorf("%v: %v", address, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = msg.WriteTo(w)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// Picks the first login method the server supports, plain, login or cram-md5.
+func smtpAuth(client *smtp.Client, account domain.ConfigAlertEmailAccount, unencrypted bool) (smtp.Auth, error) {
+	_, advertised := client.Extension("AUTH")
+	mechanisms := make(map[string]bool)
+	for _, mechanism := range strings.Fields(advertised) {
+		mechanisms[strings.ToUpper(mechanism)] = true
+	}
+
+	var auth smtp.Auth
+	switch {
+	case mechanisms["PLAIN"]:
+		auth = smtp.PlainAuth("", account.Username, account.Password, account.Host)
+	case mechanisms["LOGIN"]:
+		auth = loginAuth{username: account.Username, password: account.Password}
+	case mechanisms["CRAM-MD5"]:
+		auth = smtp.CRAMMD5Auth(account.Username, account.Password)
+	default:
+		return nil, errors.New(ErrSmtpNoAuth)
+	}
+
+	if unencrypted {
+		if !EmailPlaintextAuthAllowed(account) {
+			return nil, errors.New(ErrSmtpPlaintextAuth)
+		}
+		auth = unencryptedAuth{auth}
+	}
+	return auth, nil
+}
+
+// The login method office 365 and some older servers use instead of plain.
+type loginAuth struct {
+	username string
+	password string
+}
+
+func (a loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	return "LOGIN", nil, nil
+}
+
+func (a loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(string(fromServer))) {
+	case "username:":
+		return []byte(a.username), nil
+	case "password:":
+		return []byte(a.password), nil
+	}
+	return nil, fmt.Errorf("unexpected login challenge '%v'", string(fromServer))
+}
+
+// net/smtp refuses to send a password without tls.
+// Security none asks for exactly that, so the check is skipped once EmailPlaintextAuthAllowed agreed.
+type unencryptedAuth struct {
+	smtp.Auth
+}
+
+func (a unencryptedAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	info := *server
+	info.TLS = true
+	return a.Auth.Start(&info)
+}
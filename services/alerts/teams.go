@@ -0,0 +1,95 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	teamsContentType   = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVer    = "1.4"
+
+	// The adaptive card colours that match the discord colours.
+	adaptiveSuccessColor = "Good"
+	adaptiveErrorColor   = "Attention"
+)
+
+func init() {
+	Register("teams", NewTeamsNotifier)
+}
+
+// Sends the result of a run to Microsoft Teams incoming webhooks.
+type TeamsNotifier struct {
+	config domain.ConfigAlertTeams
+}
+
+func NewTeamsNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if len(config.Teams.Webhooks) == 0 {
+		return nil, false
+	}
+	return TeamsNotifier{config: config.Teams}, true
+}
+
+func (n TeamsNotifier) Name() string {
+	return "teams"
+}
+
+func (n TeamsNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+func (n TeamsNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	content, err := json.Marshal(NewTeamsMessage(result))
+	if err != nil {
+		return err
+	}
+
+	return sendEach(ctx, "teams webhooks", n.config.Webhooks, webhookLabel, func(url string) error {
+		return postJson(ctx, url, content, nil)
+	})
+}
+
+// Builds an adaptive card with the same title, colours and fields as the discord embed.
+func NewTeamsMessage(result domain.RunResult) domain.TeamsMessage {
+	color := adaptiveSuccessColor
+	if result.IsError() {
+		color = adaptiveErrorColor
+	}
+
+	body := []domain.AdaptiveElement{
+		{Type: "TextBlock", Text: AlertTitle, Weight: "Bolder", Size: "Medium", Color: color},
+		{Type: "FactSet", Facts: []domain.AdaptiveFact{
+			{Title: "Server", Value: resultHost(result)},
+			{Title: "Container", Value: result.Container},
+		}},
+	}
+
+	// Each line is its own paragraph so teams does not run them together
+	lines := RenderRecords(result.Records, domain.LogLevelInfo)
+	if len(lines) >= 1 {
+		body = append(body, domain.AdaptiveElement{
+			Type: "TextBlock",
+			Text: strings.Join(lines, "\n\n"),
+			Wrap: true,
+		})
+	}
+
+	return domain.TeamsMessage{
+		Type: "message",
+		Attachments: []domain.TeamsAttachment{
+			{
+				ContentType: teamsContentType,
+				Content: domain.AdaptiveCard{
+					Schema:  adaptiveCardSchema,
+					Type:    "AdaptiveCard",
+					Version: adaptiveCardVer,
+					Body:    body,
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,39 @@
+package alerts_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestTeamsNotify(t *testing.T) {
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "adaptive card",
+			factory: alerts.NewTeamsNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Teams: domain.ConfigAlertTeams{Webhooks: []string{url}}}
+			},
+			result:  newRunResult(false),
+			respond: func(r *http.Request) (int, string) { return http.StatusAccepted, "" },
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 1 {
+					t.Fatalf("expected one message but got %v", len(requests))
+				}
+
+				var message domain.TeamsMessage
+				requests[0].Json(t, &message)
+				if len(message.Attachments) != 1 || message.Attachments[0].ContentType != "application/vnd.microsoft.card.adaptive" {
+					t.Fatalf("expected an adaptive card but got %+v", message)
+				}
+
+				body := message.Attachments[0].Content.Body
+				if len(body) != 3 || body[0].Color != "Attention" || body[1].Facts[1].Value != "webdav" {
+					t.Errorf("unexpected card body %+v", body)
+				}
+			},
+		},
+	})
+}
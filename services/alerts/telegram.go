@@ -0,0 +1,132 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	TelegramDefaultApiUrl = "https://api.telegram.org"
+
+	// Telegram rejects longer messages and captions.
+	TelegramMaxMessage = 4096
+	TelegramMaxCaption = 1024
+
+	telegramParseMode = "MarkdownV2"
+)
+
+// Every character that has to be escaped in MarkdownV2 text.
+var telegramReplacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+
+// Escapes the text so telegram shows it as it is.
+func EscapeTelegram(text string) string {
+	return telegramReplacer.Replace(text)
+}
+
+func init() {
+	Register("telegram", NewTelegramNotifier)
+}
+
+// Sends the result of a run to telegram chats with a bot.
+type TelegramNotifier struct {
+	config domain.ConfigAlertTelegram
+}
+
+func NewTelegramNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if config.Telegram.Token == "" || len(config.Telegram.ChatIds) == 0 {
+		return nil, false
+	}
+	return TelegramNotifier{config: config.Telegram}, true
+}
+
+func (n TelegramNotifier) Name() string {
+	return "telegram"
+}
+
+func (n TelegramNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+// Sends the summary and log as one message, the log is sent as a file when it does not fit.
+func (n TelegramNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	header := telegramHeader(result)
+
+	text := header
+	lines := RenderRecords(result.Records, domain.LogLevelInfo)
+	if len(lines) >= 1 {
+		text = header + "\n\n" + EscapeTelegram(strings.Join(lines, "\n"))
+	}
+
+	chatLabel := func(i int, chat string) string { return "chat " + chat }
+	return sendEach(ctx, "telegram chats", n.config.ChatIds, chatLabel, func(chat string) error {
+		var err error
+		if utf8.RuneCountInString(text) <= TelegramMaxMessage {
+			err = n.sendMessage(ctx, chat, text)
+		} else {
+			err = n.sendLog(ctx, chat, header+"\n\n"+EscapeTelegram("The log is attached."), result)
+		}
+		if err != nil {
+			// The token is part of the url, keep it out of the logs
+			return errors.New(strings.ReplaceAll(err.Error(), n.config.Token, "<token>"))
+		}
+		return nil
+	})
+}
+
+func (n TelegramNotifier) sendMessage(ctx context.Context, chat string, text string) error {
+	content, err := json.Marshal(map[string]string{
+		"chat_id":    chat,
+		"text":       text,
+		"parse_mode": telegramParseMode,
+	})
+	if err != nil {
+		return err
+	}
+	return postJson(ctx, n.url("sendMessage"), content, nil)
+}
+
+func (n TelegramNotifier) sendLog(ctx context.Context, chat string, caption string, result domain.RunResult) error {
+	return postMultipart(ctx, n.url("sendDocument"), map[string]string{
+		"chat_id":    chat,
+		"caption":    caption,
+		"parse_mode": telegramParseMode,
+	}, formFile{
+		Field:   "document",
+		Name:    LogFileName(result),
+		Content: logger.FormatRecords(result.Records),
+	})
+}
+
+func (n TelegramNotifier) url(method string) string {
+	base := n.config.ApiUrl
+	if base == "" {
+		base = TelegramDefaultApiUrl
+	}
+	return fmt.Sprintf("%v/bot%v/%v", strings.TrimSuffix(base, "/"), n.config.Token, method)
+}
+
+// The status, server and container, already escaped.
+func telegramHeader(result domain.RunResult) string {
+	status := "✅"
+	if result.IsError() {
+		status = "❌"
+	}
+
+	return fmt.Sprintf("%v *%v*\n*Server:* %v\n*Container:* %v",
+		status,
+		EscapeTelegram(AlertTitle),
+		EscapeTelegram(resultHost(result)),
+		EscapeTelegram(result.Container),
+	)
+}
@@ -0,0 +1,83 @@
+package alerts_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestEscapeTelegram(t *testing.T) {
+	got := alerts.EscapeTelegram("Moved app-db_01.tar (2.0 KiB)!")
+	want := `Moved app\-db\_01\.tar \(2\.0 KiB\)\!`
+	if got != want {
+		t.Errorf("expected %v but got %v", want, got)
+	}
+}
+
+func TestTelegramNotify(t *testing.T) {
+	longLog := newRunResult(true)
+	for i := 0; i < 200; i++ {
+		longLog.Records = append(longLog.Records, domain.LogRecord{Level: domain.LogLevelInfo, Message: "Copying a large volume"})
+	}
+
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "every chat",
+			factory: alerts.NewTelegramNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Telegram: domain.ConfigAlertTelegram{Token: "123:abc", ChatIds: []string{"-1001", "42"}, ApiUrl: url}}
+			},
+			result: newRunResult(false),
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 2 || requests[0].Path != "/bot123:abc/sendMessage" {
+					t.Fatalf("expected a message for each chat but got %+v", requests)
+				}
+
+				var message map[string]string
+				requests[0].Json(t, &message)
+				if message["chat_id"] != "-1001" || message["parse_mode"] != "MarkdownV2" {
+					t.Errorf("unexpected message %+v", message)
+				}
+				if !strings.HasPrefix(message["text"], "❌") || !strings.Contains(message["text"], `Error: The backup could not be moved`) {
+					t.Errorf("unexpected text %q", message["text"])
+				}
+			},
+		},
+		{
+			name:    "long log",
+			factory: alerts.NewTelegramNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Telegram: domain.ConfigAlertTelegram{Token: "123:abc", ChatIds: []string{"42"}, ApiUrl: url}}
+			},
+			result: longLog,
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 1 || requests[0].Path != "/bot123:abc/sendDocument" {
+					t.Fatalf("expected the log as a document but got %+v", requests)
+				}
+
+				caption := requests[0].Form(t).Value["caption"]
+				name, log := requests[0].File(t, "document")
+				if name != "webdav-5f1c0a9e2b7d.log" || strings.Count(log, "Copying a large volume") != 200 {
+					t.Errorf("unexpected log %v", name)
+				}
+				if len(caption) != 1 || !strings.Contains(caption[0], `The log is attached\.`) {
+					t.Errorf("unexpected caption %q", caption)
+				}
+			},
+		},
+	})
+}
+
+func TestTelegramHidesToken(t *testing.T) {
+	notifier, _ := alerts.NewTelegramNotifier(domain.ConfigAlert{
+		Telegram: domain.ConfigAlertTelegram{Token: "123:abc", ChatIds: []string{"42"}, ApiUrl: "http://127.0.0.1:1"},
+	})
+
+	err := notifier.Notify(context.Background(), newRunResult(true))
+	if err == nil || strings.Contains(err.Error(), "123:abc") {
+		t.Errorf("expected an error without the token but got %v", err)
+	}
+}
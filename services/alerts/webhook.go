@@ -0,0 +1,96 @@
+package alerts
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"text/template"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+func init() {
+	Register("webhook", NewWebhookNotifier)
+}
+
+// Functions the body template can use on top of the text/template builtins.
+var webhookFuncs = template.FuncMap{
+	// Writes the value as json, use it to put strings in a json body safely.
+	"json": func(value interface{}) (string, error) {
+		content, err := json.Marshal(value)
+		return string(content), err
+	},
+	// The same summary the push alerts send.
+	"summary": RenderSummary,
+	// The info, warning and error lines of the run.
+	"lines": func(result domain.RunResult) []string {
+		return RenderRecords(result.Records, domain.LogLevelInfo)
+	},
+	"join": strings.Join,
+}
+
+// Parses the body template of the generic webhook.
+func ParseWebhookTemplate(body string) (*template.Template, error) {
+	return template.New("webhook").Funcs(webhookFuncs).Parse(body)
+}
+
+// Sends the result of a run to any http endpoint, the body is built from a template.
+type WebhookNotifier struct {
+	config domain.ConfigAlertWebhook
+}
+
+func NewWebhookNotifier(config domain.ConfigAlert) (domain.Notifier, bool) {
+	if config.Webhook.Url == "" {
+		return nil, false
+	}
+	return WebhookNotifier{config: config.Webhook}, true
+}
+
+func (n WebhookNotifier) Name() string {
+	return "webhook"
+}
+
+func (n WebhookNotifier) Route() domain.ConfigAlertRoute {
+	return n.config.ConfigAlertRoute
+}
+
+func (n WebhookNotifier) Notify(ctx context.Context, result domain.RunResult) error {
+	body, err := RenderWebhookBody(n.config, result)
+	if err != nil {
+		return err
+	}
+
+	method := n.config.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	headers := map[string]string{"Content-Type": "application/json"}
+	for key, value := range n.config.Headers {
+		headers[key] = value
+	}
+
+	return sendRequest(ctx, strings.ToUpper(method), n.config.Url, body, headers)
+}
+
+// Renders the body template with the run result, without a template the result is sent as json.
+func RenderWebhookBody(config domain.ConfigAlertWebhook, result domain.RunResult) ([]byte, error) {
+	result.Host = resultHost(result)
+	if config.Body == "" {
+		return json.Marshal(result)
+	}
+
+	tmpl, err := ParseWebhookTemplate(config.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, result)
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,66 @@
+package alerts_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+)
+
+func TestWebhookNotify(t *testing.T) {
+	runNotifyCases(t, []notifyCase{
+		{
+			name:    "template",
+			factory: alerts.NewWebhookNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Webhook: domain.ConfigAlertWebhook{
+					Url:     url,
+					Method:  "put",
+					Headers: map[string]string{"Authorization": "Bearer secret"},
+					Body:    `{"container": {{json .Container}}, "ok": {{.Success}}, "text": {{json (join (lines .) "\n")}}}`,
+				}}
+			},
+			result: newRunResult(false),
+			check: func(t *testing.T, requests []capturedRequest) {
+				if len(requests) != 1 || requests[0].Method != http.MethodPut || requests[0].Header.Get("Authorization") != "Bearer secret" {
+					t.Fatalf("unexpected requests %+v", requests)
+				}
+
+				var body map[string]interface{}
+				requests[0].Json(t, &body)
+				if body["container"] != "webdav" || body["ok"] != false || !strings.Contains(body["text"].(string), "Error: The backup could not be moved") {
+					t.Errorf("unexpected body %+v", body)
+				}
+			},
+		},
+		{
+			name:    "default body",
+			factory: alerts.NewWebhookNotifier,
+			config: func(url string) domain.ConfigAlert {
+				return domain.ConfigAlert{Webhook: domain.ConfigAlertWebhook{Url: url}}
+			},
+			result: newRunResult(true),
+			check: func(t *testing.T, requests []capturedRequest) {
+				var result domain.RunResult
+				requests[0].Json(t, &result)
+				if result.Id != "5f1c0a9e2b7d" || !result.Success || len(result.Records) != 2 {
+					t.Errorf("expected the run result as json but got %s", requests[0].Body)
+				}
+			},
+		},
+	})
+}
+
+func TestWebhookBadTemplate(t *testing.T) {
+	_, err := alerts.ParseWebhookTemplate(`{{.Container`)
+	if err == nil {
+		t.Error("expected the template to be rejected")
+	}
+
+	_, err = alerts.RenderWebhookBody(domain.ConfigAlertWebhook{Body: `{{.Missing}}`}, newRunResult(true))
+	if err == nil {
+		t.Error("expected an unknown field to fail")
+	}
+}
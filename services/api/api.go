@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+	"github.com/jtom38/dvb/services/metrics"
+)
+
+const (
+	ErrUnauthorized     = "a valid bearer token is required"
+	ErrMethodNotAllowed = "method not allowed"
+
+	// The version prefix used by every endpoint.
+	BasePath = "/api/v1"
+)
+
+// The api server exposes a running daemon over http.
+type Server struct {
+	config  domain.ConfigDaemonApi
+	daemon  domain.DaemonApi
+	server  *http.Server
+	handler http.Handler
+}
+
+func NewServer(config domain.ConfigDaemonApi, daemon domain.DaemonApi) *Server {
+	s := &Server{
+		config: config,
+		daemon: daemon,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.health)
+	mux.Handle("/metrics", s.route(http.MethodGet, s.getMetrics))
+	mux.Handle(BasePath+"/daemon", s.route(http.MethodGet, s.getDaemon))
+	mux.Handle(BasePath+"/jobs", s.route(http.MethodGet, s.getJobs))
+	mux.Handle(BasePath+"/runs", s.route(http.MethodGet, s.getRuns))
+	mux.Handle(BasePath+"/history", s.route(http.MethodGet, s.getHistory))
+	mux.Handle(BasePath+"/backups", s.route(http.MethodGet, s.getBackups))
+	mux.Handle(BasePath+"/trigger", s.route(http.MethodPost, s.postTrigger))
+	mux.Handle(BasePath+"/prune", s.route(http.MethodPost, s.postPrune))
+	mux.Handle(BasePath+"/pause", s.route(http.MethodPost, s.postPause))
+	mux.Handle(BasePath+"/resume", s.route(http.MethodPost, s.postResume))
+	s.handler = mux
+
+	return s
+}
+
+// Returns the handler so the api can be served by something else, like a test server.
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// Starts listening in the background, https is used when a cert and key are set.
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.config.Listen)
+	if err != nil {
+		return err
+	}
+
+	s.server = &http.Server{
+		Handler:           s.handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		var err error
+		if s.config.TlsCert != "" && s.config.TlsKey != "" {
+			logger.Default().Info("The api is listening", "url", fmt.Sprintf("https://%v", listener.Addr()))
+			err = s.server.ServeTLS(listener, s.config.TlsCert, s.config.TlsKey)
+		} else {
+			logger.Default().Info("The api is listening", "url", fmt.Sprintf("http://%v", listener.Addr()))
+			err = s.server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Default().Error("The api stopped", logger.KeyError, err)
+		}
+	}()
+
+	return nil
+}
+
+// Stops the server and waits for open requests to finish until the context is done.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Shutdown(ctx)
+}
+
+// Checks the method and the token before calling the handler.
+func (s *Server) route(method string, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, errors.New(ErrUnauthorized))
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, http.StatusMethodNotAllowed, errors.New(ErrMethodNotAllowed))
+			return
+		}
+
+		next(w, r)
+	})
+}
+
+func (s *Server) authorized(r *http.Request) bool {
+	// Without a token nothing is allowed, the config check makes sure one is set
+	if s.config.Token == "" {
+		return false
+	}
+
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) == 1
+}
+
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", metrics.ContentType)
+	err := s.daemon.WriteMetrics(w)
+	if err != nil {
+		logger.Default().Error("Unable to write the metrics", logger.KeyError, err)
+	}
+}
+
+func (s *Server) getDaemon(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, s.daemon.Status())
+}
+
+func (s *Server) getJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.daemon.Jobs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, jobs)
+}
+
+func (s *Server) getRuns(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, s.daemon.Runs())
+}
+
+func (s *Server) getHistory(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		limit = parsed
+	}
+
+	writeJson(w, http.StatusOK, s.daemon.History(query.Get("container"), limit))
+}
+
+func (s *Server) getBackups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	pinned, err := parseBool(query.Get("pinned"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	backups, err := s.daemon.Backups(query.Get("container"), query.Get("tag"), pinned)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, backups)
+}
+
+func (s *Server) postTrigger(w http.ResponseWriter, r *http.Request) {
+	triggered, skipped, err := s.daemon.Trigger(r.URL.Query().Get("container"))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+
+	writeJson(w, http.StatusAccepted, domain.ControlResponse{
+		Triggered: triggered,
+		Skipped:   skipped,
+		Status:    s.daemon.Status(),
+	})
+}
+
+func (s *Server) postPrune(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	dryRun, err := parseBool(query.Get("dryRun"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	summaries, err := s.daemon.Prune(query.Get("container"), dryRun)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, http.StatusOK, summaries)
+}
+
+func (s *Server) postPause(w http.ResponseWriter, r *http.Request) {
+	var duration time.Duration
+	if value := r.URL.Query().Get("for"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		duration = parsed
+	}
+
+	s.daemon.Pause(duration)
+	writeJson(w, http.StatusOK, s.daemon.Status())
+}
+
+func (s *Server) postResume(w http.ResponseWriter, r *http.Request) {
+	s.daemon.Resume()
+	writeJson(w, http.StatusOK, s.daemon.Status())
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJson(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,237 @@
+package api_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/api"
+)
+
+type fakeDaemon struct {
+	paused     bool
+	prunedDry  bool
+	triggered  string
+	historyFor string
+}
+
+func (d *fakeDaemon) Trigger(name string) ([]string, []string, error) {
+	if name == "missing" {
+		return nil, nil, errors.New("no job was found for that container")
+	}
+	d.triggered = name
+	return []string{"app-db"}, nil, nil
+}
+
+func (d *fakeDaemon) Pause(duration time.Duration) { d.paused = true }
+func (d *fakeDaemon) Resume()                      { d.paused = false }
+
+func (d *fakeDaemon) Status() domain.DaemonStatus {
+	return domain.DaemonStatus{Paused: d.paused}
+}
+
+func (d *fakeDaemon) Jobs() ([]domain.JobStatus, error) {
+	return []domain.JobStatus{{Name: "app-db", Schedule: []string{"@hourly"}}}, nil
+}
+
+func (d *fakeDaemon) Runs() []domain.RunProgress {
+	return []domain.RunProgress{{Job: "app-db", Container: "app-db", Phase: "archive"}}
+}
+
+func (d *fakeDaemon) History(container string, limit int) []domain.RunRecord {
+	d.historyFor = container
+	return []domain.RunRecord{{Job: "app-db", Container: "app-db", Success: true}}
+}
+
+func (d *fakeDaemon) Backups(container string, tag string, pinned bool) ([]domain.CatalogEntry, error) {
+	return []domain.CatalogEntry{{Destination: "local", Backup: domain.BackupFile{Name: "db-20221201.0.tar"}}}, nil
+}
+
+func (d *fakeDaemon) Prune(container string, dryRun bool) ([]domain.PruneSummary, error) {
+	d.prunedDry = dryRun
+	return []domain.PruneSummary{{Destination: "local", Removed: 2}}, nil
+}
+
+func (d *fakeDaemon) WriteMetrics(w io.Writer) error {
+	_, err := io.WriteString(w, "dvb_runs_total{container=\"app-db\"} 1\n")
+	return err
+}
+
+func newTestServer(t *testing.T, daemon *fakeDaemon) *httptest.Server {
+	server := api.NewServer(domain.ConfigDaemonApi{Token: "secret"}, daemon)
+	ts := httptest.NewServer(server.Handler())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func request(t *testing.T, ts *httptest.Server, method string, path string, token string) *http.Response {
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestApiRequiresToken(t *testing.T) {
+	ts := newTestServer(t, &fakeDaemon{})
+
+	resp := request(t, ts, http.MethodGet, "/api/v1/jobs", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token but got %v", resp.StatusCode)
+	}
+
+	resp = request(t, ts, http.MethodGet, "/api/v1/jobs", "wrong")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 with the wrong token but got %v", resp.StatusCode)
+	}
+
+	resp = request(t, ts, http.MethodGet, "/healthz", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the health check to work without a token but got %v", resp.StatusCode)
+	}
+}
+
+func TestApiWithoutTokenIsClosed(t *testing.T) {
+	server := api.NewServer(domain.ConfigDaemonApi{}, &fakeDaemon{})
+	ts := httptest.NewServer(server.Handler())
+	defer ts.Close()
+
+	resp := request(t, ts, http.MethodPost, "/api/v1/trigger", "")
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 when no token is configured but got %v", resp.StatusCode)
+	}
+}
+
+func TestApiJobs(t *testing.T) {
+	ts := newTestServer(t, &fakeDaemon{})
+
+	resp := request(t, ts, http.MethodGet, "/api/v1/jobs", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %v", resp.StatusCode)
+	}
+
+	var jobs []domain.JobStatus
+	err := json.NewDecoder(resp.Body).Decode(&jobs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 || jobs[0].Name != "app-db" {
+		t.Errorf("unexpected jobs %+v", jobs)
+	}
+}
+
+func TestApiHistory(t *testing.T) {
+	daemon := &fakeDaemon{}
+	ts := newTestServer(t, daemon)
+
+	resp := request(t, ts, http.MethodGet, "/api/v1/history?container=app-db&limit=5", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %v", resp.StatusCode)
+	}
+
+	if daemon.historyFor != "app-db" {
+		t.Errorf("expected the history to be filtered by app-db but got '%v'", daemon.historyFor)
+	}
+
+	resp = request(t, ts, http.MethodGet, "/api/v1/history?limit=many", "secret")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad limit but got %v", resp.StatusCode)
+	}
+}
+
+func TestApiTrigger(t *testing.T) {
+	daemon := &fakeDaemon{}
+	ts := newTestServer(t, daemon)
+
+	resp := request(t, ts, http.MethodGet, "/api/v1/trigger", "secret")
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for a get but got %v", resp.StatusCode)
+	}
+
+	resp = request(t, ts, http.MethodPost, "/api/v1/trigger?container=app-db", "secret")
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 but got %v", resp.StatusCode)
+	}
+
+	var body domain.ControlResponse
+	err := json.NewDecoder(resp.Body).Decode(&body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if daemon.triggered != "app-db" || len(body.Triggered) != 1 {
+		t.Errorf("expected app-db to be triggered but got %+v", body)
+	}
+
+	resp = request(t, ts, http.MethodPost, "/api/v1/trigger?container=missing", "secret")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown container but got %v", resp.StatusCode)
+	}
+}
+
+func TestApiPrune(t *testing.T) {
+	daemon := &fakeDaemon{}
+	ts := newTestServer(t, daemon)
+
+	resp := request(t, ts, http.MethodPost, "/api/v1/prune?dryRun=true", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %v", resp.StatusCode)
+	}
+
+	if !daemon.prunedDry {
+		t.Error("expected a dry run prune")
+	}
+}
+
+func TestApiPause(t *testing.T) {
+	daemon := &fakeDaemon{}
+	ts := newTestServer(t, daemon)
+
+	resp := request(t, ts, http.MethodPost, "/api/v1/pause?for=2h", "secret")
+	if resp.StatusCode != http.StatusOK || !daemon.paused {
+		t.Errorf("expected the daemon to be paused but got %v", resp.StatusCode)
+	}
+
+	resp = request(t, ts, http.MethodPost, "/api/v1/resume", "secret")
+	if resp.StatusCode != http.StatusOK || daemon.paused {
+		t.Errorf("expected the daemon to be resumed but got %v", resp.StatusCode)
+	}
+}
+
+func TestApiMetrics(t *testing.T) {
+	ts := newTestServer(t, &fakeDaemon{})
+
+	resp := request(t, ts, http.MethodGet, "/metrics", "secret")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 but got %v", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(body), "dvb_runs_total") {
+		t.Errorf("unexpected metrics %v", string(body))
+	}
+
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+		t.Errorf("unexpected content type %v", resp.Header.Get("Content-Type"))
+	}
+}
@@ -1,12 +1,15 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os/exec"
+	"strings"
 	"time"
 
-	"github.com/bitfield/script"
+	"bitbucket.org/creachadair/shell"
 )
 
 const (
@@ -15,6 +18,7 @@ const (
 	DockerContainerInspect       = "docker container inspect"
 	DockerContainerStop          = "docker container stop"
 	DockerContainerStart         = "docker container start"
+	DockerContainerRemove        = "docker container rm -f"
 	DockerContainerInspectStatus = "docker container inspect -f '{{json .State}}'"
 
 	ContainerStatusStopped = "exited"
@@ -22,40 +26,74 @@ const (
 
 	ErrContainerStopTimeout  = "the requested container did not stop within the requested time frame"
 	ErrContainerStartTimeout = "the requested container did not start within the requested time frame"
+	ErrInvalidCommand        = "unable to parse the command"
 )
 
 // This client requires the docker cli to be installed.
-type DockerCliClient struct{}
+type DockerCliClient struct {
+	ctx context.Context
+}
 
 func NewDockerCliClient() DockerCliClient {
-	return DockerCliClient{}
+	return DockerCliClient{
+		ctx: context.Background(),
+	}
+}
+
+// Returns a copy of the client that stops any running command when the context is cancelled.
+func (c DockerCliClient) WithContext(ctx context.Context) DockerCliClient {
+	c.ctx = ctx
+	return c
 }
 
 func RunCommand(cmd string) (string, error) {
-	var out string
+	return RunCommandContext(context.Background(), cmd)
+}
 
-	p := script.NewPipe()
-	out, err := p.Exec(cmd).String()
-	if err != nil {
-		return out, err
+// Runs the command and returns the combined output, the command is killed if the context is cancelled.
+// The error wraps why the command failed, or the context error, with the output of the command.
+func RunCommandContext(ctx context.Context, cmd string) (string, error) {
+	args, ok := shell.Split(cmd)
+	if !ok || len(args) == 0 {
+		return "", errors.New(ErrInvalidCommand)
+	}
+
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err == nil {
+		return string(out), nil
+	}
+
+	if ctx.Err() != nil {
+		err = ctx.Err()
 	}
-	return out, nil
+	output := strings.TrimSpace(string(out))
+	if output == "" {
+		return string(out), err
+	}
+	return string(out), fmt.Errorf("%w: %s", err, output)
+}
+
+func (c DockerCliClient) run(cmd string) (string, error) {
+	if c.ctx == nil {
+		return RunCommand(cmd)
+	}
+	return RunCommandContext(c.ctx, cmd)
 }
 
 func (c DockerCliClient) ListContainers() (string, error) {
 	cmd := fmt.Sprintf("%v", DockerContainerList)
-	return RunCommand(cmd)
+	return c.run(cmd)
 }
 
 func (c DockerCliClient) InspectContainer(name string) (string, error) {
 	cmd := fmt.Sprintf("%v %v", DockerContainerInspect, name)
-	return RunCommand(cmd)
+	return c.run(cmd)
 }
 
 // This sends the stop command but does not wait for it to go offline.
 func (c DockerCliClient) StopContainer(name string) (string, error) {
 	cmd := fmt.Sprintf("%v %v", DockerContainerStop, name)
-	return RunCommand(cmd)
+	return c.run(cmd)
 }
 
 func (c DockerCliClient) PollStartContainer(name string) error {
@@ -71,9 +109,9 @@ func (c DockerCliClient) PollStartContainer(name string) error {
 			return nil
 		}
 
-		res, err := c.StartContainer(name)
+		_, err := c.StartContainer(name)
 		if err != nil {
-			return errors.New(res)
+			return err
 		}
 
 		time.Sleep(2 * time.Second)
@@ -96,9 +134,9 @@ func (c DockerCliClient) PollStopContainer(name string) error {
 			return nil
 		}
 
-		res, err := c.StopContainer(name)
+		_, err := c.StopContainer(name)
 		if err != nil {
-			return errors.New(res)
+			return err
 		}
 
 		time.Sleep(2 * time.Second)
@@ -119,7 +157,13 @@ func (c DockerCliClient) IsRunning(name string) bool {
 // This sends the start command but does not wait for it to come online.
 func (c DockerCliClient) StartContainer(name string) (string, error) {
 	cmd := fmt.Sprintf("%v %v", DockerContainerStart, name)
-	return RunCommand(cmd)
+	return c.run(cmd)
+}
+
+// This kills the container if it is running and removes it.
+func (c DockerCliClient) RemoveContainer(name string) (string, error) {
+	cmd := fmt.Sprintf("%v %v", DockerContainerRemove, name)
+	return c.run(cmd)
 }
 
 type DockerContainerStatus struct {
@@ -141,9 +185,9 @@ func (c DockerCliClient) InspectContainerStatus(name string) (DockerContainerSta
 
 	cmd := fmt.Sprintf("%v %v", DockerContainerInspectStatus, name)
 
-	res, err := RunCommand(cmd)
+	res, err := c.run(cmd)
 	if err != nil {
-		return result, errors.New(res)
+		return result, err
 	}
 
 	err = json.Unmarshal([]byte(res), &result)
@@ -155,7 +199,9 @@ func (c DockerCliClient) InspectContainerStatus(name string) (DockerContainerSta
 }
 
 type DockerBackupVolumeParams struct {
-	ContainerName  string
+	ContainerName string
+	// The name given to the container that runs tar, so it can be removed if the backup is cancelled.
+	HelperName     string
 	BackupFolder   string
 	BackupFilename string
 	TargetFolder   string
@@ -164,7 +210,12 @@ type DockerBackupVolumeParams struct {
 func (c DockerCliClient) BackupDockerVolume(params DockerBackupVolumeParams) (string, error) {
 	// docker run --rm --volumes-from webdav-app-1 -v $PWD:/backup-dir ubuntu tar cvf /backup-dir/webdav-backup.tar /var/lib/dav
 
-	cmd := fmt.Sprintf("%v --rm --volumes-from %v -v %v:/backup-dir ubuntu tar cvf /backup-dir/%v.tar %v", DockerRun, params.ContainerName, params.BackupFolder, params.BackupFilename, params.TargetFolder)
+	run := DockerRun + " --rm"
+	if params.HelperName != "" {
+		run = fmt.Sprintf("%v --name %v", run, params.HelperName)
+	}
+
+	cmd := fmt.Sprintf("%v --volumes-from %v -v %v:/backup-dir ubuntu tar cvf /backup-dir/%v.tar %v", run, params.ContainerName, params.BackupFolder, params.BackupFilename, params.TargetFolder)
 
-	return RunCommand(cmd)
+	return c.run(cmd)
 }
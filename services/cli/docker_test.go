@@ -1,8 +1,13 @@
 package cli_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"os/exec"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jtom38/dvb/services/cli"
 )
@@ -32,3 +37,43 @@ func TestDockerPullStartContainer(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+func TestRunCommandContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := cli.RunCommandContext(ctx, "sleep 5")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the command to be cancelled but got %v", err)
+	}
+
+	if time.Since(start) > 2*time.Second {
+		t.Error("the command kept running after the context was cancelled")
+	}
+}
+
+func TestRunCommandQuotes(t *testing.T) {
+	out, err := cli.RunCommand("echo '{{json .State}}'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "{{json .State}}\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestRunCommandError(t *testing.T) {
+	_, err := cli.RunCommand("dvb-missing-binary ps")
+	if !errors.Is(err, exec.ErrNotFound) {
+		t.Errorf("expected the missing binary to be reported but got %v", err)
+	}
+
+	// The output says why the command failed
+	_, err = cli.RunCommand("sh -c 'echo no such container >&2; exit 1'")
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || !strings.HasSuffix(err.Error(), ": no such container") {
+		t.Errorf("expected the exit code and the output but got %v", err)
+	}
+}
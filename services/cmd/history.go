@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/history"
+	"github.com/jtom38/dvb/services/proc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	HistoryContainer string
+	HistoryLimit     int
+	HistoryFailed    bool
+	HistorySince     time.Duration
+	HistoryJson      bool
+
+	historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "Lists the past backup runs.",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newHistoryClient()
+
+			filter := history.Filter{
+				Container: HistoryContainer,
+				Failed:    HistoryFailed,
+				Limit:     HistoryLimit,
+			}
+			if HistorySince > 0 {
+				filter.Since = time.Now().Add(-HistorySince)
+			}
+
+			records, err := client.List(filter)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if HistoryJson {
+				printJson(records)
+				return
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "RUN\tCONTAINER\tSTARTED\tDURATION\tRESULT\tSIZE\tERROR")
+			for _, record := range records {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+					record.Id,
+					record.Container,
+					formatTime(record.StartedAt),
+					record.Duration().Round(time.Second),
+					formatResult(record.Success),
+					common.FormatBytes(record.ArchiveSize),
+					record.Error,
+				)
+			}
+			w.Flush()
+		},
+	}
+
+	historyShowCmd = &cobra.Command{
+		Use:   "show <run>",
+		Short: "Shows everything that was recorded about a single run.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newHistoryClient()
+
+			record, err := client.Get(args[0])
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			if HistoryJson {
+				printJson(record)
+				return
+			}
+			printRunRecord(record)
+		},
+	}
+)
+
+func newHistoryClient() proc.HistoryClient {
+	client := proc.NewHistoryClient(proc.HistoryParams{
+		ConfigPath: ConfigPath,
+	})
+	err := client.LoadConfig()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	return client
+}
+
+func printJson(value interface{}) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(value)
+}
+
+func formatResult(success bool) string {
+	if success {
+		return "success"
+	}
+	return "failed"
+}
+
+func printRunRecord(record domain.RunRecord) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Run:\t%v\n", record.Id)
+	fmt.Fprintf(w, "Job:\t%v\n", record.Job)
+	fmt.Fprintf(w, "Container:\t%v\n", record.Container)
+	fmt.Fprintf(w, "Host:\t%v\n", record.Host)
+	fmt.Fprintf(w, "Started:\t%v\n", formatTime(record.StartedAt))
+	fmt.Fprintf(w, "Finished:\t%v\n", formatTime(record.FinishedAt))
+	fmt.Fprintf(w, "Duration:\t%v\n", record.Duration().Round(time.Millisecond))
+	fmt.Fprintf(w, "Result:\t%v\n", formatResult(record.Success))
+	fmt.Fprintf(w, "Attempts:\t%v\n", record.Attempts)
+	fmt.Fprintf(w, "Backup:\t%v\n", record.FileName)
+	fmt.Fprintf(w, "Size:\t%v\n", common.FormatBytes(record.ArchiveSize))
+	fmt.Fprintf(w, "Checksum:\t%v\n", record.Checksum)
+	fmt.Fprintf(w, "Destinations:\t%v\n", strings.Join(record.Destinations, ", "))
+	w.Flush()
+
+	if len(record.Phases) >= 1 {
+		fmt.Println("\nPhases:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, phase := range record.Phases {
+			fmt.Fprintf(w, "  %v\t%v\n", phase.Name, phase.Duration.Round(time.Millisecond))
+		}
+		w.Flush()
+	}
+
+	if len(record.Deleted) >= 1 {
+		fmt.Println("\nDeleted:")
+		for _, name := range record.Deleted {
+			fmt.Printf("  %v\n", name)
+		}
+	}
+
+	if len(record.Alerts) >= 1 {
+		fmt.Println("\nAlerts:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, alert := range record.Alerts {
+			result := "sent"
+			if alert.Error != "" {
+				result = alert.Error
+			}
+			fmt.Fprintf(w, "  %v\t%v attempt(s)\t%v\n", alert.Channel, alert.Attempts, result)
+		}
+		w.Flush()
+	}
+
+	if len(record.Errors) >= 1 {
+		fmt.Println("\nErrors:")
+		for _, err := range record.Errors {
+			fmt.Printf("  %v\n", err)
+		}
+	}
+}
+
+func init() {
+	historyCmd.PersistentFlags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	historyCmd.PersistentFlags().BoolVar(&HistoryJson, "json", false, "Prints the runs as json")
+	historyCmd.Flags().StringVar(&HistoryContainer, "container", "", "Only list the runs of this container")
+	historyCmd.Flags().IntVar(&HistoryLimit, "limit", 20, "How many runs to list, 0 lists every run")
+	historyCmd.Flags().BoolVar(&HistoryFailed, "failed", false, "Only list the runs that failed")
+	historyCmd.Flags().DurationVar(&HistorySince, "since", 0, "Only list the runs that started within this duration, like 24h")
+	historyCmd.AddCommand(historyShowCmd)
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/proc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ListContainer string
+	ListTag       string
+	ListPinned    bool
+
+	listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "Lists the backups dvb has made.",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newCatalogClient(proc.CatalogParams{
+				Container: ListContainer,
+				Tag:       ListTag,
+				Pinned:    ListPinned,
+			})
+
+			entries, err := client.List()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "DESTINATION\tCONTAINER\tBACKUP\tCREATED\tSIZE\tPINNED\tTAGS")
+			for _, entry := range entries {
+				var tags []string
+				if entry.Backup.Manifest != nil {
+					tags = entry.Backup.Manifest.Tags
+				}
+
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+					entry.Destination,
+					entry.Backup.Container,
+					entry.Backup.Name,
+					entry.Backup.CreatedAt.Format(time.RFC3339),
+					common.FormatBytes(entry.Backup.Size),
+					entry.Backup.IsPinned(),
+					strings.Join(tags, ","),
+				)
+			}
+			w.Flush()
+		},
+	}
+)
+
+func init() {
+	listCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	listCmd.Flags().StringVar(&ListContainer, "container", "", "Only list the backups of this container")
+	listCmd.Flags().StringVar(&ListTag, "tag", "", "Only list the backups with this tag")
+	listCmd.Flags().BoolVar(&ListPinned, "pinned", false, "Only list pinned backups")
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/jtom38/dvb/services/proc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	PinTags   []string
+	RemoveTag bool
+
+	pinCmd = &cobra.Command{
+		Use:   "pin <backup>",
+		Short: "Pins a backup so retention will never remove it.",
+		Long:  "Pins a backup so retention will never remove it.  Use the file name of the backup, for example app-db-20221201.0.tar",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newCatalogClient(proc.CatalogParams{})
+			err := client.Pin(args[0], PinTags)
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	unpinCmd = &cobra.Command{
+		Use:   "unpin <backup>",
+		Short: "Lets retention remove a pinned backup again.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newCatalogClient(proc.CatalogParams{})
+			err := client.Unpin(args[0])
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	tagCmd = &cobra.Command{
+		Use:   "tag <backup> <tag>...",
+		Short: "Adds free-form tags to a backup.",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newCatalogClient(proc.CatalogParams{})
+			err := client.Tag(args[0], args[1:], RemoveTag)
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+		},
+	}
+)
+
+// Loads the config and returns a catalog client, exits if the config can't be loaded.
+func newCatalogClient(params proc.CatalogParams) proc.CatalogClient {
+	params.ConfigPath = ConfigPath
+	client := proc.NewCatalogClient(params)
+	err := client.LoadConfig()
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	return client
+}
+
+func init() {
+	pinCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	pinCmd.Flags().StringSliceVar(&PinTags, "tag", []string{}, "Tags to add to the backup")
+
+	unpinCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+
+	tagCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	tagCmd.Flags().BoolVar(&RemoveTag, "remove", false, "Removes the tags instead of adding them")
+}
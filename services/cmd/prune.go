@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/proc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	DryRun         bool
+	PruneContainer string
+
+	pruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Applies the retention policy without taking a new backup.",
+		Long:  "Applies the configured retention policy to every destination and container without taking a new backup.",
+		Run: func(cmd *cobra.Command, args []string) {
+			_, err := os.Stat(ConfigPath)
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+
+			client := proc.NewPruneClient(proc.PruneParams{
+				ConfigPath: ConfigPath,
+				DryRun:     DryRun,
+				Container:  PruneContainer,
+			})
+			summaries, err := client.RunProcess()
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+
+			freed := "Freed"
+			if DryRun {
+				freed = "Would free"
+			}
+			for _, summary := range summaries {
+				fmt.Printf("%v: %v backup(s), %v %v, %v foreign file(s) ignored\n", summary.Destination, summary.Removed, freed, common.FormatBytes(summary.FreedBytes), summary.Foreign)
+			}
+		},
+	}
+)
+
+func init() {
+	pruneCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	pruneCmd.Flags().BoolVar(&DryRun, "dry-run", false, "Reports what would be removed without removing anything")
+	pruneCmd.Flags().StringVar(&PruneContainer, "container", "", "Only prune the backups of this container")
+}
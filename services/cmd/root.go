@@ -9,10 +9,10 @@ import (
 )
 
 var (
-	ConfigPath     string
-	Daemon         bool
-	Debug          bool
-	Version        string = "0.0.9"
+	ConfigPath string
+	Daemon     bool
+	Debug      bool
+	Version    string = "0.0.9"
 
 	root = &cobra.Command{
 		Use:   "dvb",
@@ -34,6 +34,16 @@ func Execute() {
 
 func init() {
 	root.AddCommand(startCmd)
+	root.AddCommand(pruneCmd)
+	root.AddCommand(statusCmd)
+	root.AddCommand(listCmd)
+	root.AddCommand(historyCmd)
+	root.AddCommand(pinCmd)
+	root.AddCommand(unpinCmd)
+	root.AddCommand(tagCmd)
+	root.AddCommand(triggerCmd)
+	root.AddCommand(pauseCmd)
+	root.AddCommand(resumeCmd)
 	root.AddCommand(versionCmd)
 	//root.AddCommand(installCmd)
 
@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jtom38/dvb/services/proc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	StatusJson bool
+
+	statusCmd = &cobra.Command{
+		Use:   "status",
+		Short: "Shows the last attempt, last success and next run of every job.",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := proc.NewStatusClient(proc.StatusParams{
+				ConfigPath: ConfigPath,
+			})
+			err := client.LoadConfig()
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+
+			jobs, err := client.Status()
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+
+			if StatusJson {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				enc.Encode(jobs)
+				return
+			}
+
+			// Only a running daemon knows if it is paused
+			control := proc.NewControlClient(proc.ControlParams{})
+			control.Config = client.Config
+			daemon, err := control.Status()
+			if err == nil && daemon.Status.Paused {
+				fmt.Println("The daemon is paused, scheduled backups will not run.")
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "JOB\tLAST ATTEMPT\tLAST SUCCESS\tNEXT RUN\tLAST ERROR")
+			for _, job := range jobs {
+				fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n",
+					job.Name,
+					formatTime(job.State.LastAttempt),
+					formatTime(job.State.LastSuccess),
+					formatTime(job.NextRun),
+					job.State.LastError,
+				)
+			}
+			w.Flush()
+		},
+	}
+)
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func init() {
+	statusCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	statusCmd.Flags().BoolVar(&StatusJson, "json", false, "Prints the status as json")
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jtom38/dvb/services/proc"
+	"github.com/spf13/cobra"
+)
+
+var (
+	TriggerContainer string
+	PauseFor         time.Duration
+
+	triggerCmd = &cobra.Command{
+		Use:   "trigger",
+		Short: "Asks the running daemon to back up now.",
+		Long:  "Asks the running daemon to back up now.  Without --container every job is run.",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newControlClient()
+			resp, err := client.Trigger(TriggerContainer)
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+
+			if len(resp.Triggered) >= 1 {
+				fmt.Printf("Started: %v\n", strings.Join(resp.Triggered, ", "))
+			}
+			if len(resp.Skipped) >= 1 {
+				fmt.Printf("Already running: %v\n", strings.Join(resp.Skipped, ", "))
+			}
+		},
+	}
+
+	pauseCmd = &cobra.Command{
+		Use:   "pause",
+		Short: "Stops the running daemon from starting scheduled backups.",
+		Long:  "Stops the running daemon from starting scheduled backups.  Backups that are running will finish and dvb trigger still works.",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newControlClient()
+			resp, err := client.Pause(PauseFor)
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+
+			if resp.Status.PausedUntil.IsZero() {
+				fmt.Println("Scheduled backups are paused until dvb resume is run.")
+				return
+			}
+			fmt.Printf("Scheduled backups are paused until %v.\n", formatTime(resp.Status.PausedUntil))
+		},
+	}
+
+	resumeCmd = &cobra.Command{
+		Use:   "resume",
+		Short: "Lets the running daemon start scheduled backups again.",
+		Run: func(cmd *cobra.Command, args []string) {
+			client := newControlClient()
+			_, err := client.Resume()
+			if err != nil {
+				log.Print(err)
+				os.Exit(1)
+			}
+			fmt.Println("Scheduled backups have resumed.")
+		},
+	}
+)
+
+// Loads the config and returns a control client, exits if the config can't be loaded.
+func newControlClient() proc.ControlClient {
+	client := proc.NewControlClient(proc.ControlParams{
+		ConfigPath: ConfigPath,
+	})
+	err := client.LoadConfig()
+	if err != nil {
+		log.Print(err)
+		os.Exit(1)
+	}
+	return client
+}
+
+func init() {
+	triggerCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	triggerCmd.Flags().StringVar(&TriggerContainer, "container", "", "Only back up this container")
+
+	pauseCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+	pauseCmd.Flags().DurationVar(&PauseFor, "for", 0, "Resume on its own after this long, like 2h")
+
+	resumeCmd.Flags().StringVar(&ConfigPath, "config-path", "", "Defines what config file should be loaded")
+}
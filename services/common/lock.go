@@ -0,0 +1,54 @@
+package common
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	ErrAlreadyRunning = "another dvb process is already running"
+)
+
+// FileLock stops two dvb processes from running at the same time.
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{
+		path: path,
+	}
+}
+
+// Takes the lock without waiting, returns an error if another process holds it.
+func (l *FileLock) Lock() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = lockFile(file)
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// Leave the pid behind so it is easy to find who holds the lock
+	file.Truncate(0)
+	fmt.Fprintf(file, "%d\n", os.Getpid())
+
+	l.file = file
+	return nil
+}
+
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+
+	err := unlockFile(l.file)
+	l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,35 @@
+package common_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/jtom38/dvb/services/common"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dvb.lock")
+
+	first := common.NewFileLock(path)
+	err := first.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second := common.NewFileLock(path)
+	err = second.Lock()
+	if err == nil || err.Error() != common.ErrAlreadyRunning {
+		t.Fatalf("expected the second lock to fail but got %v", err)
+	}
+
+	err = first.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = second.Lock()
+	if err != nil {
+		t.Errorf("expected the lock to be free but got %v", err)
+	}
+	second.Unlock()
+}
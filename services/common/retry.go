@@ -0,0 +1,101 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	DefaultRetryDelay      = 5 * time.Second
+	DefaultRetryMaxDelay   = 5 * time.Minute
+	DefaultRetryMultiplier = 2
+)
+
+// Called after an attempt fails, wait is how long until the next attempt.
+type RetryFailureFunc func(attempt int, err error, wait time.Duration)
+
+type RetryParams struct {
+	// Used in the logs to tell the phases apart.
+	Name   string
+	Policy domain.ConfigRetryPolicy
+
+	OnFailure RetryFailureFunc
+
+	// Every failed attempt is logged here, defaults to logger.Default.
+	Logger *logger.Logger
+}
+
+// Runs fn until it works or the attempts run out, waiting longer between each attempt.
+// Returns how many attempts were made.
+func Retry(ctx context.Context, params RetryParams, fn func() error) (int, error) {
+	attempts := params.Policy.Attempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+
+	log := params.Logger
+	if log == nil {
+		log = logger.Default()
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil {
+			if attempt > 1 {
+				log.Info(fmt.Sprintf("%v worked after %v attempts", params.Name, attempt), "phase", params.Name, "attempts", attempt)
+			}
+			return attempt, nil
+		}
+
+		if attempt >= attempts || ctx.Err() != nil {
+			log.Warn(fmt.Sprintf("%v attempt %v/%v failed", params.Name, attempt, attempts), "phase", params.Name, logger.KeyError, err)
+			if params.OnFailure != nil {
+				params.OnFailure(attempt, err, 0)
+			}
+			return attempt, err
+		}
+
+		wait := RetryBackoff(params.Policy, attempt)
+		log.Warn(fmt.Sprintf("%v attempt %v/%v failed, retrying in %v", params.Name, attempt, attempts, wait.Round(time.Millisecond)), "phase", params.Name, logger.KeyError, err)
+		if params.OnFailure != nil {
+			params.OnFailure(attempt, err, wait)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+// Returns how long to wait after the attempt failed.
+func RetryBackoff(policy domain.ConfigRetryPolicy, attempt int) time.Duration {
+	delay := policy.Delay.OrDefault(DefaultRetryDelay)
+	maxDelay := policy.MaxDelay.OrDefault(DefaultRetryMaxDelay)
+
+	multiplier := policy.Multiplier
+	if multiplier <= 0 {
+		multiplier = DefaultRetryMultiplier
+	}
+
+	wait := float64(delay) * math.Pow(multiplier, float64(attempt-1))
+	if wait > float64(maxDelay) {
+		wait = float64(maxDelay)
+	}
+
+	if policy.Jitter > 0 {
+		wait = wait * (1 + policy.Jitter*(rand.Float64()*2-1))
+	}
+
+	return time.Duration(wait)
+}
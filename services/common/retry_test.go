@@ -0,0 +1,106 @@
+package common_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+)
+
+func TestRetryWorksAfterFailures(t *testing.T) {
+	calls := 0
+	var waits []time.Duration
+
+	attempts, err := common.Retry(context.Background(), common.RetryParams{
+		Name: "transfer",
+		Policy: domain.ConfigRetryPolicy{
+			Attempts: 5,
+			Delay:    domain.Duration(time.Millisecond),
+		},
+		OnFailure: func(attempt int, err error, wait time.Duration) {
+			waits = append(waits, wait)
+		},
+	}, func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("nas is offline")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts but got %v", attempts)
+	}
+
+	if len(waits) != 2 || waits[0] != time.Millisecond || waits[1] != 2*time.Millisecond {
+		t.Errorf("unexpected waits %v", waits)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	attempts, err := common.Retry(context.Background(), common.RetryParams{
+		Name:   "quiesce",
+		Policy: domain.ConfigRetryPolicy{Attempts: 2, Delay: domain.Duration(time.Millisecond)},
+	}, func() error {
+		return errors.New("container is busy")
+	})
+
+	if err == nil || attempts != 2 {
+		t.Errorf("expected 2 failed attempts but got %v, %v", attempts, err)
+	}
+}
+
+func TestRetryDefaultsToOneAttempt(t *testing.T) {
+	attempts, err := common.Retry(context.Background(), common.RetryParams{Name: "archive"}, func() error {
+		return errors.New("tar failed")
+	})
+
+	if err == nil || attempts != 1 {
+		t.Errorf("expected 1 failed attempt but got %v, %v", attempts, err)
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts, err := common.Retry(ctx, common.RetryParams{
+		Name:   "transfer",
+		Policy: domain.ConfigRetryPolicy{Attempts: 10, Delay: domain.Duration(time.Hour)},
+	}, func() error {
+		return errors.New("nas is offline")
+	})
+
+	if err == nil || attempts != 1 {
+		t.Errorf("expected the retry to stop after 1 attempt but got %v, %v", attempts, err)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := domain.ConfigRetryPolicy{
+		Delay:    domain.Duration(time.Second),
+		MaxDelay: domain.Duration(10 * time.Second),
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, want := range expected {
+		got := common.RetryBackoff(policy, i+1)
+		if got != want {
+			t.Errorf("attempt %v: expected %v but got %v", i+1, want, got)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 50; i++ {
+		got := common.RetryBackoff(policy, 1)
+		if got < 500*time.Millisecond || got > 1500*time.Millisecond {
+			t.Fatalf("jitter moved the wait too far: %v", got)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package common
+
+import (
+	"os"
+)
+
+const (
+	DefaultStateDirectory = "{{USERDIR}}/.dvb"
+)
+
+// Returns the folder dvb keeps its state in and makes sure it exists.
+func StateDirectory(value string) (string, error) {
+	if value == "" {
+		value = DefaultStateDirectory
+	}
+
+	dir, err := ReplaceAllConfigVariables(value)
+	if err != nil {
+		return dir, err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return dir, err
+	}
+
+	return dir, nil
+}
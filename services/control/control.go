@@ -0,0 +1,176 @@
+package control
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	SocketFileName = "dvb.sock"
+
+	ErrDaemonNotRunning = "the dvb daemon is not running"
+	ErrUnknownCommand   = "unknown control command"
+
+	// How long a client waits for the daemon to reply.
+	requestTimeout = 10 * time.Second
+)
+
+// Returns where the control socket lives in the state directory.
+func SocketPath(stateDir string) string {
+	return filepath.Join(stateDir, SocketFileName)
+}
+
+// The control server lets other dvb processes send commands to a running daemon.
+// Each connection sends one json request per line and gets one json response per line.
+type Server struct {
+	path     string
+	daemon   domain.Daemon
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+func NewServer(path string, daemon domain.Daemon) *Server {
+	return &Server{
+		path:   path,
+		daemon: daemon,
+	}
+}
+
+// Starts listening on the socket in the background.
+// Only call this while holding the dvb lock, any socket left behind by a crash is removed.
+func (s *Server) Start() error {
+	os.Remove(s.path)
+
+	listener, err := net.Listen("unix", s.path)
+	if err != nil {
+		return err
+	}
+
+	// Only the user running dvb can control it
+	err = os.Chmod(s.path, 0600)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	s.listener = listener
+	s.wg.Add(1)
+	go s.accept()
+	return nil
+}
+
+// Stops accepting commands and removes the socket.
+func (s *Server) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+
+	err := s.listener.Close()
+	s.wg.Wait()
+	os.Remove(s.path)
+	return err
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Default().Error("Control socket error", logger.KeyError, err)
+			continue
+		}
+
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	enc := json.NewEncoder(conn)
+	for scanner.Scan() {
+		var req domain.ControlRequest
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		if err != nil {
+			enc.Encode(domain.ControlResponse{Error: err.Error()})
+			continue
+		}
+
+		err = enc.Encode(s.Handle(req))
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Runs the command against the daemon.
+func (s *Server) Handle(req domain.ControlRequest) domain.ControlResponse {
+	var resp domain.ControlResponse
+
+	switch req.Command {
+	case domain.ControlTrigger:
+		triggered, skipped, err := s.daemon.Trigger(req.Container)
+		if err != nil {
+			resp.Error = err.Error()
+		}
+		resp.Triggered = triggered
+		resp.Skipped = skipped
+	case domain.ControlPause:
+		s.daemon.Pause(time.Duration(req.Duration))
+	case domain.ControlResume:
+		s.daemon.Resume()
+	case domain.ControlStatus:
+	default:
+		resp.Error = fmt.Sprintf("%v '%v'", ErrUnknownCommand, req.Command)
+	}
+
+	resp.Status = s.daemon.Status()
+	return resp
+}
+
+// Sends a single command to the daemon listening on the socket.
+func Send(path string, req domain.ControlRequest) (domain.ControlResponse, error) {
+	var resp domain.ControlResponse
+
+	conn, err := net.DialTimeout("unix", path, requestTimeout)
+	if err != nil {
+		return resp, fmt.Errorf("%v: %v", ErrDaemonNotRunning, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(requestTimeout))
+
+	content, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	_, err = conn.Write(append(content, '\n'))
+	if err != nil {
+		return resp, err
+	}
+
+	err = json.NewDecoder(conn).Decode(&resp)
+	if err != nil {
+		return resp, err
+	}
+
+	if resp.Error != "" {
+		return resp, errors.New(resp.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,117 @@
+package control_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/control"
+)
+
+type fakeDaemon struct {
+	paused   bool
+	duration time.Duration
+}
+
+func (d *fakeDaemon) Trigger(name string) ([]string, []string, error) {
+	switch name {
+	case "":
+		return []string{"app-db"}, []string{"webdav"}, nil
+	case "webdav":
+		return nil, []string{"webdav"}, nil
+	}
+	return nil, nil, errors.New("no job was found for that container")
+}
+
+func (d *fakeDaemon) Pause(duration time.Duration) {
+	d.paused = true
+	d.duration = duration
+}
+
+func (d *fakeDaemon) Resume() {
+	d.paused = false
+}
+
+func (d *fakeDaemon) Status() domain.DaemonStatus {
+	return domain.DaemonStatus{Paused: d.paused, Active: []string{"webdav"}}
+}
+
+func startServer(t *testing.T, daemon domain.Daemon) string {
+	dir, err := os.MkdirTemp("", "dvb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := control.SocketPath(dir)
+	server := control.NewServer(path, daemon)
+	err = server.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return path
+}
+
+func TestControlTrigger(t *testing.T) {
+	path := startServer(t, &fakeDaemon{})
+
+	resp, err := control.Send(path, domain.ControlRequest{Command: domain.ControlTrigger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(resp.Triggered) != 1 || resp.Triggered[0] != "app-db" {
+		t.Errorf("expected app-db to be triggered but got %v", resp.Triggered)
+	}
+
+	if len(resp.Skipped) != 1 || resp.Skipped[0] != "webdav" {
+		t.Errorf("expected webdav to be skipped but got %v", resp.Skipped)
+	}
+
+	_, err = control.Send(path, domain.ControlRequest{Command: domain.ControlTrigger, Container: "missing"})
+	if err == nil {
+		t.Error("expected an error for a container without a job")
+	}
+}
+
+func TestControlPauseResume(t *testing.T) {
+	daemon := &fakeDaemon{}
+	path := startServer(t, daemon)
+
+	resp, err := control.Send(path, domain.ControlRequest{Command: domain.ControlPause, Duration: domain.Duration(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !resp.Status.Paused || daemon.duration != time.Hour {
+		t.Errorf("expected the daemon to be paused for an hour but got %+v", daemon)
+	}
+
+	resp, err = control.Send(path, domain.ControlRequest{Command: domain.ControlResume})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status.Paused {
+		t.Error("expected the daemon to be resumed")
+	}
+}
+
+func TestControlUnknownCommand(t *testing.T) {
+	path := startServer(t, &fakeDaemon{})
+
+	_, err := control.Send(path, domain.ControlRequest{Command: "reboot"})
+	if err == nil {
+		t.Error("expected an error for an unknown command")
+	}
+}
+
+func TestControlNotRunning(t *testing.T) {
+	_, err := control.Send(control.SocketPath(t.TempDir()), domain.ControlRequest{Command: domain.ControlStatus})
+	if err == nil {
+		t.Error("expected an error when the daemon is not running")
+	}
+}
@@ -0,0 +1,14 @@
+package dest
+
+import "github.com/jtom38/dvb/domain"
+
+// Returns every destination in the config that backups can be listed from.
+func NewStores(config domain.ConfigDest) []domain.BackupStore {
+	var stores []domain.BackupStore
+
+	if config.Local.Path != "" {
+		stores = append(stores, NewLocalStore(config.Local))
+	}
+
+	return stores
+}
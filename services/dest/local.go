@@ -1,16 +1,23 @@
 package dest
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"fmt"
 	"io"
 	"io/fs"
-	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+)
+
+const (
+	ErrMoveDestinationExists = "destination file already exists, copy job did not start"
+	ErrBackupMissing         = "the backup no longer exists on the destination"
 )
 
 type MoveClient struct {
@@ -61,7 +68,7 @@ func (c MoveClient) Move(details domain.RunDetails) error {
 		}
 	}
 
-	err = c.CopyFile(details.Backup.FullFilePath, details.Dest.Local.FullFilePath)
+	size, checksum, err := c.copyOrResume(details.Backup.FullFilePath, details.Dest.Local.FullFilePath)
 	if err != nil {
 		return err
 	}
@@ -71,164 +78,248 @@ func (c MoveClient) Move(details domain.RunDetails) error {
 		return err
 	}
 
-	return nil
+	createdAt := details.StartedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	return WriteManifest(details.Dest.Local.FullFilePath, domain.BackupManifest{
+		Version:   domain.BackupManifestVersion,
+		Container: details.ContainerName,
+		Host:      details.Hostname,
+		FileName:  details.Dest.Local.FileNameWithExtension,
+		CreatedAt: createdAt,
+		Size:      size,
+		Checksum:  checksum,
+	})
+}
+
+// Copies the backup unless an earlier try of the same move already did.
+// A backup whose manifest matches the source was moved already and is left as it is.
+// A file without a manifest is left over from a move that failed, it is kept when it matches the backup and replaced when it does not.
+func (c MoveClient) copyOrResume(source, dest string) (int64, string, error) {
+	_, err := os.Stat(dest)
+	if errors.Is(err, os.ErrNotExist) {
+		return c.copyFile(source, dest)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+
+	size, checksum, err := fileChecksum(source)
+	if err != nil {
+		return 0, "", err
+	}
+
+	// The copy and the manifest were done, only what came after failed
+	manifest, err := ReadManifest(dest)
+	if err == nil {
+		info, statErr := os.Stat(dest)
+		if statErr == nil && info.Size() == size && manifest.Size == size && manifest.Checksum == checksum {
+			return size, checksum, nil
+		}
+		return 0, "", errors.New(ErrMoveDestinationExists)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, "", errors.New(ErrMoveDestinationExists)
+	}
+
+	destSize, destChecksum, err := fileChecksum(dest)
+	if err == nil && size == destSize && checksum == destChecksum {
+		return size, checksum, nil
+	}
+
+	err = os.Remove(dest)
+	if err != nil {
+		return 0, "", err
+	}
+	return c.copyFile(source, dest)
+}
+
+// Returns the size and sha256 of the file.
+func fileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return size, "", err
+	}
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
 }
 
 func (c MoveClient) CopyFile(source, dest string) error {
+	_, _, err := c.copyFile(source, dest)
+	return err
+}
+
+// Copies the file and returns the number of bytes written and the sha256 of the content.
+func (c MoveClient) copyFile(source, dest string) (int64, string, error) {
 	// Check to make sure the source exist
 	_, err := os.Stat(source)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
 
 	// Open the source file into memory
 	s, err := os.Open(source)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
+	defer s.Close()
 
 	// Check to make sure that the destination does not exist
 	// we want an error
 	_, err = os.Stat(dest)
 	if err == nil {
-		return errors.New("destination file already exists, copy job did not start")
+		return 0, "", errors.New(ErrMoveDestinationExists)
 	}
 
 	// create the file
 	d, err := os.Create(dest)
 	if err != nil {
-		return err
+		return 0, "", err
 	}
+	defer d.Close()
 
-	_, err = io.Copy(d, s)
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(d, hash), s)
 	if err != nil {
-		return err
+		// Don't leave a partial copy behind so the copy can be tried again
+		d.Close()
+		os.Remove(dest)
+		return size, "", err
 	}
 
-	s.Close()
-	d.Close()
-
-	return nil
+	return size, hex.EncodeToString(hash.Sum(nil)), nil
 }
 
-type RetainClient struct {
-	config        domain.ConfigDestLocal
-	days          int
-	containerName string
-	dirPath       string
+// The name used for the local destination in logs and metrics.
+const LocalStoreName = "local"
+
+// LocalStore lists and removes the backups that have been moved to a local path.
+type LocalStore struct {
+	config domain.ConfigDestLocal
 }
 
-func NewLocalRetainClient(config domain.ConfigDestLocal, containerName string, retainDays int) *RetainClient {
-	path := filepath.Join(config.Path, containerName)
-	return &RetainClient{
-		config:        config,
-		days:          retainDays,
-		containerName: containerName,
-		dirPath: path,
+func NewLocalStore(config domain.ConfigDestLocal) LocalStore {
+	return LocalStore{
+		config: config,
 	}
 }
 
-func (c RetainClient) GetDirectoryPath() string {
-	return c.dirPath
+func (c LocalStore) Name() string {
+	return LocalStoreName
 }
 
-func (c RetainClient) Check(pattern string) error {
-	if c.config.Path == "" {
-		log.Print("Path was empty so skipping Retain check")
-		return nil
-	}
+func (c LocalStore) MaxBytes() int64 {
+	return int64(c.config.MaxBytes)
+}
 
-	if c.days == 0 {
-		log.Print("Days was 0 so skipping Retain check")
-		return nil
-	}
+func (c LocalStore) UsedBytes() (int64, error) {
+	used := int64(0)
 
-	// Check the number of files
-	files, err := c.CountFiles(pattern, c.dirPath)
+	root, err := common.ReplaceAllConfigVariables(c.config.Path)
 	if err != nil {
-		return err
+		return used, err
 	}
 
-	if files == 0 {
-		log.Print("No files found that matches the pattern.")
-		return nil
-	}
+	err = filepath.WalkDir(root, func(path string, item fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil || item.IsDir() {
+			return err
+		}
 
-	if files <= c.days {
-		log.Print("Not enough files in the directory to remove ")
+		info, err := item.Info()
+		if err != nil {
+			return err
+		}
+		used = used + info.Size()
 		return nil
-	}
+	})
+	return used, err
+}
 
-	// Find the oldest file to remove
-	file, err := c.FindOldestFile(pattern, c.dirPath)
-	if err != nil {
-		return nil
-	}
+// Returns the folder that holds the backups for the container.
+func (c LocalStore) GetDirectoryPath(container string) (string, error) {
+	return common.ReplaceAllConfigVariables(filepath.Join(c.config.Path, container))
+}
 
-	// build the path to the file based on what we know.
-	backupFile := fmt.Sprintf("%v/%v", c.dirPath, file.Name())
+func (c LocalStore) ListBackups(container string) ([]domain.BackupFile, error) {
+	var files []domain.BackupFile
 
-	// confirm we have a file the exists
-	_, err = os.Stat(backupFile)
+	dir, err := c.GetDirectoryPath(container)
 	if err != nil {
-		return err
+		return files, err
 	}
 
-	log.Printf("> Removing: %v", backupFile)
-	err = os.Remove(backupFile)
-	if err != nil {
-		return err
+	items, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return files, nil
 	}
-
-	return nil
-}
-
-func (c RetainClient) FindOldestFile(pattern, path string) (fs.FileInfo, error) {
-	var oldest fs.FileInfo
-
-	files, err := os.ReadDir(path)
 	if err != nil {
-		return oldest, err
+		return files, err
 	}
 
-	for _, file := range files {
-		name := file.Name()
-		if !strings.Contains(name, pattern) {
+	// Everything is listed so the caller can report files it does not own
+	for _, item := range items {
+		if item.IsDir() || strings.HasSuffix(item.Name(), domain.BackupManifestExtension) {
 			continue
 		}
 
-		details, err := file.Info()
+		info, err := item.Info()
 		if err != nil {
-			return oldest, err
+			return files, err
 		}
 
-		// If we don't have anything stored yet, grab the first one.
-		if oldest == nil {
-			oldest = details
-			continue
+		file := domain.BackupFile{
+			Name:      item.Name(),
+			Path:      filepath.Join(dir, item.Name()),
+			Container: container,
+			Size:      info.Size(),
 		}
 
-		if details.ModTime().Before(oldest.ModTime()) {
-			oldest = details
+		manifest, err := ReadManifest(file.Path)
+		if err == nil {
+			file.Manifest = &manifest
+			file.CreatedAt = manifest.CreatedAt
 		}
+
+		files = append(files, file)
 	}
 
-	return oldest, nil
+	return files, nil
 }
 
-func (c RetainClient) CountFiles(pattern, path string) (int, error) {
-	found := 0
-
-	dir, err := os.ReadDir(path)
+func (c LocalStore) DeleteBackup(file domain.BackupFile) error {
+	err := os.Remove(file.Path)
 	if err != nil {
-		return found, err
+		return err
 	}
 
-	for _, item := range dir {
-		if strings.Contains(item.Name(), pattern) {
-			found = found + 1
-		}
+	err = os.Remove(ManifestPath(file.Path))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
+
+func (c LocalStore) WriteManifest(file domain.BackupFile, manifest domain.BackupManifest) error {
+	// A manifest without its backup would look like a backup that is still there
+	_, err := os.Stat(file.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return errors.New(ErrBackupMissing)
+	}
+	if err != nil {
+		return err
 	}
 
-	return found, nil
+	return WriteManifest(file.Path, manifest)
 }
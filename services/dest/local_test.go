@@ -1,49 +1,214 @@
 package dest_test
 
 import (
-	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/jtom38/dvb/domain"
 	"github.com/jtom38/dvb/services/dest"
 )
 
-func TestLocalRetainCountFiles(t *testing.T) {
-	config := domain.ConfigDestLocal{
-		Path: "/Users/jamestombleson",
+// Creates a fake backup in the container folder and returns the path to it.
+func createBackup(t *testing.T, dir, name string, manifest *domain.BackupManifest) string {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	c := dest.NewLocalRetainClient(config, "webdav", 1)
-	_, err := c.CountFiles("retain", "/Users/jamestombleson")
+	p := filepath.Join(dir, name)
+	err = os.WriteFile(p, []byte(name), 0644)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
+
+	if manifest != nil {
+		err = dest.WriteManifest(p, *manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return p
 }
 
-func TestLocalRetainFindOldest(t *testing.T) {
-	config := domain.ConfigDestLocal{
-		Path: "/Users/jamestombleson",
+func TestLocalStoreListBackups(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "webdav")
+	created := time.Date(2022, 12, 1, 3, 0, 0, 0, time.UTC)
+
+	createBackup(t, dir, "data-20221130.0.tar", nil)
+	createBackup(t, dir, "data.tar", &domain.BackupManifest{Container: "webdav", CreatedAt: created})
+	createBackup(t, dir, "notes.txt", nil)
+
+	store := dest.NewLocalStore(domain.ConfigDestLocal{Path: root})
+	files, err := store.ListBackups("webdav")
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	c := dest.NewLocalRetainClient(config, "webdav", 1)
-	oldest, err := c.FindOldestFile(".go", "/Users/jamestombleson")
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files but found %v", len(files))
+	}
+
+	// The name can only be read once the pattern is known
+	for _, file := range files {
+		if file.Name != "data.tar" && !file.CreatedAt.IsZero() {
+			t.Errorf("expected %v to not have a time without a manifest", file.Name)
+		}
+		if file.Name == "data.tar" && !file.CreatedAt.Equal(created) {
+			t.Errorf("expected the manifest time to be used but got %v", file.CreatedAt)
+		}
+	}
+}
+
+func TestLocalStoreWriteManifestMissingBackup(t *testing.T) {
+	root := t.TempDir()
+	store := dest.NewLocalStore(domain.ConfigDestLocal{Path: root})
+	file := domain.BackupFile{Name: "data-20221201.0.tar", Path: filepath.Join(root, "webdav", "data-20221201.0.tar")}
+
+	// Retention removed the backup after it was listed
+	err := store.WriteManifest(file, domain.BackupManifest{Pinned: true})
+	if err == nil || err.Error() != dest.ErrBackupMissing {
+		t.Errorf("expected %v but got %v", dest.ErrBackupMissing, err)
+	}
+
+	_, err = os.Stat(dest.ManifestPath(file.Path))
+	if err == nil {
+		t.Error("expected no manifest to be written")
+	}
+}
+
+func TestLocalStoreListBackupsMissingFolder(t *testing.T) {
+	store := dest.NewLocalStore(domain.ConfigDestLocal{Path: t.TempDir()})
+	files, err := store.ListBackups("webdav")
 	if err != nil {
 		t.Error(err)
 	}
-	fmt.Printf("oldest: %v\n", oldest)
+
+	if len(files) != 0 {
+		t.Errorf("expected no backups but found %v", len(files))
+	}
+}
+
+func TestLocalRetainApply(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "webdav")
+
+	oldest := createBackup(t, dir, "data-20221129.0.tar", nil)
+	createBackup(t, dir, "data-20221130.0.tar", nil)
+	createBackup(t, dir, "data-20221201.0.tar", nil)
+
+	c := dest.NewRetainClient(dest.RetainParams{
+		Store:         dest.NewLocalStore(domain.ConfigDestLocal{Path: root}),
+		Policy:        domain.ConfigRetain{KeepLast: 2},
+		ContainerName: "webdav",
+		Hostname:      "docker-01",
+		Pattern:       "data-{{DATE}}",
+	})
+	result, err := c.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 1 {
+		t.Fatalf("expected 1 backup to be removed but got %v", len(result.Removed))
+	}
+
+	_, err = os.Stat(oldest)
+	if err == nil {
+		t.Error("the oldest backup was not removed")
+	}
 }
 
-func TestLocalRetainCheck(t *testing.T) {
-	config := domain.ConfigDestLocal{
-		Path: "/Users/jamestombleson",
+func TestLocalRetainIgnoresForeignFiles(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "webdav")
+	created := time.Date(2022, 11, 1, 0, 0, 0, 0, time.UTC)
+
+	foreign := []string{
+		// dropped in by hand
+		createBackup(t, dir, "manual-20221101.tar", nil),
+		// made by dvb on another host sharing the NAS
+		createBackup(t, dir, "data-20221102.0.tar", &domain.BackupManifest{
+			Container: "webdav",
+			Host:      "docker-02",
+			FileName:  "data-20221102.0.tar",
+			CreatedAt: created,
+		}),
+		createBackup(t, dir, "notes.txt", nil),
+		// matches the pattern but is not a date
+		createBackup(t, dir, "data-20221340.0.tar", nil),
 	}
+	owned := createBackup(t, dir, "latest.tar", &domain.BackupManifest{
+		Container: "webdav",
+		Host:      "docker-01",
+		FileName:  "latest.tar",
+		CreatedAt: created,
+	})
+	createBackup(t, dir, "data-20221201.0.tar", nil)
 
-	c := dest.NewLocalRetainClient(config, "webdav", 1)
-	err := c.Check(".go")
+	c := dest.NewRetainClient(dest.RetainParams{
+		Store:         dest.NewLocalStore(domain.ConfigDestLocal{Path: root}),
+		Policy:        domain.ConfigRetain{KeepLast: 1},
+		ContainerName: "webdav",
+		Hostname:      "docker-01",
+		Pattern:       "data-{{DATE}}",
+	})
+	result, err := c.Apply()
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+
+	if len(result.Foreign) != len(foreign) {
+		t.Errorf("expected %v foreign files but got %v", len(foreign), len(result.Foreign))
+	}
+
+	for _, p := range foreign {
+		_, err = os.Stat(p)
+		if err != nil {
+			t.Errorf("foreign file was removed: %v", p)
+		}
+	}
+
+	_, err = os.Stat(owned)
+	if err == nil {
+		t.Error("the older backup made by this host was not removed")
+	}
+
+	_, err = os.Stat(dest.ManifestPath(owned))
+	if err == nil {
+		t.Error("the manifest was left behind")
+	}
+}
+
+func TestLocalRetainDryRun(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "webdav")
+
+	oldest := createBackup(t, dir, "data-20221129.0.tar", nil)
+	createBackup(t, dir, "data-20221130.0.tar", nil)
+
+	c := dest.NewRetainClient(dest.RetainParams{
+		Store:         dest.NewLocalStore(domain.ConfigDestLocal{Path: root}),
+		Policy:        domain.ConfigRetain{KeepLast: 1},
+		ContainerName: "webdav",
+		Pattern:       "data-{{DATE}}",
+		DryRun:        true,
+	})
+	result, err := c.Apply()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 1 {
+		t.Errorf("expected 1 backup to be reported but got %v", len(result.Removed))
+	}
+
+	_, err = os.Stat(oldest)
+	if err != nil {
+		t.Error("the dry run removed a backup")
 	}
 }
 
@@ -69,3 +234,55 @@ func TestLocalMove(t *testing.T) {
 	os.Remove(filepath.Join("test-container", "fake.tar"))
 	os.Remove("test-container")
 }
+
+func TestLocalMoveRetry(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "webdav-20221201030500.tar")
+	err := os.WriteFile(source, []byte("backup"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	details := domain.RunDetails{ContainerName: "webdav"}
+	details.Backup.FullFilePath = source
+	details.Dest.Local.Directory = filepath.Join(root, "webdav")
+	details.Dest.Local.FullFilePath = filepath.Join(root, "webdav", "webdav-20221201030500.tar")
+	c := dest.NewMoveClient("webdav", source, "webdav", root)
+
+	// A copy that is complete but has no manifest and one that was cut short are both moved again
+	for _, left := range []string{"backup", "back"} {
+		os.Remove(dest.ManifestPath(details.Dest.Local.FullFilePath))
+		createBackup(t, details.Dest.Local.Directory, "webdav-20221201030500.tar", nil)
+		err = os.WriteFile(details.Dest.Local.FullFilePath, []byte(left), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = c.Move(details)
+		if err != nil {
+			t.Fatalf("expected the move of %q to be tried again but got %v", left, err)
+		}
+
+		manifest, err := dest.ReadManifest(details.Dest.Local.FullFilePath)
+		if err != nil || manifest.Size != 6 {
+			t.Fatalf("expected a manifest for the whole backup but got %+v, %v", manifest, err)
+		}
+		content, _ := os.ReadFile(details.Dest.Local.FullFilePath)
+		if string(content) != "backup" {
+			t.Errorf("expected the backup to be copied but got %q", content)
+		}
+	}
+
+	// The staging file could not be removed after the last try
+	err = c.Move(details)
+	if err != nil {
+		t.Fatalf("expected the finished move to be accepted but got %v", err)
+	}
+
+	// A different backup with the same name is not replaced
+	createBackup(t, details.Dest.Local.Directory, "webdav-20221201030500.tar", &domain.BackupManifest{Container: "webdav"})
+	err = c.Move(details)
+	if err == nil || err.Error() != dest.ErrMoveDestinationExists {
+		t.Errorf("expected %v but got %v", dest.ErrMoveDestinationExists, err)
+	}
+}
@@ -0,0 +1,47 @@
+package dest
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+// Returns the path of the manifest that belongs to a backup file.
+func ManifestPath(backupPath string) string {
+	return backupPath + domain.BackupManifestExtension
+}
+
+// Reads the manifest that sits next to the backup file.
+func ReadManifest(backupPath string) (domain.BackupManifest, error) {
+	var manifest domain.BackupManifest
+
+	content, err := os.ReadFile(ManifestPath(backupPath))
+	if err != nil {
+		return manifest, err
+	}
+
+	err = json.Unmarshal(content, &manifest)
+	if err != nil {
+		return manifest, err
+	}
+
+	return manifest, nil
+}
+
+// Writes the manifest next to the backup file, replacing any that already exists.
+func WriteManifest(backupPath string, manifest domain.BackupManifest) error {
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file first so a failed write does not leave a broken manifest behind
+	tmp := ManifestPath(backupPath) + ".tmp"
+	err = os.WriteFile(tmp, content, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, ManifestPath(backupPath))
+}
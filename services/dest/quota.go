@@ -0,0 +1,182 @@
+package dest
+
+import (
+	"fmt"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	ErrRetainQuotaExceeded = "the backup does not fit within the quota without breaking the MinKeep rule"
+)
+
+// Describes a container that stores backups on the destination.
+type QuotaContainer struct {
+	Name    string
+	Pattern string
+	MinKeep int
+
+	// The most space the backups of the container can use, 0 means no limit.
+	MaxBytes int64
+}
+
+type QuotaParams struct {
+	Store    domain.BackupStore
+	Hostname string
+
+	// The container the new backup belongs to.
+	Container QuotaContainer
+
+	// Every container that stores backups on the destination, used to check the destination quota.
+	Containers []QuotaContainer
+
+	// When true, nothing is removed and the backups that would be removed are reported.
+	DryRun bool
+
+	// Defaults to logger.Default.
+	Logger *logger.Logger
+}
+
+// The quota client removes the oldest backups to make room for a new backup.
+type QuotaClient struct {
+	params QuotaParams
+}
+
+func NewQuotaClient(params QuotaParams) *QuotaClient {
+	if params.Logger == nil {
+		params.Logger = logger.Default()
+	}
+	return &QuotaClient{
+		params: params,
+	}
+}
+
+type quotaGroup struct {
+	used int64
+
+	// Backups that can be removed, oldest first.
+	eligible []domain.BackupFile
+}
+
+// Removes the oldest eligible backups until a new backup of the given size fits.
+// If the backup can't fit without breaking the MinKeep rule nothing is removed and an error is returned.
+func (c QuotaClient) MakeRoom(size int64) (RetainResult, error) {
+	var result RetainResult
+
+	destMax := c.params.Store.MaxBytes()
+	if c.params.Container.MaxBytes <= 0 && destMax <= 0 {
+		return result, nil
+	}
+
+	containers := c.params.Containers
+	if !c.hasContainer(containers, c.params.Container.Name) {
+		containers = append(containers, c.params.Container)
+	}
+
+	groups := make(map[string]*quotaGroup)
+	for _, container := range containers {
+		owned, foreign, err := ListOwnedBackups(c.params.Store, container.Name, c.params.Hostname, container.Pattern)
+		if err != nil {
+			return result, err
+		}
+		result.Foreign = append(result.Foreign, foreign...)
+
+		sortNewestFirst(owned)
+		group := &quotaGroup{}
+		for i, backup := range owned {
+			group.used = group.used + backup.Size
+			if i < container.MinKeep || backup.CreatedAt.IsZero() || backup.IsPinned() {
+				continue
+			}
+			group.eligible = append([]domain.BackupFile{backup}, group.eligible...)
+		}
+		groups[container.Name] = group
+	}
+
+	// First make sure the container fits within its own limit
+	if max := c.params.Container.MaxBytes; max > 0 {
+		group := groups[c.params.Container.Name]
+		for group.used+size > max {
+			if len(group.eligible) == 0 {
+				return RetainResult{}, c.quotaError(c.params.Container.Name, size, group.used, max)
+			}
+			c.take(group, &result)
+		}
+	}
+
+	// Then check the total for the destination, the oldest backup of any container goes first
+	// Foreign files, manifests and the backups of other hosts use the same space, so the whole destination counts
+	if destMax > 0 {
+		total, err := c.params.Store.UsedBytes()
+		if err != nil {
+			return RetainResult{}, err
+		}
+		total = total - result.FreedBytes
+
+		for total+size > destMax {
+			oldest := c.oldestGroup(groups)
+			if oldest == nil {
+				return RetainResult{}, c.quotaError(c.params.Store.Name(), size, total, destMax)
+			}
+			total = total - oldest.eligible[0].Size
+			c.take(oldest, &result)
+		}
+	}
+
+	log := c.params.Logger.With("destination", c.params.Store.Name())
+	for _, backup := range result.Removed {
+		if c.params.DryRun {
+			log.Info("Would remove a backup to make room", "file", backup.Name)
+			continue
+		}
+
+		log.Info("Removing a backup to make room", "file", backup.Name)
+		err := c.params.Store.DeleteBackup(backup)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// Marks the oldest eligible backup in the group for removal.
+func (c QuotaClient) take(group *quotaGroup, result *RetainResult) {
+	backup := group.eligible[0]
+	group.eligible = group.eligible[1:]
+	group.used = group.used - backup.Size
+
+	result.Removed = append(result.Removed, backup)
+	result.FreedBytes = result.FreedBytes + backup.Size
+}
+
+func (c QuotaClient) oldestGroup(groups map[string]*quotaGroup) *quotaGroup {
+	var oldest *quotaGroup
+
+	for _, group := range groups {
+		if len(group.eligible) == 0 {
+			continue
+		}
+
+		if oldest == nil || group.eligible[0].CreatedAt.Before(oldest.eligible[0].CreatedAt) {
+			oldest = group
+		}
+	}
+
+	return oldest
+}
+
+func (c QuotaClient) hasContainer(containers []QuotaContainer, name string) bool {
+	for _, container := range containers {
+		if container.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (c QuotaClient) quotaError(scope string, size, used, max int64) error {
+	return fmt.Errorf("%v (%v): the backup needs %v and %v of %v is still in use", ErrRetainQuotaExceeded, scope, common.FormatBytes(size), common.FormatBytes(used), common.FormatBytes(max))
+}
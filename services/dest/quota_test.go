@@ -0,0 +1,158 @@
+package dest_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/dest"
+)
+
+// Creates a backup with the requested size in bytes.
+func createSizedBackup(t *testing.T, dir, name string, size int) string {
+	p := createBackup(t, dir, name, nil)
+	err := os.WriteFile(p, make([]byte, size), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestQuotaContainerMaxBytes(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "webdav")
+
+	oldest := createSizedBackup(t, dir, "data-20221129.0.tar", 40)
+	createSizedBackup(t, dir, "data-20221130.0.tar", 40)
+	createSizedBackup(t, dir, "data-20221201.0.tar", 40)
+
+	c := dest.NewQuotaClient(dest.QuotaParams{
+		Store: dest.NewLocalStore(domain.ConfigDestLocal{Path: root}),
+		Container: dest.QuotaContainer{
+			Name:     "webdav",
+			Pattern:  "data-{{DATE}}",
+			MinKeep:  1,
+			MaxBytes: 150,
+		},
+	})
+	result, err := c.MakeRoom(40)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 1 || result.FreedBytes != 40 {
+		t.Fatalf("expected 1 backup to be removed but got %v", len(result.Removed))
+	}
+
+	_, err = os.Stat(oldest)
+	if err == nil {
+		t.Error("the oldest backup was not removed")
+	}
+}
+
+func TestQuotaMinKeep(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "webdav")
+
+	oldest := createSizedBackup(t, dir, "data-20221130.0.tar", 40)
+	createSizedBackup(t, dir, "data-20221201.0.tar", 40)
+
+	c := dest.NewQuotaClient(dest.QuotaParams{
+		Store: dest.NewLocalStore(domain.ConfigDestLocal{Path: root}),
+		Container: dest.QuotaContainer{
+			Name:     "webdav",
+			Pattern:  "data-{{DATE}}",
+			MinKeep:  1,
+			MaxBytes: 50,
+		},
+	})
+	_, err := c.MakeRoom(40)
+	if err == nil || !strings.Contains(err.Error(), dest.ErrRetainQuotaExceeded) {
+		t.Fatalf("expected the quota error but got %v", err)
+	}
+
+	// Nothing should be removed if the backup can't fit
+	_, err = os.Stat(oldest)
+	if err != nil {
+		t.Error("a backup was removed even though the new backup does not fit")
+	}
+}
+
+func TestQuotaDestinationMaxBytes(t *testing.T) {
+	root := t.TempDir()
+
+	oldest := createSizedBackup(t, filepath.Join(root, "app-db"), "db-20221128.0.tar", 30)
+	createSizedBackup(t, filepath.Join(root, "app-db"), "db-20221201.0.tar", 30)
+	createSizedBackup(t, filepath.Join(root, "webdav"), "data-20221129.0.tar", 30)
+	createSizedBackup(t, filepath.Join(root, "webdav"), "data-20221130.0.tar", 30)
+
+	webdav := dest.QuotaContainer{Name: "webdav", Pattern: "data-{{DATE}}"}
+	c := dest.NewQuotaClient(dest.QuotaParams{
+		Store:     dest.NewLocalStore(domain.ConfigDestLocal{Path: root, MaxBytes: 130}),
+		Container: webdav,
+		Containers: []dest.QuotaContainer{
+			webdav,
+			{Name: "app-db", Pattern: "db-{{DATE}}", MinKeep: 1},
+		},
+	})
+	result, err := c.MakeRoom(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 1 || result.Removed[0].Name != "db-20221128.0.tar" {
+		t.Fatalf("expected the oldest backup on the destination to be removed: %+v", result.Removed)
+	}
+
+	_, err = os.Stat(oldest)
+	if err == nil {
+		t.Error("the oldest backup was not removed")
+	}
+}
+
+func TestQuotaNoLimits(t *testing.T) {
+	root := t.TempDir()
+	createSizedBackup(t, filepath.Join(root, "webdav"), "data-20221129.0.tar", 30)
+
+	c := dest.NewQuotaClient(dest.QuotaParams{
+		Store:     dest.NewLocalStore(domain.ConfigDestLocal{Path: root}),
+		Container: dest.QuotaContainer{Name: "webdav", Pattern: "data-{{DATE}}"},
+	})
+	result, err := c.MakeRoom(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 0 {
+		t.Errorf("expected nothing to be removed but got %v", len(result.Removed))
+	}
+}
+
+func TestQuotaDestinationCountsForeignFiles(t *testing.T) {
+	root := t.TempDir()
+
+	oldest := createSizedBackup(t, filepath.Join(root, "webdav"), "data-20221129.0.tar", 30)
+	createSizedBackup(t, filepath.Join(root, "webdav"), "data-20221130.0.tar", 30)
+	createSizedBackup(t, filepath.Join(root, "other-host"), "export.tar", 50)
+
+	webdav := dest.QuotaContainer{Name: "webdav", Pattern: "data-{{DATE}}"}
+	c := dest.NewQuotaClient(dest.QuotaParams{
+		Store:     dest.NewLocalStore(domain.ConfigDestLocal{Path: root, MaxBytes: 130}),
+		Container: webdav,
+	})
+	result, err := c.MakeRoom(30)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Removed) != 1 || result.Removed[0].Name != "data-20221129.0.tar" {
+		t.Fatalf("expected the foreign file to count towards the quota: %+v", result.Removed)
+	}
+
+	_, err = os.Stat(oldest)
+	if err == nil {
+		t.Error("the oldest backup was not removed")
+	}
+}
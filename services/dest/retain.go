@@ -0,0 +1,327 @@
+package dest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+// Reads the time a backup was made from the {{DATE}} in a name that matched BackupNameRegex.
+// Digits that are not a real date are not a time.
+func ParseBackupTime(name string, names *regexp.Regexp) (time.Time, bool) {
+	if names == nil {
+		return time.Time{}, false
+	}
+
+	match := names.FindStringSubmatch(name)
+	if len(match) < 2 {
+		return time.Time{}, false
+	}
+
+	t, err := time.ParseInLocation("20060102", match[1], time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return t, true
+}
+
+// Describes if a backup will be kept and the rules that wanted it.
+type RetainDecision struct {
+	Backup  domain.BackupFile
+	Keep    bool
+	Reasons []string
+}
+
+func (d RetainDecision) String() string {
+	if !d.Keep {
+		return fmt.Sprintf("remove %v", d.Backup.Name)
+	}
+	return fmt.Sprintf("keep %v (%v)", d.Backup.Name, strings.Join(d.Reasons, ", "))
+}
+
+type retainRule struct {
+	name  string
+	count int
+	key   func(t time.Time) string
+}
+
+// Decides what backups to keep based on the policy.
+// The decisions are returned newest first and are based on the time the backup was made, not the file mtime.
+func EvaluateRetain(policy domain.ConfigRetain, backups []domain.BackupFile) []RetainDecision {
+	sorted := append([]domain.BackupFile(nil), backups...)
+	sortNewestFirst(sorted)
+
+	decisions := make([]RetainDecision, len(sorted))
+	for i, backup := range sorted {
+		decisions[i] = RetainDecision{Backup: backup}
+	}
+
+	if !policy.IsEnabled() {
+		for i := range decisions {
+			decisions[i].keep("no retention rules")
+		}
+		return decisions
+	}
+
+	keepLast := policy.KeepLast
+	if keepLast == 0 {
+		keepLast = policy.Days
+	}
+
+	rules := []retainRule{
+		{name: "last", count: keepLast, key: func(t time.Time) string { return "" }},
+		{name: "daily", count: policy.KeepDaily, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{name: "weekly", count: policy.KeepWeekly, key: func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%04d-W%02d", year, week)
+		}},
+		{name: "monthly", count: policy.KeepMonthly, key: func(t time.Time) string { return t.Format("2006-01") }},
+		{name: "yearly", count: policy.KeepYearly, key: func(t time.Time) string { return t.Format("2006") }},
+	}
+
+	for _, rule := range rules {
+		if rule.count <= 0 {
+			continue
+		}
+
+		kept := 0
+		lastKey := ""
+		for i := range decisions {
+			if kept >= rule.count {
+				break
+			}
+
+			// Pinned backups are always kept so they don't use up a slot
+			created := decisions[i].Backup.CreatedAt
+			if created.IsZero() || decisions[i].Backup.IsPinned() {
+				continue
+			}
+
+			// The last rule keeps every backup, the others keep the newest backup in each period
+			if rule.name == "last" {
+				decisions[i].keep(fmt.Sprintf("last %v", kept+1))
+				kept = kept + 1
+				continue
+			}
+
+			key := rule.key(created.Local())
+			if key == lastKey {
+				continue
+			}
+			lastKey = key
+			decisions[i].keep(fmt.Sprintf("%v %v", rule.name, key))
+			kept = kept + 1
+		}
+	}
+
+	// Pinned backups and backups we cannot date are never removed
+	for i := range decisions {
+		if decisions[i].Backup.IsPinned() {
+			decisions[i].keep("pinned")
+		}
+		if decisions[i].Backup.CreatedAt.IsZero() {
+			decisions[i].keep("unknown creation time")
+		}
+	}
+
+	return decisions
+}
+
+func (d *RetainDecision) keep(reason string) {
+	d.Keep = true
+	d.Reasons = append(d.Reasons, reason)
+}
+
+// Builds the strict regex a file name must match to be treated as a backup dvb made from the tar pattern.
+// Every {{DATE}} is a group, the first one is the date ParseBackupTime reads.
+func BackupNameRegex(pattern string) (*regexp.Regexp, error) {
+	parts := strings.Split(pattern, common.ConfigVariableDate)
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return regexp.Compile(fmt.Sprintf(`^%v\.\d+\.tar$`, strings.Join(parts, `(\d{8})`)))
+}
+
+// Checks if dvb on this host made the backup for the container.
+// Backups with a manifest are checked against the manifest.
+// The others can not be tied to a host, they are only owned when names is set and matches with a real date.
+func IsOwnedBackup(file domain.BackupFile, container, hostname string, names *regexp.Regexp) bool {
+	if file.Manifest != nil {
+		return file.Manifest.Container == container &&
+			file.Manifest.Host == hostname &&
+			file.Manifest.FileName == file.Name
+	}
+
+	_, ok := ParseBackupTime(file.Name, names)
+	return ok
+}
+
+// Splits the files on the destination into the backups dvb owns and foreign files.
+func ListOwnedBackups(store domain.BackupStore, container, hostname, pattern string) ([]domain.BackupFile, []domain.BackupFile, error) {
+	var (
+		owned   []domain.BackupFile
+		foreign []domain.BackupFile
+		names   *regexp.Regexp
+		err     error
+	)
+
+	if pattern != "" {
+		names, err = BackupNameRegex(pattern)
+		if err != nil {
+			return owned, foreign, err
+		}
+	}
+
+	files, err := store.ListBackups(container)
+	if err != nil {
+		return owned, foreign, err
+	}
+
+	for _, file := range files {
+		if IsOwnedBackup(file, container, hostname, names) {
+			// Without a manifest the name is the only record of when the backup was made
+			if file.Manifest == nil {
+				file.CreatedAt, _ = ParseBackupTime(file.Name, names)
+			}
+			owned = append(owned, file)
+			continue
+		}
+		foreign = append(foreign, file)
+	}
+
+	return owned, foreign, nil
+}
+
+// The counter dvb adds before the extension when a backup of the same name already exists.
+var backupCounterRegex = regexp.MustCompile(`\.(\d+)\.tar$`)
+
+// Returns the counter in the name of the backup, or -1 when it does not have one.
+func backupCounter(name string) int {
+	match := backupCounterRegex.FindStringSubmatch(name)
+	if match == nil {
+		return -1
+	}
+
+	counter, err := strconv.Atoi(match[1])
+	if err != nil {
+		return -1
+	}
+	return counter
+}
+
+// Sorts the backups with the newest first.
+// Backups made on the same day without a manifest share a time, the higher counter was made last.
+func sortNewestFirst(backups []domain.BackupFile) {
+	sort.SliceStable(backups, func(i, j int) bool {
+		a, b := backups[i], backups[j]
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+
+		counterA, counterB := backupCounter(a.Name), backupCounter(b.Name)
+		if counterA != counterB {
+			return counterA > counterB
+		}
+		return a.Name > b.Name
+	})
+}
+
+type RetainParams struct {
+	Store         domain.BackupStore
+	Policy        domain.ConfigRetain
+	ContainerName string
+
+	// Used to only touch backups that this host made.
+	Hostname string
+
+	// Backups without a manifest are only owned when they match this pattern, leave it empty to ignore them.
+	Pattern string
+
+	// When true, nothing is removed and the decisions are only reported.
+	DryRun bool
+
+	// Defaults to logger.Default.
+	Logger *logger.Logger
+}
+
+type RetainResult struct {
+	Decisions []RetainDecision
+
+	// Files in the destination that dvb did not make, these are never touched.
+	Foreign []domain.BackupFile
+
+	// During a dry run this holds the backups that would have been removed.
+	Removed    []domain.BackupFile
+	FreedBytes int64
+}
+
+// The retain client applies the retention policy to any destination that can list and delete backups.
+type RetainClient struct {
+	params RetainParams
+}
+
+func NewRetainClient(params RetainParams) *RetainClient {
+	if params.Logger == nil {
+		params.Logger = logger.Default()
+	}
+	return &RetainClient{
+		params: params,
+	}
+}
+
+// Returns what would happen to each backup without changing anything.
+func (c RetainClient) Plan() (RetainResult, error) {
+	var result RetainResult
+
+	owned, foreign, err := ListOwnedBackups(c.params.Store, c.params.ContainerName, c.params.Hostname, c.params.Pattern)
+	if err != nil {
+		return result, err
+	}
+
+	result.Foreign = foreign
+	result.Decisions = EvaluateRetain(c.params.Policy, owned)
+	return result, nil
+}
+
+// Removes the backups that are not wanted by any rule.
+func (c RetainClient) Apply() (RetainResult, error) {
+	result, err := c.Plan()
+	if err != nil {
+		return result, err
+	}
+
+	log := c.params.Logger.With("destination", c.params.Store.Name())
+	for _, file := range result.Foreign {
+		log.Debug("Ignoring a foreign file", "file", file.Name)
+	}
+
+	for _, decision := range result.Decisions {
+		if decision.Keep {
+			log.Debug("Keeping a backup", "file", decision.Backup.Name, "reason", strings.Join(decision.Reasons, ", "))
+			continue
+		}
+
+		if c.params.DryRun {
+			log.Info("Would remove a backup", "file", decision.Backup.Name)
+		} else {
+			log.Info("Removing a backup", "file", decision.Backup.Name)
+			err = c.params.Store.DeleteBackup(decision.Backup)
+			if err != nil {
+				return result, err
+			}
+		}
+		result.Removed = append(result.Removed, decision.Backup)
+		result.FreedBytes = result.FreedBytes + decision.Backup.Size
+	}
+
+	return result, nil
+}
@@ -0,0 +1,182 @@
+package dest_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/dest"
+)
+
+// Generates one backup per day going back from the start date.
+func dailyBackups(start time.Time, days int) []domain.BackupFile {
+	var files []domain.BackupFile
+	for i := 0; i < days; i++ {
+		created := start.AddDate(0, 0, -i)
+		files = append(files, domain.BackupFile{
+			Name:      fmt.Sprintf("data-%v.0.tar", created.Format("20060102")),
+			CreatedAt: created,
+		})
+	}
+	return files
+}
+
+func keptNames(decisions []dest.RetainDecision) map[string]bool {
+	kept := make(map[string]bool)
+	for _, decision := range decisions {
+		if decision.Keep {
+			kept[decision.Backup.Name] = true
+		}
+	}
+	return kept
+}
+
+func TestParseBackupTime(t *testing.T) {
+	names, err := dest.BackupNameRegex("app-db-v12345678-{{DATE}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the digits where the pattern has {{DATE}} are read
+	created, ok := dest.ParseBackupTime("app-db-v12345678-20221201.3.tar", names)
+	if !ok {
+		t.Fatal("expected the date to be found")
+	}
+	if created.Format("20060102") != "20221201" {
+		t.Errorf("unexpected date %v", created)
+	}
+
+	for _, name := range []string{"manual.tar", "app-db-v12345678-20221399.0.tar", "app-db-v12345678-99999999.0.tar"} {
+		_, ok = dest.ParseBackupTime(name, names)
+		if ok {
+			t.Errorf("%v: expected no date to be found", name)
+		}
+	}
+
+	_, ok = dest.ParseBackupTime("app-db-v12345678-20221201.3.tar", nil)
+	if ok {
+		t.Error("expected no date to be found without a pattern")
+	}
+}
+
+func TestBackupNameRegex(t *testing.T) {
+	names, err := dest.BackupNameRegex("app-db-{{DATE}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := map[string]bool{
+		"app-db-20221201.0.tar":     true,
+		"app-db-20221201.12.tar":    true,
+		"app-db-20221201.tar":       false,
+		"app-db-2022120.0.tar":      false,
+		"old-app-db-20221201.0.tar": false,
+		"app-db-20221201.0.tar.bak": false,
+	}
+	for name, expected := range matches {
+		if names.MatchString(name) != expected {
+			t.Errorf("%v: expected match to be %v", name, expected)
+		}
+	}
+}
+
+func TestEvaluateRetainNoRules(t *testing.T) {
+	backups := dailyBackups(time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local), 5)
+	kept := keptNames(dest.EvaluateRetain(domain.ConfigRetain{}, backups))
+	if len(kept) != 5 {
+		t.Errorf("expected everything to be kept but got %v", len(kept))
+	}
+}
+
+func TestEvaluateRetainDaysIsKeepLast(t *testing.T) {
+	backups := dailyBackups(time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local), 5)
+	kept := keptNames(dest.EvaluateRetain(domain.ConfigRetain{Days: 2}, backups))
+	if len(kept) != 2 {
+		t.Fatalf("expected 2 backups to be kept but got %v", len(kept))
+	}
+
+	if !kept["data-20221201.0.tar"] || !kept["data-20221130.0.tar"] {
+		t.Errorf("the newest backups were not kept: %v", kept)
+	}
+}
+
+func TestEvaluateRetainSameDayCounter(t *testing.T) {
+	// Backups without a manifest only have the day in their name
+	created := time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local)
+	backups := []domain.BackupFile{
+		{Name: "data-20221201.9.tar", CreatedAt: created},
+		{Name: "data-20221201.10.tar", CreatedAt: created},
+		{Name: "data-20221201.2.tar", CreatedAt: created},
+	}
+
+	kept := keptNames(dest.EvaluateRetain(domain.ConfigRetain{KeepLast: 1}, backups))
+	if len(kept) != 1 || !kept["data-20221201.10.tar"] {
+		t.Errorf("expected the backup with the highest counter to be kept but got %v", kept)
+	}
+}
+
+func TestEvaluateRetainGrandfatherFatherSon(t *testing.T) {
+	// Sunday the 1st of January 2023 going back a full year
+	backups := dailyBackups(time.Date(2023, 1, 1, 2, 0, 0, 0, time.Local), 400)
+	decisions := dest.EvaluateRetain(domain.ConfigRetain{
+		KeepDaily:   7,
+		KeepWeekly:  4,
+		KeepMonthly: 6,
+		KeepYearly:  3,
+	}, backups)
+	kept := keptNames(decisions)
+
+	expected := []string{
+		// daily
+		"data-20230101.0.tar", "data-20221231.0.tar", "data-20221226.0.tar",
+		// weekly, the newest backup of each ISO week
+		"data-20221225.0.tar", "data-20221218.0.tar", "data-20221211.0.tar",
+		// monthly
+		"data-20221130.0.tar", "data-20220831.0.tar",
+		// yearly
+		"data-20211231.0.tar",
+	}
+	for _, name := range expected {
+		if !kept[name] {
+			t.Errorf("expected %v to be kept", name)
+		}
+	}
+
+	if kept["data-20221201.0.tar"] {
+		t.Error("data-20221201.0.tar should have been removed")
+	}
+
+	// 7 daily + 3 more weeks + 4 more months + 1 more year
+	if len(kept) != 15 {
+		t.Errorf("expected 15 backups to be kept but got %v", len(kept))
+	}
+
+	if decisions[0].String() != "keep data-20230101.0.tar (daily 2023-01-01, weekly 2022-W52, monthly 2023-01, yearly 2023)" {
+		t.Errorf("unexpected reasons: %v", decisions[0])
+	}
+}
+
+func TestEvaluateRetainUnknownTimeIsKept(t *testing.T) {
+	backups := dailyBackups(time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local), 3)
+	backups = append(backups, domain.BackupFile{Name: "manual.tar"})
+
+	kept := keptNames(dest.EvaluateRetain(domain.ConfigRetain{KeepLast: 1}, backups))
+	if !kept["manual.tar"] {
+		t.Error("a backup without a known time was marked for removal")
+	}
+}
+
+func TestEvaluateRetainPinnedIsKept(t *testing.T) {
+	backups := dailyBackups(time.Date(2022, 12, 1, 0, 0, 0, 0, time.Local), 3)
+	backups[2].Manifest = &domain.BackupManifest{Pinned: true}
+
+	kept := keptNames(dest.EvaluateRetain(domain.ConfigRetain{KeepLast: 1}, backups))
+	if len(kept) != 2 {
+		t.Fatalf("expected 2 backups to be kept but got %v", len(kept))
+	}
+
+	if !kept[backups[0].Name] || !kept[backups[2].Name] {
+		t.Errorf("expected the newest and the pinned backup to be kept: %v", kept)
+	}
+}
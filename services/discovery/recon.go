@@ -42,6 +42,12 @@ func (c ReconClient) DockerScout(container domain.ContainerDocker) (*domain.RunD
 
 	// set the container name
 	res.ContainerName = container.Name
+	res.StartedAt = time.Now()
+
+	res.Hostname, err = os.Hostname()
+	if err != nil {
+		return &res, err
+	}
 
 	for {
 		backup, err = c.NewBackupDetails(container.Directory, container.Name, container.Tar.Directory)
@@ -0,0 +1,241 @@
+package history
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	HistoryFileName = "history.db"
+
+	// How many runs are kept when History.MaxRuns is not set.
+	DefaultMaxRuns = 1000
+
+	ErrRunNotFound = "the run was not found in the history"
+
+	// How long to wait for another dvb process to let go of the database.
+	openTimeout = 5 * time.Second
+)
+
+var (
+	runsBucket = []byte("runs")
+	idsBucket  = []byte("ids")
+)
+
+// Which runs List returns, the zero value returns everything.
+type Filter struct {
+	Job       string
+	Container string
+	Failed    bool
+	Since     time.Time
+	Limit     int
+}
+
+func (f Filter) match(record domain.RunRecord) bool {
+	if f.Job != "" && record.Job != f.Job {
+		return false
+	}
+	if f.Container != "" && record.Container != f.Container {
+		return false
+	}
+	if f.Failed && record.Success {
+		return false
+	}
+	if !f.Since.IsZero() && record.StartedAt.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// The history store keeps every finished run in a bbolt file in the state directory.
+// The file is only opened while it is used so the history command can read it while the daemon runs.
+type Store struct {
+	path    string
+	maxRuns int
+	maxAge  time.Duration
+}
+
+func NewStore(dir string, config domain.ConfigHistory) *Store {
+	maxRuns := config.MaxRuns
+	if maxRuns <= 0 {
+		maxRuns = DefaultMaxRuns
+	}
+
+	return &Store{
+		path:    filepath.Join(dir, HistoryFileName),
+		maxRuns: maxRuns,
+		maxAge:  time.Duration(config.MaxAge),
+	}
+}
+
+// Saves the run and removes any runs past MaxRuns or MaxAge.
+func (s *Store) Add(record domain.RunRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		runs, err := tx.CreateBucketIfNotExists(runsBucket)
+		if err != nil {
+			return err
+		}
+		ids, err := tx.CreateBucketIfNotExists(idsBucket)
+		if err != nil {
+			return err
+		}
+
+		key := runKey(record)
+		err = runs.Put(key, content)
+		if err != nil {
+			return err
+		}
+		err = ids.Put([]byte(record.Id), key)
+		if err != nil {
+			return err
+		}
+
+		return s.prune(runs, ids, time.Now())
+	})
+}
+
+// Returns the runs that match the filter, newest first.
+func (s *Store) List(filter Filter) ([]domain.RunRecord, error) {
+	records := []domain.RunRecord{}
+
+	err := s.view(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		if runs == nil {
+			return nil
+		}
+
+		cursor := runs.Cursor()
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			var record domain.RunRecord
+			err := json.Unmarshal(value, &record)
+			if err != nil {
+				return err
+			}
+
+			if !filter.match(record) {
+				continue
+			}
+
+			records = append(records, record)
+			if filter.Limit > 0 && len(records) >= filter.Limit {
+				break
+			}
+		}
+		return nil
+	})
+	return records, err
+}
+
+// Returns a single run by its id.
+func (s *Store) Get(id string) (domain.RunRecord, error) {
+	var record domain.RunRecord
+
+	err := s.view(func(tx *bolt.Tx) error {
+		runs := tx.Bucket(runsBucket)
+		ids := tx.Bucket(idsBucket)
+		if runs == nil || ids == nil {
+			return errors.New(ErrRunNotFound)
+		}
+
+		key := ids.Get([]byte(id))
+		if key == nil {
+			return errors.New(ErrRunNotFound)
+		}
+
+		value := runs.Get(key)
+		if value == nil {
+			return errors.New(ErrRunNotFound)
+		}
+		return json.Unmarshal(value, &record)
+	})
+	if err == nil && record.Id == "" {
+		err = errors.New(ErrRunNotFound)
+	}
+	return record, err
+}
+
+// Removes the oldest runs until the store is within its limits.
+func (s *Store) prune(runs *bolt.Bucket, ids *bolt.Bucket, now time.Time) error {
+	var expired [][]byte
+
+	count := 0
+	cursor := runs.Cursor()
+	for key, _ := cursor.First(); key != nil; key, _ = cursor.Next() {
+		count++
+	}
+
+	for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+		old := s.maxAge > 0 && keyTime(key).Before(now.Add(-s.maxAge))
+		if count-len(expired) <= s.maxRuns && !old {
+			break
+		}
+
+		var record domain.RunRecord
+		if json.Unmarshal(value, &record) == nil {
+			ids.Delete([]byte(record.Id))
+		}
+		expired = append(expired, append([]byte{}, key...))
+	}
+
+	for _, key := range expired {
+		err := runs.Delete(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) update(fn func(tx *bolt.Tx) error) error {
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(fn)
+}
+
+// A missing history file is the same as an empty history.
+func (s *Store) view(fn func(tx *bolt.Tx) error) error {
+	_, err := os.Stat(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	db, err := bolt.Open(s.path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+// Runs are stored by when they started so the cursor walks them in order.
+func runKey(record domain.RunRecord) []byte {
+	key := make([]byte, 8, 8+len(record.Id))
+	binary.BigEndian.PutUint64(key, uint64(record.StartedAt.UnixNano()))
+	return append(key, record.Id...)
+}
+
+func keyTime(key []byte) time.Time {
+	if len(key) < 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(key[:8])))
+}
@@ -0,0 +1,115 @@
+package history_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/history"
+)
+
+func TestStoreAddAndList(t *testing.T) {
+	store := history.NewStore(t.TempDir(), domain.ConfigHistory{})
+	now := time.Date(2022, 12, 1, 3, 0, 0, 0, time.UTC)
+
+	records := []domain.RunRecord{
+		{Id: "a1", Job: "webdav", Container: "webdav", StartedAt: now, Success: true},
+		{Id: "b2", Job: "app-db", Container: "app-db", StartedAt: now.Add(time.Minute), Error: "docker is down"},
+		{Id: "c3", Job: "webdav", Container: "webdav", StartedAt: now.Add(time.Hour), Success: true, Checksum: "abc"},
+	}
+	for _, record := range records {
+		err := store.Add(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := store.List(history.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 || all[0].Id != "c3" || all[2].Id != "a1" {
+		t.Fatalf("expected the runs newest first but got %+v", all)
+	}
+
+	failed, err := store.List(history.Filter{Failed: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(failed) != 1 || failed[0].Id != "b2" {
+		t.Errorf("expected only the failed run but got %+v", failed)
+	}
+
+	webdav, err := store.List(history.Filter{Container: "webdav", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webdav) != 1 || webdav[0].Id != "c3" {
+		t.Errorf("expected the newest webdav run but got %+v", webdav)
+	}
+
+	record, err := store.Get("c3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.Checksum != "abc" {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	_, err = store.Get("zz")
+	if err == nil || err.Error() != history.ErrRunNotFound {
+		t.Errorf("expected not found but got %v", err)
+	}
+}
+
+func TestStoreEmpty(t *testing.T) {
+	store := history.NewStore(t.TempDir(), domain.ConfigHistory{})
+
+	records, err := store.List(history.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("expected no runs but got %+v", records)
+	}
+
+	_, err = store.Get("a1")
+	if err == nil {
+		t.Error("expected an error for a missing run")
+	}
+}
+
+func TestStorePrune(t *testing.T) {
+	store := history.NewStore(t.TempDir(), domain.ConfigHistory{
+		MaxRuns: 3,
+		MaxAge:  domain.Duration(48 * time.Hour),
+	})
+	now := time.Now()
+
+	// Too old to keep
+	err := store.Add(domain.RunRecord{Id: "old", StartedAt: now.Add(-72 * time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 5; i++ {
+		err = store.Add(domain.RunRecord{Id: fmt.Sprintf("r%v", i), StartedAt: now.Add(time.Duration(i) * time.Minute)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := store.List(history.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[0].Id != "r4" || records[2].Id != "r2" {
+		t.Fatalf("expected the newest 3 runs but got %+v", records)
+	}
+
+	_, err = store.Get("r0")
+	if err == nil {
+		t.Error("expected the pruned run to be removed from the index")
+	}
+}
@@ -0,0 +1,103 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+// Renders the record as a single line in the requested format.
+func format(name string, record domain.LogRecord) []byte {
+	switch name {
+	case domain.LogFormatJson:
+		return formatJson(record)
+	case domain.LogFormatLogfmt:
+		return formatLogfmt(record)
+	}
+	return formatText(record)
+}
+
+// Renders every record in the text format, like they would be in the log file.
+func FormatRecords(records []domain.LogRecord) []byte {
+	var b bytes.Buffer
+	for _, record := range records {
+		b.Write(formatText(record))
+	}
+	return b.Bytes()
+}
+
+// 2022/12/01 03:00:00 INFO The backup was moved. container=webdav
+func formatText(record domain.LogRecord) []byte {
+	var b bytes.Buffer
+	b.WriteString(record.Time.Format("2006/01/02 15:04:05"))
+	b.WriteString(" ")
+	b.WriteString(strings.ToUpper(record.Level.String()))
+	b.WriteString(" ")
+	b.WriteString(record.Message)
+	for _, field := range record.Fields {
+		b.WriteString(" ")
+		b.WriteString(field.Key)
+		b.WriteString("=")
+		b.WriteString(quoteLogfmt(field.Value))
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// time=2022-12-01T03:00:00Z level=info msg="The backup was moved." container=webdav
+func formatLogfmt(record domain.LogRecord) []byte {
+	var b bytes.Buffer
+	b.WriteString("time=")
+	b.WriteString(record.Time.Format(time.RFC3339))
+	b.WriteString(" level=")
+	b.WriteString(record.Level.String())
+	b.WriteString(" msg=")
+	b.WriteString(quoteLogfmt(record.Message))
+	for _, field := range record.Fields {
+		b.WriteString(" ")
+		b.WriteString(field.Key)
+		b.WriteString("=")
+		b.WriteString(quoteLogfmt(field.Value))
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// {"time":"2022-12-01T03:00:00Z","level":"info","msg":"The backup was moved.","container":"webdav"}
+func formatJson(record domain.LogRecord) []byte {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJsonString(&b, record.Time.Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeJsonString(&b, record.Level.String())
+	b.WriteString(`,"msg":`)
+	writeJsonString(&b, record.Message)
+	for _, field := range record.Fields {
+		b.WriteString(",")
+		writeJsonString(&b, field.Key)
+		b.WriteString(":")
+		writeJsonString(&b, field.Value)
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func writeJsonString(b *bytes.Buffer, value string) {
+	content, _ := json.Marshal(value)
+	b.Write(content)
+}
+
+// Values with spaces, quotes or an equals sign are quoted.
+func quoteLogfmt(value string) string {
+	if value == "" {
+		return `""`
+	}
+	if strings.ContainsAny(value, " \"=\t\r\n\\") {
+		return strconv.Quote(value)
+	}
+	return value
+}
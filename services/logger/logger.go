@@ -0,0 +1,256 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	ErrUnknownFormat = "Log.Format must be text, logfmt or json"
+
+	// Field keys that tie a record to a run.
+	KeyJob       = "job"
+	KeyContainer = "container"
+	KeyRun       = "run"
+	KeyError     = "error"
+)
+
+// The sink writes every record to the outputs, it is shared by every logger made with With.
+type sink struct {
+	mu      sync.Mutex
+	level   domain.LogLevel
+	format  string
+	outputs []io.Writer
+	closers []io.Closer
+}
+
+// Logger writes structured records.
+// Every record also goes to the recorder when one is attached, that is how alerts get the logs of a run.
+type Logger struct {
+	sink     *sink
+	fields   []domain.LogField
+	recorder *Recorder
+}
+
+// Creates a logger from the config, the logs always go to stderr and to the file when it is set.
+func New(config domain.ConfigLog) (*Logger, error) {
+	level, err := domain.ParseLogLevel(config.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := ParseFormat(config.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sink{
+		level:   level,
+		format:  format,
+		outputs: []io.Writer{os.Stderr},
+	}
+
+	if config.File != "" {
+		file, err := NewRotatingFile(config.File, int64(config.MaxSize), config.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s.outputs = append(s.outputs, file)
+		s.closers = append(s.closers, file)
+	}
+
+	return &Logger{sink: s}, nil
+}
+
+// Returns the format records are written in, text when it is empty.
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return domain.LogFormatText, nil
+	case domain.LogFormatText, domain.LogFormatLogfmt, domain.LogFormatJson:
+		return format, nil
+	}
+	return "", fmt.Errorf("%v, got '%v'", ErrUnknownFormat, format)
+}
+
+// Creates a logger that writes to w, this is handy for tests.
+func NewWriterLogger(w io.Writer, level domain.LogLevel, format string) *Logger {
+	return &Logger{
+		sink: &sink{
+			level:   level,
+			format:  format,
+			outputs: []io.Writer{w},
+		},
+	}
+}
+
+var (
+	defaultMu     sync.RWMutex
+	defaultLogger = NewWriterLogger(os.Stderr, domain.LogLevelInfo, domain.LogFormatText)
+)
+
+// Returns the logger used by code that was not given one.
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+// Replaces the default logger, anything written with the standard log package is sent to it as well.
+func SetDefault(l *Logger) {
+	defaultMu.Lock()
+	defaultLogger = l
+	defaultMu.Unlock()
+
+	log.SetFlags(0)
+	log.SetOutput(stdWriter{})
+}
+
+// Sends lines written by the standard log package to the default logger.
+type stdWriter struct{}
+
+func (stdWriter) Write(p []byte) (int, error) {
+	Default().Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// Returns a copy of the logger that adds the key values to every record.
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	c := *l
+	c.fields = append(append([]domain.LogField{}, l.fields...), toFields(keyvals)...)
+	return &c
+}
+
+// Returns a copy of the logger that also keeps every record in the recorder.
+func (l *Logger) WithRecorder(recorder *Recorder) *Logger {
+	c := *l
+	c.recorder = recorder
+	return &c
+}
+
+// Returns the records kept by the recorder, nil when the logger does not have one.
+func (l *Logger) Records() []domain.LogRecord {
+	return l.recorder.Records()
+}
+
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(domain.LogLevelDebug, msg, keyvals)
+}
+
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(domain.LogLevelInfo, msg, keyvals)
+}
+
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(domain.LogLevelWarn, msg, keyvals)
+}
+
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(domain.LogLevelError, msg, keyvals)
+}
+
+// Closes the log file if there is one.
+func (l *Logger) Close() error {
+	var err error
+	for _, closer := range l.sink.closers {
+		cerr := closer.Close()
+		if cerr != nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+func (l *Logger) log(level domain.LogLevel, msg string, keyvals []interface{}) {
+	record := domain.LogRecord{
+		Time:    time.Now(),
+		Level:   level,
+		Message: msg,
+		Fields:  append(append([]domain.LogField{}, l.fields...), toFields(keyvals)...),
+	}
+
+	// The recorder keeps everything, the alert decides what it wants to show
+	l.recorder.add(record)
+
+	if level < l.sink.level {
+		return
+	}
+
+	line := format(l.sink.format, record)
+
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	for _, output := range l.sink.outputs {
+		_, err := output.Write(line)
+		// A log file that fails is reported on stderr, the logs still get there
+		if err != nil && output != os.Stderr {
+			fmt.Fprintf(os.Stderr, "Unable to write the log: %v\n", err)
+		}
+	}
+}
+
+// Turns key value pairs into fields, a key without a value is kept with an empty value.
+func toFields(keyvals []interface{}) []domain.LogField {
+	var fields []domain.LogField
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		value := ""
+		if i+1 < len(keyvals) {
+			value = formatValue(keyvals[i+1])
+		}
+		fields = append(fields, domain.LogField{Key: key, Value: value})
+	}
+	return fields
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case error:
+		return v.Error()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case time.Duration:
+		return v.Round(time.Millisecond).String()
+	}
+	return fmt.Sprint(value)
+}
+
+// Recorder keeps the records of a single run.
+type Recorder struct {
+	mu      sync.Mutex
+	records []domain.LogRecord
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+func (r *Recorder) add(record domain.LogRecord) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.records = append(r.records, record)
+}
+
+// Returns a copy of the records in the order they were written.
+func (r *Recorder) Records() []domain.LogRecord {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]domain.LogRecord{}, r.records...)
+}
@@ -0,0 +1,96 @@
+package logger_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+func TestLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWriterLogger(&buf, domain.LogLevelWarn, domain.LogFormatText)
+
+	log.Info("hidden")
+	log.Warn("shown")
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") || !strings.Contains(out, "WARN shown") {
+		t.Errorf("unexpected output %v", out)
+	}
+}
+
+func TestLoggerLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWriterLogger(&buf, domain.LogLevelInfo, domain.LogFormatLogfmt).
+		With(logger.KeyContainer, "app-db")
+
+	log.Info("Backup was moved.", "file", "db 1.tar")
+
+	out := buf.String()
+	for _, part := range []string{`level=info`, `msg="Backup was moved."`, `container=app-db`, `file="db 1.tar"`} {
+		if !strings.Contains(out, part) {
+			t.Errorf("expected %v in %v", part, out)
+		}
+	}
+}
+
+func TestLoggerJson(t *testing.T) {
+	var buf bytes.Buffer
+	log := logger.NewWriterLogger(&buf, domain.LogLevelInfo, domain.LogFormatJson).
+		With(logger.KeyRun, "abc123")
+
+	log.Error("The backup failed", logger.KeyError, "docker said \"no\"")
+
+	var line map[string]string
+	err := json.Unmarshal(buf.Bytes(), &line)
+	if err != nil {
+		t.Fatalf("%v: %v", err, buf.String())
+	}
+
+	if line["level"] != "error" || line["msg"] != "The backup failed" || line["run"] != "abc123" || line["error"] != "docker said \"no\"" {
+		t.Errorf("unexpected line %v", line)
+	}
+}
+
+func TestLoggerRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := logger.NewRecorder()
+	log := logger.NewWriterLogger(&buf, domain.LogLevelInfo, domain.LogFormatText).
+		With(logger.KeyJob, "webdav").
+		WithRecorder(recorder)
+
+	log.Debug("only recorded")
+	log.Info("both")
+
+	// Loggers made from the run logger share the recorder
+	log.With("destination", "local").Warn("child")
+
+	records := recorder.Records()
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records but got %v", len(records))
+	}
+
+	if records[2].Field("destination") != "local" || records[2].Field(logger.KeyJob) != "webdav" {
+		t.Errorf("unexpected fields %+v", records[2].Fields)
+	}
+
+	if strings.Contains(buf.String(), "only recorded") {
+		t.Error("debug records should not be written at info")
+	}
+}
+
+func TestNewRejectsBadConfig(t *testing.T) {
+	_, err := logger.New(domain.ConfigLog{Format: "xml"})
+	if err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+
+	_, err = logger.New(domain.ConfigLog{Level: "loud"})
+	if err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
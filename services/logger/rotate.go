@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+const (
+	DefaultMaxSize    = 10 * 1000 * 1000
+	DefaultMaxBackups = 3
+
+	ErrRotate = "unable to rotate the log file, it will keep growing until dvb restarts"
+)
+
+// RotatingFile is a log file that is moved to file.1 once it reaches the max size.
+// Older files are moved up one number and anything past MaxBackups is removed.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+
+	// Set once rotating failed, the file is not rotated again so every write does not fail.
+	stuck bool
+}
+
+func NewRotatingFile(path string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = DefaultMaxBackups
+	}
+
+	f := &RotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	err := f.open()
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+
+	var rotateErr error
+	if !f.stuck && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		rotateErr = f.rotate()
+		if f.file == nil {
+			return 0, rotateErr
+		}
+	}
+
+	// The line is still written when rotating failed, the error is returned so it can be reported
+	n, err := f.file.Write(p)
+	f.size = f.size + int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// Moves the file to file.1 and opens a new one.
+// When the files can not be moved the same file is opened again and rotating stops.
+func (f *RotatingFile) rotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		return err
+	}
+
+	err = f.shift()
+	if err != nil {
+		f.stuck = true
+		openErr := f.open()
+		if openErr != nil {
+			return openErr
+		}
+		return fmt.Errorf("%v: %v", ErrRotate, err)
+	}
+
+	return f.open()
+}
+
+// Moves every old file up one number, the file past MaxBackups is removed.
+func (f *RotatingFile) shift() error {
+	err := os.Remove(backupName(f.path, f.maxBackups))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for i := f.maxBackups - 1; i >= 1; i-- {
+		err = os.Rename(backupName(f.path, i), backupName(f.path, i+1))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return os.Rename(f.path, backupName(f.path, 1))
+}
+
+func backupName(path string, i int) string {
+	return fmt.Sprintf("%v.%v", path, i)
+}
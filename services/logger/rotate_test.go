@@ -0,0 +1,86 @@
+package logger_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jtom38/dvb/services/logger"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dvb.log")
+	file, err := logger.NewRotatingFile(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	for _, line := range []string{"first line 0001\n", "second line 002\n", "third line 0003\n", "fourth line 004\n"} {
+		_, err = file.Write([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := map[string]string{
+		path:        "fourth",
+		path + ".1": "third",
+		path + ".2": "second",
+	}
+	for name, want := range expected {
+		content, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(content), want) {
+			t.Errorf("expected %v to start with %v but got %v", name, want, string(content))
+		}
+	}
+
+	_, err = os.Stat(path + ".3")
+	if !os.IsNotExist(err) {
+		t.Error("expected only 2 old files to be kept")
+	}
+}
+
+func TestRotatingFileStuck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dvb.log")
+
+	// A folder that can not be removed is in the way of the old file
+	err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := logger.NewRotatingFile(path, 20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	_, err = file.Write([]byte("first line 0001\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = file.Write([]byte("second line 002\n"))
+	if err == nil || !strings.Contains(err.Error(), logger.ErrRotate) {
+		t.Errorf("expected the rotate error but got %v", err)
+	}
+
+	// The error is only returned once, the file keeps growing
+	_, err = file.Write([]byte("third line 0003\n"))
+	if err != nil {
+		t.Errorf("expected rotating to stop but got %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(content), "line") != 3 {
+		t.Errorf("expected every line to be written but got %v", string(content))
+	}
+}
@@ -0,0 +1,278 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// The content type of the prometheus text format.
+	ContentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type metricType string
+
+const (
+	gauge   metricType = "gauge"
+	counter metricType = "counter"
+)
+
+// Describes one metric and the labels it uses.
+type desc struct {
+	name   string
+	help   string
+	kind   metricType
+	labels []string
+}
+
+var (
+	lastSuccess = desc{"dvb_last_success_timestamp_seconds", "When the last successful backup of the container finished.", gauge, []string{"container"}}
+	lastRun     = desc{"dvb_last_run_timestamp_seconds", "When the last backup of the container finished.", gauge, []string{"container"}}
+	lastResult  = desc{"dvb_last_run_success", "1 if the last backup of the container worked, 0 if it failed.", gauge, []string{"container"}}
+	lastTime    = desc{"dvb_last_duration_seconds", "How long the last backup of the container took.", gauge, []string{"container"}}
+	lastSize    = desc{"dvb_last_archive_size_bytes", "The size of the last archive made for the container.", gauge, []string{"container"}}
+	downtime    = desc{"dvb_container_downtime_seconds", "How long the container was stopped during the last backup.", gauge, []string{"container"}}
+	running     = desc{"dvb_running", "1 while a backup of the container is running.", gauge, []string{"container"}}
+	runs        = desc{"dvb_runs_total", "Backups that have finished.", counter, []string{"container"}}
+	failures    = desc{"dvb_failures_total", "Backups that have failed.", counter, []string{"container"}}
+	deletions   = desc{"dvb_retention_deletions_total", "Backups removed by retention.", counter, []string{"container", "destination"}}
+	uploaded    = desc{"dvb_uploaded_bytes_total", "Bytes written to the destination.", counter, []string{"destination"}}
+	alertErrors = desc{"dvb_alert_failures_total", "Alerts that could not be delivered.", counter, []string{"channel"}}
+
+	// The order the metrics are written in.
+	descs = []desc{lastSuccess, lastRun, lastResult, lastTime, lastSize, downtime, running, runs, failures, deletions, uploaded, alertErrors}
+)
+
+// The registry keeps the values of every metric dvb exposes.
+type Registry struct {
+	mu     sync.Mutex
+	values map[string]map[string]float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		values: make(map[string]map[string]float64),
+	}
+}
+
+// Records that a backup of the container has started.
+func (r *Registry) RunStarted(container string) {
+	r.set(running, 1, container)
+}
+
+// Records how a backup of the container ended.
+func (r *Registry) RunFinished(container string, finished time.Time, duration time.Duration, success bool) {
+	r.set(running, 0, container)
+	r.set(lastRun, unix(finished), container)
+	r.set(lastTime, duration.Seconds(), container)
+	r.add(runs, 1, container)
+
+	if success {
+		r.set(lastSuccess, unix(finished), container)
+		r.set(lastResult, 1, container)
+		return
+	}
+	r.set(lastResult, 0, container)
+	r.add(failures, 1, container)
+}
+
+// Sets when the container last had a good backup, used to load the state from disk on startup.
+func (r *Registry) SetLastSuccess(container string, at time.Time) {
+	if at.IsZero() {
+		return
+	}
+	r.set(lastSuccess, unix(at), container)
+}
+
+func (r *Registry) SetArchiveSize(container string, size int64) {
+	r.set(lastSize, float64(size), container)
+}
+
+func (r *Registry) SetDowntime(container string, duration time.Duration) {
+	r.set(downtime, duration.Seconds(), container)
+}
+
+func (r *Registry) AddRetentionDeletions(container string, destination string, count int) {
+	r.add(deletions, float64(count), container, destination)
+}
+
+func (r *Registry) AddUploaded(destination string, size int64) {
+	r.add(uploaded, float64(size), destination)
+}
+
+func (r *Registry) AlertFailed(channel string) {
+	r.add(alertErrors, 1, channel)
+}
+
+// Returns a copy of every counter by name and labels, so they can be kept between runs.
+func (r *Registry) Counters() map[string]map[string]float64 {
+	counters := make(map[string]map[string]float64)
+	if r == nil {
+		return counters
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range descs {
+		if d.kind != counter || len(r.values[d.name]) == 0 {
+			continue
+		}
+
+		series := make(map[string]float64)
+		for key, value := range r.values[d.name] {
+			series[key] = value
+		}
+		counters[d.name] = series
+	}
+	return counters
+}
+
+// Adds the counters of an earlier run, anything that is not a counter dvb knows is ignored.
+func (r *Registry) SeedCounters(counters map[string]map[string]float64) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, d := range descs {
+		if d.kind != counter {
+			continue
+		}
+
+		for key, value := range counters[d.name] {
+			r.series(d)[key] += value
+		}
+	}
+}
+
+func (r *Registry) set(d desc, value float64, labels ...string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(d)[formatLabels(d.labels, labels)] = value
+}
+
+func (r *Registry) add(d desc, value float64, labels ...string) {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series(d)[formatLabels(d.labels, labels)] += value
+}
+
+func (r *Registry) series(d desc) map[string]float64 {
+	series, ok := r.values[d.name]
+	if !ok {
+		series = make(map[string]float64)
+		r.values[d.name] = series
+	}
+	return series
+}
+
+// Writes every metric in the prometheus text format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buf := bufio.NewWriter(w)
+	for _, d := range descs {
+		series := r.values[d.name]
+		if len(series) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(buf, "# HELP %v %v\n", d.name, d.help)
+		fmt.Fprintf(buf, "# TYPE %v %v\n", d.name, d.kind)
+
+		keys := make([]string, 0, len(series))
+		for key := range series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Fprintf(buf, "%v%v %v\n", d.name, key, formatValue(series[key]))
+		}
+	}
+	return buf.Flush()
+}
+
+// Writes the metrics for the node exporter textfile collector.
+// The file is replaced in one step so the collector never reads half a file.
+func (r *Registry) WriteFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = r.Write(tmp)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	err = tmp.Close()
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	// The collector runs as a different user most of the time
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func formatLabels(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		fmt.Fprintf(&b, "%v=\"%v\"", name, escapeLabel(value))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+func unix(t time.Time) float64 {
+	return float64(t.UnixNano()) / float64(time.Second)
+}
@@ -0,0 +1,117 @@
+package metrics_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/services/metrics"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := metrics.NewRegistry()
+	finished := time.Unix(1669870800, 0)
+
+	r.RunStarted("app-db")
+	r.RunFinished("app-db", finished, 90*time.Second, true)
+	r.RunFinished("webdav", finished, time.Minute, false)
+	r.SetArchiveSize("app-db", 2048)
+	r.AddUploaded("local", 2048)
+	r.AddUploaded("local", 1024)
+	r.AddRetentionDeletions("app-db", "local", 2)
+	r.AlertFailed("discord")
+
+	var buf bytes.Buffer
+	err := r.Write(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	expected := []string{
+		"# TYPE dvb_last_success_timestamp_seconds gauge",
+		`dvb_last_success_timestamp_seconds{container="app-db"} 1669870800`,
+		`dvb_last_duration_seconds{container="app-db"} 90`,
+		`dvb_last_run_success{container="webdav"} 0`,
+		`dvb_running{container="app-db"} 0`,
+		`dvb_failures_total{container="webdav"} 1`,
+		`dvb_last_archive_size_bytes{container="app-db"} 2048`,
+		`dvb_uploaded_bytes_total{destination="local"} 3072`,
+		`dvb_retention_deletions_total{container="app-db",destination="local"} 2`,
+		`dvb_alert_failures_total{channel="discord"} 1`,
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("expected '%v' in\n%v", line, out)
+		}
+	}
+
+	if strings.Contains(out, `dvb_last_success_timestamp_seconds{container="webdav"}`) {
+		t.Error("webdav has never worked and should not have a last success")
+	}
+}
+
+func TestRegistryEscapesLabels(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.AlertFailed("a \"quoted\"\nchannel")
+
+	var buf bytes.Buffer
+	r.Write(&buf)
+
+	if !strings.Contains(buf.String(), `{channel="a \"quoted\"\nchannel"} 1`) {
+		t.Errorf("the label was not escaped: %v", buf.String())
+	}
+}
+
+func TestRegistryWriteFile(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.SetLastSuccess("app-db", time.Unix(1669870800, 0))
+
+	path := filepath.Join(t.TempDir(), "dvb.prom")
+	err := r.WriteFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(content), `dvb_last_success_timestamp_seconds{container="app-db"} 1669870800`) {
+		t.Errorf("unexpected file content %v", string(content))
+	}
+
+	files, _ := os.ReadDir(filepath.Dir(path))
+	if len(files) != 1 {
+		t.Errorf("expected the temp file to be gone but found %v files", len(files))
+	}
+}
+
+func TestRegistrySeedCounters(t *testing.T) {
+	// The counters of the last one time run are carried on by the next one
+	first := metrics.NewRegistry()
+	first.RunFinished("app-db", time.Now(), time.Minute, false)
+	first.SetLastSuccess("app-db", time.Unix(1669870800, 0))
+
+	second := metrics.NewRegistry()
+	second.SeedCounters(first.Counters())
+	second.RunFinished("app-db", time.Now(), time.Minute, true)
+
+	counters := second.Counters()
+	if counters["dvb_runs_total"][`{container="app-db"}`] != 2 || counters["dvb_failures_total"][`{container="app-db"}`] != 1 {
+		t.Errorf("unexpected counters %v", counters)
+	}
+	if _, ok := counters["dvb_last_success_timestamp_seconds"]; ok {
+		t.Error("expected only counters to be kept")
+	}
+
+	var buf bytes.Buffer
+	second.Write(&buf)
+	if !strings.Contains(buf.String(), `dvb_runs_total{container="app-db"} 2`) {
+		t.Errorf("expected the seeded counter to be written but got %v", buf.String())
+	}
+}
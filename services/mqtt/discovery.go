@@ -0,0 +1,117 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jtom38/dvb/services/logger"
+)
+
+// A Home Assistant mqtt discovery config for one sensor.
+type DiscoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueId          string          `json:"unique_id"`
+	ObjectId          string          `json:"object_id,omitempty"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	DeviceClass       string          `json:"device_class,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	Icon              string          `json:"icon,omitempty"`
+	AvailabilityTopic string          `json:"availability_topic,omitempty"`
+	Device            DiscoveryDevice `json:"device"`
+}
+
+type DiscoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// The sensors every container gets.
+type sensor struct {
+	key         string
+	name        string
+	template    string
+	deviceClass string
+	stateClass  string
+	unit        string
+	icon        string
+}
+
+// A timestamp sensor can not read an empty value, None leaves it unknown until the first success.
+var sensors = []sensor{
+	{key: "status", name: "Backup status", template: "{{ value_json.status }}", icon: "mdi:backup-restore"},
+	{key: "last_success", name: "Last successful backup", template: "{{ value_json.last_success | default(None) }}", deviceClass: "timestamp"},
+	{key: "size", name: "Backup size", template: "{{ value_json.size }}", deviceClass: "data_size", stateClass: "measurement", unit: "B"},
+	{key: "duration", name: "Backup duration", template: "{{ value_json.duration }}", deviceClass: "duration", stateClass: "measurement", unit: "s"},
+}
+
+// Returns the discovery topic and config of every sensor of the container.
+func (p *Publisher) DiscoveryConfigs(container string) map[string]DiscoveryConfig {
+	configs := make(map[string]DiscoveryConfig)
+
+	id := fmt.Sprintf("dvb_%v_%v", p.node, topicId(container))
+	device := DiscoveryDevice{
+		Identifiers:  []string{id},
+		Name:         fmt.Sprintf("dvb %v", container),
+		Manufacturer: "dvb",
+		Model:        "Docker Volume Backup",
+	}
+
+	for _, sensor := range sensors {
+		config := DiscoveryConfig{
+			Name:              sensor.name,
+			UniqueId:          fmt.Sprintf("%v_%v", id, sensor.key),
+			ObjectId:          fmt.Sprintf("%v_%v", id, sensor.key),
+			StateTopic:        p.StateTopic(container),
+			ValueTemplate:     sensor.template,
+			DeviceClass:       sensor.deviceClass,
+			StateClass:        sensor.stateClass,
+			UnitOfMeasurement: sensor.unit,
+			Icon:              sensor.icon,
+			Device:            device,
+		}
+		if p.params.Availability {
+			config.AvailabilityTopic = p.AvailabilityTopic()
+		}
+
+		topic := fmt.Sprintf("%v/sensor/%v_%v/config", p.discoveryPrefix(), id, sensor.key)
+		configs[topic] = config
+	}
+	return configs
+}
+
+// Publishes the discovery config of the container once per connection.
+func (p *Publisher) discover(container string, wait bool) {
+	if !p.params.Config.Discovery {
+		return
+	}
+
+	p.mu.Lock()
+	if p.discovered[container] {
+		p.mu.Unlock()
+		return
+	}
+	p.discovered[container] = true
+	p.mu.Unlock()
+
+	for topic, config := range p.DiscoveryConfigs(container) {
+		content, err := json.Marshal(config)
+		if err != nil {
+			p.params.Logger.Error("Unable to encode the discovery config", logger.KeyError, err)
+			continue
+		}
+		p.publish(topic, string(content), true, wait)
+	}
+}
+
+func (p *Publisher) discoveryPrefix() string {
+	prefix := strings.TrimSuffix(p.params.Config.DiscoveryPrefix, "/")
+	if prefix == "" {
+		return DefaultDiscoveryPrefix
+	}
+	return prefix
+}
@@ -0,0 +1,325 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	DefaultTopicPrefix     = "dvb"
+	DefaultDiscoveryPrefix = "homeassistant"
+
+	AvailabilityOnline  = "online"
+	AvailabilityOffline = "offline"
+
+	StatusRunning = "running"
+	StatusSuccess = "success"
+	StatusFailed  = "failed"
+
+	ErrPublishTimeout = "the broker did not confirm the message in time"
+
+	// Messages are sent at least once.
+	qos = 1
+
+	connectTimeout = 10 * time.Second
+	publishTimeout = 10 * time.Second
+
+	// How long to wait for messages that are still being sent when closing.
+	disconnectQuiesce = 1000
+)
+
+// The retained state of a container, this is what the Home Assistant sensors read.
+type ContainerState struct {
+	Status      string  `json:"status"`
+	Run         string  `json:"run,omitempty"`
+	LastRun     string  `json:"last_run,omitempty"`
+	LastSuccess string  `json:"last_success,omitempty"`
+	Size        int64   `json:"size"`
+	Duration    float64 `json:"duration"`
+	Error       string  `json:"error,omitempty"`
+}
+
+type PublisherParams struct {
+	Config domain.ConfigMqtt
+	Host   string
+
+	// Publish online and offline with a last will on the availability topic.
+	// Only the daemon does this, so sensors do not show as unavailable between one time runs.
+	Availability bool
+
+	// Return from Connect without waiting for the broker, a one time run should not stall when it is down.
+	// Messages are queued until the connection is made.
+	Background bool
+
+	// Defaults to logger.Default.
+	Logger *logger.Logger
+}
+
+// The publisher sends the state of every container and an event for every run to the broker.
+// Every method is safe to call on a nil publisher, so mqtt can be left out of the config.
+type Publisher struct {
+	params PublisherParams
+	prefix string
+	node   string
+	client paho.Client
+
+	mu         sync.Mutex
+	states     map[string]ContainerState
+	discovered map[string]bool
+}
+
+func NewPublisher(params PublisherParams) *Publisher {
+	if params.Logger == nil {
+		params.Logger = logger.Default()
+	}
+
+	prefix := strings.TrimSuffix(params.Config.TopicPrefix, "/")
+	if prefix == "" {
+		prefix = DefaultTopicPrefix
+	}
+
+	return &Publisher{
+		params:     params,
+		prefix:     prefix,
+		node:       topicId(params.Host),
+		states:     make(map[string]ContainerState),
+		discovered: make(map[string]bool),
+	}
+}
+
+// Loads the last success of a container from before dvb started.
+func (p *Publisher) SetLastSuccess(container string, at time.Time) {
+	if p == nil || at.IsZero() {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	state := p.states[container]
+	state.LastSuccess = formatTime(at)
+	if state.Status == "" {
+		state.Status = StatusSuccess
+	}
+	p.states[container] = state
+}
+
+// Connects to the broker and publishes the discovery config for the containers.
+// When the broker can not be reached the publisher keeps trying in the background.
+func (p *Publisher) Connect(containers []string) error {
+	if p == nil {
+		return nil
+	}
+
+	p.mu.Lock()
+	for _, container := range containers {
+		if _, ok := p.states[container]; !ok {
+			p.states[container] = ContainerState{}
+		}
+	}
+	p.mu.Unlock()
+
+	clientId := p.params.Config.ClientId
+	if clientId == "" {
+		clientId = fmt.Sprintf("dvb-%v", p.node)
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(p.params.Config.Broker).
+		SetClientID(clientId).
+		SetUsername(p.params.Config.Username).
+		SetPassword(p.params.Config.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(paho.Client) { p.onConnect() }).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			p.params.Logger.Warn("Lost the connection to the mqtt broker", logger.KeyError, err)
+		})
+	if p.params.Availability {
+		opts.SetWill(p.AvailabilityTopic(), AvailabilityOffline, qos, true)
+	}
+
+	p.client = paho.NewClient(opts)
+	token := p.client.Connect()
+	if p.params.Background {
+		go func() {
+			err := waitForConnect(token, p.params.Config.Broker)
+			if err != nil {
+				p.params.Logger.Warn("Unable to connect to the mqtt broker", logger.KeyError, err)
+			}
+		}()
+		return nil
+	}
+	return waitForConnect(token, p.params.Config.Broker)
+}
+
+func waitForConnect(token paho.Token, broker string) error {
+	if !token.WaitTimeout(connectTimeout) {
+		return fmt.Errorf("unable to reach the mqtt broker %v, it will be retried", broker)
+	}
+	return token.Error()
+}
+
+// Publishes everything the broker needs to know again, it may have restarted without the retained messages.
+func (p *Publisher) onConnect() {
+	if p.params.Availability {
+		p.publish(p.AvailabilityTopic(), AvailabilityOnline, true, false)
+	}
+
+	p.mu.Lock()
+	p.discovered = make(map[string]bool)
+	states := make(map[string]ContainerState, len(p.states))
+	for container, state := range p.states {
+		states[container] = state
+	}
+	p.mu.Unlock()
+
+	for container, state := range states {
+		p.discover(container, false)
+		if state.Status != "" {
+			p.publishState(container, state, false)
+		}
+	}
+}
+
+// Records that a backup of the container has started.
+func (p *Publisher) RunStarted(container string, id string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	state := p.states[container]
+	state.Status = StatusRunning
+	state.Run = id
+	p.states[container] = state
+	p.mu.Unlock()
+
+	p.discover(container, true)
+	p.publishState(container, state, true)
+}
+
+// Publishes how the run ended and the new state of the container.
+func (p *Publisher) RunFinished(record domain.RunRecord) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	state := p.states[record.Container]
+	state.Run = record.Id
+	state.LastRun = formatTime(record.FinishedAt)
+	state.Duration = record.Duration().Seconds()
+	state.Error = record.Error
+	state.Status = StatusFailed
+	if record.Success {
+		state.Status = StatusSuccess
+		state.LastSuccess = state.LastRun
+		state.Size = record.ArchiveSize
+	}
+	p.states[record.Container] = state
+	p.mu.Unlock()
+
+	p.discover(record.Container, true)
+	p.publishState(record.Container, state, true)
+
+	content, err := json.Marshal(record)
+	if err != nil {
+		p.params.Logger.Error("Unable to encode the mqtt event", logger.KeyError, err)
+		return
+	}
+	p.publish(p.EventTopic(record.Container), string(content), false, true)
+}
+
+// Marks dvb as offline and disconnects from the broker.
+func (p *Publisher) Close() {
+	if p == nil || p.client == nil {
+		return
+	}
+
+	if p.params.Availability && p.client.IsConnected() {
+		p.publish(p.AvailabilityTopic(), AvailabilityOffline, true, true)
+	}
+
+	// Nothing can be sent while the broker is down, so there is no reason to wait for it
+	quiesce := uint(0)
+	if p.client.IsConnectionOpen() {
+		quiesce = disconnectQuiesce
+	}
+	p.client.Disconnect(quiesce)
+}
+
+func (p *Publisher) AvailabilityTopic() string {
+	return fmt.Sprintf("%v/%v/availability", p.prefix, p.node)
+}
+
+func (p *Publisher) StateTopic(container string) string {
+	return fmt.Sprintf("%v/%v/%v/state", p.prefix, p.node, topicId(container))
+}
+
+func (p *Publisher) EventTopic(container string) string {
+	return fmt.Sprintf("%v/%v/%v/event", p.prefix, p.node, topicId(container))
+}
+
+func (p *Publisher) publishState(container string, state ContainerState, wait bool) {
+	content, err := json.Marshal(state)
+	if err != nil {
+		p.params.Logger.Error("Unable to encode the mqtt state", logger.KeyError, err)
+		return
+	}
+	p.publish(p.StateTopic(container), string(content), true, wait)
+}
+
+// Sends the message, waiting for the broker when wait is set.
+// Handlers that paho calls must not wait or they can block the client.
+func (p *Publisher) publish(topic string, payload string, retained bool, wait bool) {
+	if p.client == nil {
+		return
+	}
+
+	// While the broker is down the message is queued for when it is back
+	token := p.client.Publish(topic, qos, retained, payload)
+	if !wait || !p.client.IsConnectionOpen() {
+		return
+	}
+
+	err := errors.New(ErrPublishTimeout)
+	if token.WaitTimeout(publishTimeout) {
+		err = token.Error()
+	}
+	if err != nil {
+		p.params.Logger.Warn("Unable to publish to mqtt", "topic", topic, logger.KeyError, err)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// Makes the name safe to use in a topic and as a Home Assistant id.
+func topicId(name string) string {
+	id := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return '_'
+	}, name)
+	if id == "" {
+		return "unknown"
+	}
+	return id
+}
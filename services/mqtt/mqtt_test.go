@@ -0,0 +1,344 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/mqtt"
+)
+
+type message struct {
+	Topic    string
+	Payload  string
+	Retained bool
+}
+
+// A small mqtt 3.1.1 broker that records what clients send.
+// It only understands what the publisher uses, connect, publish with qos 0 or 1, ping and disconnect.
+type fakeBroker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	messages []message
+	will     *message
+	clean    bool
+}
+
+func newFakeBroker(t *testing.T) *fakeBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &fakeBroker{listener: listener}
+	go b.accept()
+	t.Cleanup(func() { listener.Close() })
+	return b
+}
+
+func (b *fakeBroker) Url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+func (b *fakeBroker) accept() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.serve(conn)
+	}
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		header, err := r.ReadByte()
+		if err != nil {
+			return
+		}
+		length, err := readLength(r)
+		if err != nil {
+			return
+		}
+		body := make([]byte, length)
+		_, err = io.ReadFull(r, body)
+		if err != nil {
+			return
+		}
+
+		switch header >> 4 {
+		case 1:
+			b.connect(body)
+			conn.Write([]byte{0x20, 0x02, 0x00, 0x00})
+		case 3:
+			qos := (header >> 1) & 0x03
+			topic, rest := readString(body)
+			if qos > 0 {
+				conn.Write([]byte{0x40, 0x02, rest[0], rest[1]})
+				rest = rest[2:]
+			}
+			b.add(message{Topic: topic, Payload: string(rest), Retained: header&0x01 == 1})
+		case 12:
+			conn.Write([]byte{0xd0, 0x00})
+		case 14:
+			b.mu.Lock()
+			b.clean = true
+			b.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) connect(body []byte) {
+	// Skip the protocol name, level, flags and keep alive
+	_, rest := readString(body)
+	flags := rest[1]
+	rest = rest[4:]
+
+	_, rest = readString(rest)
+	if flags&0x04 == 0 {
+		return
+	}
+
+	topic, rest := readString(rest)
+	payload, _ := readString(rest)
+	b.mu.Lock()
+	b.will = &message{Topic: topic, Payload: payload, Retained: flags&0x20 != 0}
+	b.mu.Unlock()
+}
+
+func (b *fakeBroker) add(m message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, m)
+}
+
+// Waits for the last message on the topic that matches.
+func (b *fakeBroker) waitFor(t *testing.T, topic string, match func(m message) bool) message {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		for i := len(b.messages) - 1; i >= 0; i-- {
+			if b.messages[i].Topic == topic && match(b.messages[i]) {
+				m := b.messages[i]
+				b.mu.Unlock()
+				return m
+			}
+		}
+		b.mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("no matching message was published to %v", topic)
+	return message{}
+}
+
+func readLength(r *bufio.Reader) (int, error) {
+	length, multiplier := 0, 1
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(b&0x7f) * multiplier
+		if b&0x80 == 0 {
+			return length, nil
+		}
+		multiplier *= 128
+	}
+}
+
+func readString(b []byte) (string, []byte) {
+	n := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+n]), b[2+n:]
+}
+
+func any(m message) bool {
+	return true
+}
+
+func TestPublisherDaemon(t *testing.T) {
+	broker := newFakeBroker(t)
+	finished := time.Date(2022, 12, 1, 3, 5, 0, 0, time.UTC)
+
+	p := mqtt.NewPublisher(mqtt.PublisherParams{
+		Config: domain.ConfigMqtt{
+			Broker:    broker.Url(),
+			Discovery: true,
+		},
+		Host:         "NAS 01",
+		Availability: true,
+	})
+	p.SetLastSuccess("webdav", finished.Add(-24*time.Hour))
+
+	err := p.Connect([]string{"webdav", "app-db"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.AvailabilityTopic() != "dvb/nas_01/availability" {
+		t.Errorf("unexpected availability topic %v", p.AvailabilityTopic())
+	}
+
+	online := broker.waitFor(t, p.AvailabilityTopic(), func(m message) bool { return m.Payload == mqtt.AvailabilityOnline })
+	if !online.Retained {
+		t.Error("expected the availability to be retained")
+	}
+
+	broker.mu.Lock()
+	will := broker.will
+	broker.mu.Unlock()
+	if will == nil || will.Topic != p.AvailabilityTopic() || will.Payload != mqtt.AvailabilityOffline || !will.Retained {
+		t.Errorf("expected offline as the last will but got %+v", will)
+	}
+
+	// Every container shows up in Home Assistant before it has run
+	discovery := broker.waitFor(t, "homeassistant/sensor/dvb_nas_01_app-db_size/config", any)
+	var config mqtt.DiscoveryConfig
+	err = json.Unmarshal([]byte(discovery.Payload), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.StateTopic != p.StateTopic("app-db") || config.DeviceClass != "data_size" || config.AvailabilityTopic != p.AvailabilityTopic() {
+		t.Errorf("unexpected discovery config %+v", config)
+	}
+	if len(config.Device.Identifiers) != 1 || config.Device.Identifiers[0] != "dvb_nas_01_app-db" {
+		t.Errorf("unexpected device %+v", config.Device)
+	}
+
+	// Home Assistant can not read an empty timestamp before the first success
+	discovery = broker.waitFor(t, "homeassistant/sensor/dvb_nas_01_app-db_last_success/config", any)
+	err = json.Unmarshal([]byte(discovery.Payload), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(config.ValueTemplate, "default(None)") {
+		t.Errorf("expected the last success to be None when it is missing but got %v", config.ValueTemplate)
+	}
+
+	p.RunStarted("webdav", "a1")
+	broker.waitFor(t, p.StateTopic("webdav"), func(m message) bool { return strings.Contains(m.Payload, `"status":"running"`) })
+
+	p.RunFinished(domain.RunRecord{
+		Id:          "a1",
+		Container:   "webdav",
+		StartedAt:   finished.Add(-time.Minute),
+		FinishedAt:  finished,
+		Success:     true,
+		ArchiveSize: 2048,
+	})
+
+	state := broker.waitFor(t, p.StateTopic("webdav"), func(m message) bool { return strings.Contains(m.Payload, `"status":"success"`) })
+	var got mqtt.ContainerState
+	err = json.Unmarshal([]byte(state.Payload), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !state.Retained || got.Size != 2048 || got.Duration != 60 || got.LastSuccess != "2022-12-01T03:05:00Z" {
+		t.Errorf("unexpected state %+v", got)
+	}
+
+	event := broker.waitFor(t, p.EventTopic("webdav"), any)
+	if event.Retained || !strings.Contains(event.Payload, `"id":"a1"`) {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	p.Close()
+	broker.waitFor(t, p.AvailabilityTopic(), func(m message) bool { return m.Payload == mqtt.AvailabilityOffline })
+}
+
+func TestPublisherFailedRun(t *testing.T) {
+	broker := newFakeBroker(t)
+	lastSuccess := time.Date(2022, 11, 30, 3, 0, 0, 0, time.UTC)
+
+	p := mqtt.NewPublisher(mqtt.PublisherParams{
+		Config:     domain.ConfigMqtt{Broker: broker.Url(), TopicPrefix: "backups/"},
+		Host:       "nas01",
+		Background: true,
+	})
+	p.SetLastSuccess("webdav", lastSuccess)
+
+	err := p.Connect([]string{"webdav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.RunFinished(domain.RunRecord{
+		Id:         "b2",
+		Container:  "webdav",
+		StartedAt:  time.Now(),
+		FinishedAt: time.Now(),
+		Error:      "docker is down",
+	})
+
+	state := broker.waitFor(t, "backups/nas01/webdav/state", func(m message) bool { return strings.Contains(m.Payload, `"status":"failed"`) })
+	if !strings.Contains(state.Payload, `"last_success":"2022-11-30T03:00:00Z"`) || !strings.Contains(state.Payload, `"error":"docker is down"`) {
+		t.Errorf("expected the old last success and the error but got %v", state.Payload)
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if broker.will != nil {
+		t.Error("expected no last will outside of the daemon")
+	}
+	for _, m := range broker.messages {
+		if strings.HasPrefix(m.Topic, "homeassistant/") {
+			t.Errorf("expected no discovery but got %v", m.Topic)
+		}
+	}
+}
+
+func TestPublisherBackground(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing is listening on the port anymore
+	broker := "tcp://" + listener.Addr().String()
+	listener.Close()
+
+	p := mqtt.NewPublisher(mqtt.PublisherParams{
+		Config:     domain.ConfigMqtt{Broker: broker},
+		Host:       "nas01",
+		Background: true,
+	})
+
+	started := time.Now()
+	err = p.Connect([]string{"webdav"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RunFinished(domain.RunRecord{Container: "webdav", Success: true, FinishedAt: time.Now()})
+	p.Close()
+
+	if time.Since(started) > time.Second {
+		t.Errorf("expected a one time run to not wait for the broker, it took %v", time.Since(started))
+	}
+}
+
+func TestPublisherNil(t *testing.T) {
+	var p *mqtt.Publisher
+	p.SetLastSuccess("webdav", time.Now())
+	p.RunStarted("webdav", "a1")
+	p.RunFinished(domain.RunRecord{Container: "webdav"})
+	p.Close()
+
+	err := p.Connect([]string{"webdav"})
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,233 @@
+package proc
+
+import (
+	"errors"
+	"os"
+	"sort"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/dest"
+)
+
+const (
+	ErrBackupNotFound = "no backup made by dvb was found with that name"
+)
+
+type CatalogParams struct {
+	ConfigPath string
+
+	// Filters applied to the list of backups.
+	Container string
+	Tag       string
+	Pinned    bool
+}
+
+type CatalogClient struct {
+	Config domain.Config
+	Params CatalogParams
+}
+
+// The catalog client finds the backups dvb owns across every destination.
+func NewCatalogClient(params CatalogParams) CatalogClient {
+	return CatalogClient{
+		Params: params,
+	}
+}
+
+// Loads the config from the ConfigPath.
+func (c *CatalogClient) LoadConfig() error {
+	config, err := LoadConfig(c.Params.ConfigPath)
+	if err != nil {
+		return err
+	}
+	c.Config = *config
+	return nil
+}
+
+// Returns the backups that match the filters, newest first.
+func (c CatalogClient) List() ([]domain.CatalogEntry, error) {
+	var entries []domain.CatalogEntry
+
+	all, err := c.listAll()
+	if err != nil {
+		return entries, err
+	}
+
+	for _, entry := range all {
+		if c.Params.Container != "" && entry.Backup.Container != c.Params.Container {
+			continue
+		}
+		if c.Params.Tag != "" && !entry.Backup.HasTag(c.Params.Tag) {
+			continue
+		}
+		if c.Params.Pinned && !entry.Backup.IsPinned() {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Backup.CreatedAt.After(entries[j].Backup.CreatedAt)
+	})
+
+	return entries, nil
+}
+
+func (c CatalogClient) listAll() ([]domain.CatalogEntry, error) {
+	var entries []domain.CatalogEntry
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return entries, err
+	}
+
+	for _, store := range dest.NewStores(c.Config.Destination) {
+		for _, container := range c.Config.Backup.Docker {
+			owned, _, err := dest.ListOwnedBackups(store, container.Name, hostname, container.LegacyPattern(c.Config.Destination.Retain))
+			if err != nil {
+				return entries, err
+			}
+
+			for _, backup := range owned {
+				entries = append(entries, domain.CatalogEntry{
+					Destination: store.Name(),
+					Backup:      backup,
+				})
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// Pins the backup so retention will never remove it and adds the tags.
+func (c CatalogClient) Pin(name string, tags []string) error {
+	return c.lockedUpdate(name, func(manifest *domain.BackupManifest) {
+		manifest.Pinned = true
+		manifest.Tags = addTags(manifest.Tags, tags)
+	})
+}
+
+// Lets retention remove the backup again.
+func (c CatalogClient) Unpin(name string) error {
+	return c.lockedUpdate(name, func(manifest *domain.BackupManifest) {
+		manifest.Pinned = false
+	})
+}
+
+// Adds or removes tags on the backup.
+func (c CatalogClient) Tag(name string, tags []string, remove bool) error {
+	return c.lockedUpdate(name, func(manifest *domain.BackupManifest) {
+		if remove {
+			manifest.Tags = removeTags(manifest.Tags, tags)
+			return
+		}
+		manifest.Tags = addTags(manifest.Tags, tags)
+	})
+}
+
+// Keeps other dvb processes from running retention while the manifests are changed.
+func (c CatalogClient) lockedUpdate(name string, change func(manifest *domain.BackupManifest)) error {
+	lock, err := AcquireLock(c.Config)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	return c.update(name, change)
+}
+
+// Finds every copy of the backup and writes the updated manifest.
+func (c CatalogClient) update(name string, change func(manifest *domain.BackupManifest)) error {
+	found := false
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	for _, store := range dest.NewStores(c.Config.Destination) {
+		// Retention in this process could remove the backup between the list and the write
+		unlock := destinationLocks.Lock(c.Config.Destination)
+		storeFound, err := c.updateStore(store, hostname, name, change)
+		unlock()
+		if err != nil {
+			return err
+		}
+		found = found || storeFound
+	}
+
+	if !found {
+		return errors.New(ErrBackupNotFound)
+	}
+
+	return nil
+}
+
+// Writes the updated manifest of every copy of the backup on the store.
+func (c CatalogClient) updateStore(store domain.BackupStore, hostname, name string, change func(manifest *domain.BackupManifest)) (bool, error) {
+	found := false
+
+	for _, container := range c.Config.Backup.Docker {
+		owned, _, err := dest.ListOwnedBackups(store, container.Name, hostname, container.LegacyPattern(c.Config.Destination.Retain))
+		if err != nil {
+			return found, err
+		}
+
+		for _, backup := range owned {
+			if backup.Name != name {
+				continue
+			}
+			found = true
+
+			// Backups made before manifests existed get one now
+			manifest := domain.BackupManifest{
+				Version:   domain.BackupManifestVersion,
+				Container: container.Name,
+				Host:      hostname,
+				FileName:  backup.Name,
+				CreatedAt: backup.CreatedAt,
+				Size:      backup.Size,
+			}
+			if backup.Manifest != nil {
+				manifest = *backup.Manifest
+			}
+
+			change(&manifest)
+			err = store.WriteManifest(backup, manifest)
+			if err != nil {
+				return found, err
+			}
+		}
+	}
+
+	return found, nil
+}
+
+func addTags(current, tags []string) []string {
+	for _, tag := range tags {
+		if !containsString(current, tag) {
+			current = append(current, tag)
+		}
+	}
+	return current
+}
+
+func removeTags(current, tags []string) []string {
+	var result []string
+	for _, tag := range current {
+		if !containsString(tags, tag) {
+			result = append(result, tag)
+		}
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
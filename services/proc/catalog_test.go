@@ -0,0 +1,111 @@
+package proc_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/proc"
+)
+
+func TestCatalogPinIsSkippedByRetention(t *testing.T) {
+	config := getPruneConfig(t)
+
+	catalog := proc.NewCatalogClient(proc.CatalogParams{})
+	catalog.Config = config
+	err := catalog.Pin("data-20221129.0.tar", []string{"pre-upgrade-v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prune := proc.NewPruneClient(proc.PruneParams{Container: "webdav"})
+	prune.Config = config
+	_, err = prune.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(filepath.Join(config.Destination.Local.Path, "webdav", "data-20221129.0.tar"))
+	if err != nil {
+		t.Error("the pinned backup was removed")
+	}
+
+	_, err = os.Stat(filepath.Join(config.Destination.Local.Path, "webdav", "data-20221130.0.tar"))
+	if err == nil {
+		t.Error("the backup that was not pinned was kept")
+	}
+}
+
+func TestCatalogListFilters(t *testing.T) {
+	config := getPruneConfig(t)
+
+	catalog := proc.NewCatalogClient(proc.CatalogParams{})
+	catalog.Config = config
+	err := catalog.Tag("db-20221130.0.tar", []string{"pre-upgrade-v2", "manual"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := catalog.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The manual.tar file is not owned by dvb
+	if len(all) != 5 {
+		t.Errorf("expected 5 backups but got %v", len(all))
+	}
+
+	catalog.Params.Tag = "pre-upgrade-v2"
+	tagged, err := catalog.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tagged) != 1 || tagged[0].Backup.Name != "db-20221130.0.tar" {
+		t.Errorf("expected the tagged backup but got %+v", tagged)
+	}
+
+	err = catalog.Tag("db-20221130.0.tar", []string{"pre-upgrade-v2"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tagged, err = catalog.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tagged) != 0 {
+		t.Errorf("expected the tag to be removed but found %v backups", len(tagged))
+	}
+}
+
+func TestCatalogPinUnknownBackup(t *testing.T) {
+	catalog := proc.NewCatalogClient(proc.CatalogParams{})
+	catalog.Config = getPruneConfig(t)
+
+	err := catalog.Pin("manual.tar", nil)
+	if err == nil {
+		t.Error("expected an error when pinning a file dvb did not make")
+	}
+}
+
+func TestCatalogPinWaitsForTheLock(t *testing.T) {
+	config := getPruneConfig(t)
+
+	// A backup or prune is running in another dvb process
+	lock, err := proc.AcquireLock(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Unlock()
+
+	catalog := proc.NewCatalogClient(proc.CatalogParams{})
+	catalog.Config = config
+	err = catalog.Pin("data-20221129.0.tar", nil)
+	if err == nil || err.Error() != common.ErrAlreadyRunning {
+		t.Errorf("expected %v but got %v", common.ErrAlreadyRunning, err)
+	}
+}
@@ -0,0 +1,55 @@
+package proc
+
+import (
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+// Reads the yaml config from disk.
+func LoadConfig(path string) (*domain.Config, error) {
+	var config domain.Config
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return &config, err
+	}
+
+	err = yaml.Unmarshal(content, &config)
+	if err != nil {
+		return &config, err
+	}
+
+	return &config, nil
+}
+
+// Takes the lock file in the state directory so only one dvb process works on the containers.
+func AcquireLock(config domain.Config) (*common.FileLock, error) {
+	dir, err := common.StateDirectory(config.Daemon.StateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	lock := common.NewFileLock(filepath.Join(dir, "dvb.lock"))
+	err = lock.Lock()
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// Creates the logger from Config.Log and makes it the default logger.
+func ConfigureLogger(config domain.Config) (*logger.Logger, error) {
+	log, err := logger.New(config.Log)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.SetDefault(log)
+	return log, nil
+}
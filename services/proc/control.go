@@ -0,0 +1,72 @@
+package proc
+
+import (
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/control"
+)
+
+type ControlParams struct {
+	ConfigPath string
+}
+
+type ControlClient struct {
+	Config domain.Config
+	Params ControlParams
+}
+
+// The control client sends commands to the daemon that is running with the same config.
+func NewControlClient(params ControlParams) ControlClient {
+	return ControlClient{
+		Params: params,
+	}
+}
+
+// Loads the config from the ConfigPath.
+func (c *ControlClient) LoadConfig() error {
+	config, err := LoadConfig(c.Params.ConfigPath)
+	if err != nil {
+		return err
+	}
+	c.Config = *config
+	return nil
+}
+
+// Asks the daemon to run the container now, or every container when it is empty.
+func (c ControlClient) Trigger(container string) (domain.ControlResponse, error) {
+	return c.send(domain.ControlRequest{
+		Command:   domain.ControlTrigger,
+		Container: container,
+	})
+}
+
+// Stops scheduled runs, a zero duration pauses until Resume is called.
+func (c ControlClient) Pause(duration time.Duration) (domain.ControlResponse, error) {
+	return c.send(domain.ControlRequest{
+		Command:  domain.ControlPause,
+		Duration: domain.Duration(duration),
+	})
+}
+
+func (c ControlClient) Resume() (domain.ControlResponse, error) {
+	return c.send(domain.ControlRequest{
+		Command: domain.ControlResume,
+	})
+}
+
+func (c ControlClient) Status() (domain.ControlResponse, error) {
+	return c.send(domain.ControlRequest{
+		Command: domain.ControlStatus,
+	})
+}
+
+func (c ControlClient) send(req domain.ControlRequest) (domain.ControlResponse, error) {
+	dir, err := common.StateDirectory(c.Config.Daemon.StateDir)
+	if err != nil {
+		return domain.ControlResponse{}, err
+	}
+
+	return control.Send(control.SocketPath(dir), req)
+}
@@ -0,0 +1,520 @@
+package proc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/api"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/control"
+	"github.com/jtom38/dvb/services/history"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	ErrNoJobsScheduled     = "daemon mode was requested but no container has a schedule"
+	ErrJobNotFound         = "no job was found for that container"
+	ErrShutdownInterrupted = "dvb was stopped while backups were running"
+
+	DefaultShutdownGrace       = time.Minute
+	DefaultConfigWatchInterval = 30 * time.Second
+	DefaultCatchUpDelay        = time.Minute
+)
+
+// The daemon owns the schedule and the config that is currently active.
+type daemon struct {
+	client    StartBackupClient
+	scheduler *RunScheduler
+	cron      *cron.Cron
+
+	mu      sync.RWMutex
+	entries []cron.EntryID
+
+	// Scheduled runs are skipped while paused, manual triggers still run.
+	paused      bool
+	pausedUntil time.Time
+	resumeTimer *time.Timer
+	// Counts the pauses, so a timer that fired while a newer pause was waiting for the lock does nothing.
+	pauseGeneration uint64
+}
+
+func newDaemon(client StartBackupClient) *daemon {
+	if client.tracker == nil {
+		client.tracker = NewRunTracker()
+	}
+	d := &daemon{
+		client: client,
+		cron:   cron.New(),
+	}
+
+	// Jobs always run with the config that is active when they start
+	d.scheduler = NewRunScheduler(RunSchedulerParams{
+		Overlap:     client.Config.Daemon.Overlap,
+		MaxParallel: client.Config.Daemon.MaxParallel,
+		Run:         func(ctx context.Context, job domain.Job) { d.current().RunJob(ctx, job) },
+		Logger:      client.log(),
+	})
+	return d
+}
+
+// The logger never changes after the daemon starts, so it can be read without the lock.
+func (d *daemon) log() *logger.Logger {
+	if d.client.logger == nil {
+		return logger.Default()
+	}
+	return d.client.logger
+}
+
+// Returns a copy of the client with the active config.
+func (d *daemon) current() StartBackupClient {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.client
+}
+
+func (d *daemon) Run() error {
+	err := d.schedule(d.client.Config)
+	if err != nil {
+		return err
+	}
+
+	d.cron.Start()
+
+	// Let dvb trigger, pause and resume talk to us
+	server, err := d.startControl()
+	if err != nil {
+		d.log().Error("The control socket could not be started, dvb trigger will not work", logger.KeyError, err)
+	} else {
+		defer server.Close()
+	}
+
+	if d.client.Config.Daemon.Api.Listen != "" {
+		server := api.NewServer(d.client.Config.Daemon.Api, d)
+		err = server.Start()
+		if err != nil {
+			return err
+		}
+		defer server.Shutdown(context.Background())
+	}
+
+	if d.client.Config.Daemon.CatchUp {
+		d.catchUp(d.client.Config.Daemon.CatchUpDelay.OrDefault(DefaultCatchUpDelay))
+	}
+
+	// Check if we get a request to stop the app or reload the config
+	ch := make(chan os.Signal, 6)
+	signal.Notify(ch,
+		syscall.SIGTERM,
+		syscall.SIGINT,
+		syscall.SIGQUIT,
+		syscall.SIGHUP,
+	)
+	signal.Notify(ch, triggerAllSignals...)
+
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	if d.client.Config.Daemon.WatchConfig {
+		go d.watchConfig(d.client.Config.Daemon.WatchInterval.OrDefault(DefaultConfigWatchInterval), stopWatch)
+	}
+
+	for {
+		req := <-ch
+		if isTriggerAllSignal(req) {
+			d.log().Info("A signal was received, running every job", "signal", req)
+			d.Trigger("")
+			continue
+		}
+
+		switch req {
+		case syscall.SIGHUP:
+			d.log().Info("SIGHUP was received, reloading the config")
+			d.reload()
+		case syscall.SIGTERM:
+			fallthrough
+		case syscall.SIGINT:
+			signal.Stop(ch)
+			d.shutdown(d.current().Config.Daemon.ShutdownGrace.OrDefault(DefaultShutdownGrace))
+			return nil
+		case syscall.SIGQUIT:
+			// Don't wait for anything, but still put the containers back the way we found them
+			signal.Stop(ch)
+			d.shutdown(0)
+			return nil
+		}
+	}
+}
+
+// Replaces the scheduled jobs with the jobs in the config.
+// Backups that are already running are not touched.
+func (d *daemon) schedule(config domain.Config) error {
+	type pending struct {
+		job      domain.Job
+		spec     string
+		schedule cron.Schedule
+	}
+	var jobs []pending
+
+	// Parse everything first so a bad schedule leaves the old jobs in place
+	for _, job := range NewJobs(config) {
+		if len(job.Schedule) == 0 {
+			d.log().Warn("The job does not have a schedule and will not run in daemon mode", logger.KeyJob, job.Name)
+			continue
+		}
+
+		for _, spec := range job.Schedule {
+			schedule, err := ParseSchedule(spec)
+			if err != nil {
+				return fmt.Errorf("%v: %v", job.Name, err)
+			}
+			jobs = append(jobs, pending{job: job, spec: spec, schedule: schedule})
+		}
+	}
+
+	if len(jobs) == 0 {
+		return errors.New(ErrNoJobsScheduled)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, id := range d.entries {
+		d.cron.Remove(id)
+	}
+	d.entries = nil
+
+	for _, item := range jobs {
+		job := item.job
+		id := d.cron.Schedule(item.schedule, cron.FuncJob(func() {
+			if d.isPaused() {
+				d.log().Info("Cron was triggered but the daemon is paused", logger.KeyJob, job.Name)
+				return
+			}
+			d.log().Info("Cron was triggered", logger.KeyJob, job.Name)
+			d.scheduler.Trigger(job)
+		}))
+		d.entries = append(d.entries, id)
+		d.log().Info("The job was scheduled", logger.KeyJob, job.Name, "schedule", item.spec, "next", item.schedule.Next(time.Now()))
+	}
+
+	d.client.SetConfig(config)
+	return nil
+}
+
+// Runs the jobs that missed their schedule while dvb was offline after the delay.
+func (d *daemon) catchUp(delay time.Duration) {
+	c := d.current()
+	if c.state == nil {
+		return
+	}
+
+	state, err := c.state.Load()
+	if err != nil {
+		d.log().Error("Unable to read the state file, skipping catch up", logger.KeyError, err)
+		return
+	}
+
+	due := DueJobs(NewJobs(c.Config), state, time.Now())
+	for _, job := range due {
+		job := job
+		d.log().Info("The job missed its schedule and will catch up", logger.KeyJob, job.Name, "delay", delay)
+		time.AfterFunc(delay, func() {
+			if d.isPaused() {
+				d.log().Info("The job was not caught up because the daemon is paused", logger.KeyJob, job.Name)
+				return
+			}
+			d.log().Info("Catching up on the job", logger.KeyJob, job.Name)
+			d.scheduler.Trigger(job)
+		})
+	}
+}
+
+// Loads the config from disk and swaps it in if it is valid.
+// A bad config is rejected and the old config stays active.
+func (d *daemon) reload() {
+	old := d.current()
+
+	config, err := LoadConfig(old.Params.ConfigPath)
+	if err == nil {
+		err = ValidateConfig(*config)
+	}
+	if err == nil {
+		err = d.schedule(*config)
+	}
+	if err != nil {
+		logs := d.log().WithRecorder(logger.NewRecorder())
+		logs.Error("The new config was rejected, the old config is still active.", logger.KeyError, err)
+		old.SendAlert(newDaemonResult(err, "", logs))
+		return
+	}
+
+	if config.Daemon.MaxParallel != old.Config.Daemon.MaxParallel || config.Daemon.Overlap != old.Config.Daemon.Overlap {
+		d.log().Warn("MaxParallel and Overlap changes will be used after dvb is restarted")
+	}
+	if config.Daemon.Api != old.Config.Daemon.Api {
+		d.log().Warn("Api changes will be used after dvb is restarted")
+	}
+	if config.Log != old.Config.Log {
+		d.log().Warn("Log changes will be used after dvb is restarted")
+	}
+	d.log().Info("The config was reloaded.")
+}
+
+// Reloads the config when the file changes on disk.
+func (d *daemon) watchConfig(interval time.Duration, stop chan struct{}) {
+	path := d.current().Params.ConfigPath
+	last, _ := os.Stat(path)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		if last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size() {
+			continue
+		}
+		last = info
+
+		d.log().Info("The config file changed, reloading the config")
+		d.reload()
+	}
+}
+
+// Stops scheduling new runs and waits for the running backups to finish.
+// Anything still running after the grace period is cancelled and reported in an alert.
+func (d *daemon) shutdown(grace time.Duration) {
+	d.log().Info("Shutting down, waiting for running backups to finish", "grace", grace)
+	<-d.cron.Stop().Done()
+
+	interrupted := d.scheduler.Shutdown(grace)
+	if len(interrupted) == 0 {
+		d.log().Info("All backups finished, goodbye.")
+		return
+	}
+
+	c := d.current()
+	logs := d.log().WithRecorder(logger.NewRecorder())
+	logs.Error(fmt.Sprintf("dvb was stopped while these backups were running: %v", strings.Join(interrupted, ", ")))
+	logs.Info("The backups were cancelled and the containers were started again.")
+	c.SendAlert(newDaemonResult(errors.New(ErrShutdownInterrupted), strings.Join(interrupted, ", "), logs))
+}
+
+// The result for alerts about the daemon itself rather than a single backup.
+func newDaemonResult(result error, container string, logs *logger.Logger) domain.RunResult {
+	now := time.Now()
+	host, _ := os.Hostname()
+
+	record := domain.RunRecord{
+		Container:  container,
+		Host:       host,
+		StartedAt:  now,
+		FinishedAt: now,
+		Success:    result == nil,
+	}
+	if result != nil {
+		record.Error = result.Error()
+	}
+
+	return domain.RunResult{
+		RunRecord: record,
+		Records:   logs.Records(),
+	}
+}
+
+func (d *daemon) startControl() (*control.Server, error) {
+	dir, err := common.StateDirectory(d.current().Config.Daemon.StateDir)
+	if err != nil {
+		return nil, err
+	}
+
+	server := control.NewServer(control.SocketPath(dir), d)
+	err = server.Start()
+	if err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// Runs the job with the container name right away, or every job when name is empty.
+func (d *daemon) Trigger(name string) ([]string, []string, error) {
+	var triggered []string
+	var skipped []string
+
+	found := false
+	for _, job := range NewJobs(d.current().Config) {
+		if name != "" && job.Name != name {
+			continue
+		}
+		found = true
+
+		d.log().Info("A manual run was requested", logger.KeyJob, job.Name)
+		if d.scheduler.Trigger(job) {
+			triggered = append(triggered, job.Name)
+		} else {
+			skipped = append(skipped, job.Name)
+		}
+	}
+
+	if !found {
+		return triggered, skipped, fmt.Errorf("%v '%v'", ErrJobNotFound, name)
+	}
+	return triggered, skipped, nil
+}
+
+// Skips scheduled runs until Resume is called, or until the duration has passed when it is set.
+func (d *daemon) Pause(duration time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.paused = true
+	d.pausedUntil = time.Time{}
+	d.pauseGeneration++
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+
+	if duration > 0 {
+		generation := d.pauseGeneration
+		d.pausedUntil = time.Now().Add(duration)
+		d.resumeTimer = time.AfterFunc(duration, func() { d.resumePause(generation) })
+		d.log().Info("Scheduled runs are paused", "until", d.pausedUntil)
+		return
+	}
+	d.log().Info("Scheduled runs are paused until dvb resume is sent")
+}
+
+func (d *daemon) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.resume()
+}
+
+// Resumes when the pause the timer was started for is still the current one.
+func (d *daemon) resumePause(generation uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if generation != d.pauseGeneration {
+		return
+	}
+	d.resume()
+}
+
+// The caller holds the lock.
+func (d *daemon) resume() {
+	if !d.paused {
+		return
+	}
+
+	d.paused = false
+	d.pausedUntil = time.Time{}
+	if d.resumeTimer != nil {
+		d.resumeTimer.Stop()
+		d.resumeTimer = nil
+	}
+	d.log().Info("Scheduled runs have resumed")
+}
+
+func (d *daemon) Status() domain.DaemonStatus {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return domain.DaemonStatus{
+		Paused:      d.paused,
+		PausedUntil: d.pausedUntil,
+		Active:      d.scheduler.Active(),
+	}
+}
+
+func (d *daemon) isPaused() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.paused
+}
+
+func isTriggerAllSignal(sig os.Signal) bool {
+	for _, s := range triggerAllSignals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns every job with its schedule and the state from the last run.
+func (d *daemon) Jobs() ([]domain.JobStatus, error) {
+	c := d.current()
+
+	state := domain.RunState{Jobs: make(map[string]domain.JobState)}
+	if c.state != nil {
+		var err error
+		state, err = c.state.Load()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return jobStatuses(c.Config, state, time.Now()), nil
+}
+
+func (d *daemon) Runs() []domain.RunProgress {
+	return d.current().tracker.Runs()
+}
+
+func (d *daemon) History(container string, limit int) []domain.RunRecord {
+	c := d.current()
+	if c.history == nil {
+		return c.tracker.History(container, limit)
+	}
+
+	records, err := c.history.List(history.Filter{Container: container, Limit: limit})
+	if err != nil {
+		d.log().Warn("Unable to read the history, only showing runs since the daemon started", logger.KeyError, err)
+		return c.tracker.History(container, limit)
+	}
+	return records
+}
+
+func (d *daemon) Backups(container string, tag string, pinned bool) ([]domain.CatalogEntry, error) {
+	client := NewCatalogClient(CatalogParams{
+		Container: container,
+		Tag:       tag,
+		Pinned:    pinned,
+	})
+	client.Config = d.current().Config
+	return client.List()
+}
+
+func (d *daemon) Prune(container string, dryRun bool) ([]domain.PruneSummary, error) {
+	client := NewPruneClient(PruneParams{
+		Container: container,
+		DryRun:    dryRun,
+	})
+	client.Config = d.current().Config
+	return client.Prune()
+}
+
+func (d *daemon) WriteMetrics(w io.Writer) error {
+	return d.current().metrics.Write(w)
+}
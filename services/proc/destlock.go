@@ -0,0 +1,53 @@
+package proc
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/dest"
+)
+
+// Every container writes to and deletes from the same destinations.
+// Jobs that run at the same time take turns changing them, so retention and quotas see what is really there.
+// Other dvb processes are kept out by the process lock.
+var destinationLocks = newDestinationLocks()
+
+type destinationLock struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newDestinationLocks() *destinationLock {
+	return &destinationLock{locks: make(map[string]*sync.Mutex)}
+}
+
+// Locks every destination in the config and returns the func that unlocks them.
+// They are always locked in name order, so two jobs can not wait on each other.
+func (l *destinationLock) Lock(config domain.ConfigDest) func() {
+	var names []string
+	for _, store := range dest.NewStores(config) {
+		names = append(names, store.Name())
+	}
+	sort.Strings(names)
+
+	var held []*sync.Mutex
+	for _, name := range names {
+		l.mu.Lock()
+		lock, ok := l.locks[name]
+		if !ok {
+			lock = &sync.Mutex{}
+			l.locks[name] = lock
+		}
+		l.mu.Unlock()
+
+		lock.Lock()
+		held = append(held, lock)
+	}
+
+	return func() {
+		for i := len(held) - 1; i >= 0; i-- {
+			held[i].Unlock()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package proc
+
+import (
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/history"
+)
+
+type HistoryParams struct {
+	ConfigPath string
+}
+
+type HistoryClient struct {
+	Config domain.Config
+	Params HistoryParams
+}
+
+// The history client reads past runs from the history file without needing the daemon.
+func NewHistoryClient(params HistoryParams) HistoryClient {
+	return HistoryClient{
+		Params: params,
+	}
+}
+
+// Loads the config from the ConfigPath.
+func (c *HistoryClient) LoadConfig() error {
+	config, err := LoadConfig(c.Params.ConfigPath)
+	if err != nil {
+		return err
+	}
+	c.Config = *config
+	return nil
+}
+
+// Returns the runs that match the filter, newest first.
+func (c HistoryClient) List(filter history.Filter) ([]domain.RunRecord, error) {
+	store, err := c.store()
+	if err != nil {
+		return []domain.RunRecord{}, err
+	}
+	return store.List(filter)
+}
+
+// Returns a single run by its id.
+func (c HistoryClient) Get(id string) (domain.RunRecord, error) {
+	store, err := c.store()
+	if err != nil {
+		return domain.RunRecord{}, err
+	}
+	return store.Get(id)
+}
+
+func (c HistoryClient) store() (*history.Store, error) {
+	dir, err := common.StateDirectory(c.Config.Daemon.StateDir)
+	if err != nil {
+		return nil, err
+	}
+	return history.NewStore(dir, c.Config.History), nil
+}
@@ -0,0 +1,105 @@
+package proc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+// Builds a job for each container in the config.
+// Containers without a schedule use the global Daemon.Cron.
+func NewJobs(config domain.Config) []domain.Job {
+	var jobs []domain.Job
+
+	for _, container := range config.Backup.Docker {
+		job := domain.Job{
+			Name:      container.Name,
+			Container: container,
+			Schedule:  container.Schedule,
+		}
+
+		if len(job.Schedule) == 0 && config.Daemon.Cron != "" {
+			job.Schedule = []string{config.Daemon.Cron}
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs
+}
+
+// Parses the cron expression.
+// This supports the standard 5 fields, descriptors like @daily or @every 6h and a CRON_TZ= prefix.
+func ParseSchedule(spec string) (cron.Schedule, error) {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule '%v': %v", spec, err)
+	}
+	return schedule, nil
+}
+
+// Returns the jobs that missed a scheduled run since their last success.
+// Jobs that have never finished a backup are always due.
+func DueJobs(jobs []domain.Job, state domain.RunState, now time.Time) []domain.Job {
+	var due []domain.Job
+
+	for _, job := range jobs {
+		last := state.Jobs[job.Name].LastSuccess
+		if len(job.Schedule) == 0 {
+			continue
+		}
+
+		if last.IsZero() {
+			due = append(due, job)
+			continue
+		}
+
+		for _, spec := range job.Schedule {
+			schedule, err := ParseSchedule(spec)
+			if err != nil {
+				continue
+			}
+
+			if schedule.Next(last).Before(now) {
+				due = append(due, job)
+				break
+			}
+		}
+	}
+
+	return due
+}
+
+// Returns the next time the job will run, zero when it is not scheduled.
+func NextRun(job domain.Job, now time.Time) time.Time {
+	var next time.Time
+
+	for _, spec := range job.Schedule {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			continue
+		}
+
+		t := schedule.Next(now)
+		if next.IsZero() || t.Before(next) {
+			next = t
+		}
+	}
+
+	return next
+}
+
+// Returns a short random id that ties the logs, history and alerts of a run together.
+func NewRunId() string {
+	b := make([]byte, 6)
+	_, err := rand.Read(b)
+	if err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,124 @@
+package proc_test
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/proc"
+)
+
+func TestNewJobsScheduleFallback(t *testing.T) {
+	content := `
+Daemon:
+  Cron: "0 0 * * *"
+Backup:
+  Docker:
+    - Name: app-db-01
+      Schedule: "@hourly"
+    - Name: media
+      Schedule:
+        - "CRON_TZ=Europe/London 0 3 * * 0"
+        - "@every 6h"
+    - Name: webdav
+`
+	var config domain.Config
+	err := yaml.Unmarshal([]byte(content), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobs := proc.NewJobs(config)
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 jobs but got %v", len(jobs))
+	}
+
+	expected := map[string]int{"app-db-01": 1, "media": 2, "webdav": 1}
+	for _, job := range jobs {
+		if len(job.Schedule) != expected[job.Name] {
+			t.Errorf("%v: expected %v schedules but got %v", job.Name, expected[job.Name], len(job.Schedule))
+		}
+
+		for _, spec := range job.Schedule {
+			_, err := proc.ParseSchedule(spec)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+	}
+
+	if jobs[2].Schedule[0] != "0 0 * * *" {
+		t.Errorf("expected webdav to use the global cron but got %v", jobs[2].Schedule)
+	}
+}
+
+func TestNewJobsWithoutSchedule(t *testing.T) {
+	config := domain.Config{
+		Backup: domain.BackupConfig{
+			Docker: []domain.ContainerDocker{{Name: "webdav"}},
+		},
+	}
+
+	jobs := proc.NewJobs(config)
+	if len(jobs[0].Schedule) != 0 {
+		t.Errorf("expected no schedule but got %v", jobs[0].Schedule)
+	}
+
+	if config.HasSchedules() {
+		t.Error("expected the config to not have any schedules")
+	}
+}
+
+func TestParseSchedule(t *testing.T) {
+	schedule, err := proc.ParseSchedule("@every 6h")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC)
+	if schedule.Next(now) != now.Add(6*time.Hour) {
+		t.Errorf("unexpected next run %v", schedule.Next(now))
+	}
+
+	_, err = proc.ParseSchedule("61 * * * *")
+	if err == nil {
+		t.Error("expected an invalid schedule to fail")
+	}
+}
+
+func TestDueJobs(t *testing.T) {
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.Local)
+	jobs := []domain.Job{
+		{Name: "on-time", Schedule: []string{"0 3 * * *"}},
+		{Name: "missed", Schedule: []string{"0 3 * * *"}},
+		{Name: "never-ran", Schedule: []string{"@hourly"}},
+		{Name: "not-scheduled"},
+	}
+	state := domain.RunState{
+		Jobs: map[string]domain.JobState{
+			"on-time": {LastSuccess: time.Date(2022, 12, 1, 3, 0, 0, 0, time.Local)},
+			"missed":  {LastSuccess: time.Date(2022, 11, 30, 2, 0, 0, 0, time.Local)},
+		},
+	}
+
+	due := proc.DueJobs(jobs, state, now)
+	if len(due) != 2 || due[0].Name != "missed" || due[1].Name != "never-ran" {
+		t.Errorf("unexpected due jobs %v", due)
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	now := time.Date(2022, 12, 1, 12, 0, 0, 0, time.Local)
+	job := domain.Job{Schedule: []string{"0 3 * * *", "30 12 * * *"}}
+
+	next := proc.NextRun(job, now)
+	if !next.Equal(time.Date(2022, 12, 1, 12, 30, 0, 0, time.Local)) {
+		t.Errorf("unexpected next run %v", next)
+	}
+
+	if !proc.NextRun(domain.Job{}, now).IsZero() {
+		t.Error("a job without a schedule should not have a next run")
+	}
+}
@@ -0,0 +1,189 @@
+package proc
+
+import (
+	"errors"
+	"os"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/dest"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	ErrPruneContainerNotFound = "the requested container was not found in the config"
+)
+
+type PruneParams struct {
+	ConfigPath string
+	DryRun     bool
+
+	// When set only this container will be pruned.
+	Container string
+}
+
+type PruneClient struct {
+	Config domain.Config
+	Params PruneParams
+}
+
+// Applies the retention policy to every destination without taking a new backup.
+func NewPruneClient(params PruneParams) PruneClient {
+	return PruneClient{
+		Params: params,
+	}
+}
+
+// Loads the config, takes the process lock and prunes every destination.
+func (c PruneClient) RunProcess() ([]domain.PruneSummary, error) {
+	config, err := LoadConfig(c.Params.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	c.Config = *config
+
+	log, err := ConfigureLogger(c.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+
+	lock, err := AcquireLock(c.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	return c.Prune()
+}
+
+// Runs retention against all containers and returns the totals per destination.
+func (c PruneClient) Prune() ([]domain.PruneSummary, error) {
+	var summaries []domain.PruneSummary
+	found := false
+	index := make(map[string]int)
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return summaries, err
+	}
+
+	for _, container := range c.Config.Backup.Docker {
+		if c.Params.Container != "" && c.Params.Container != container.Name {
+			continue
+		}
+		found = true
+
+		log := logger.Default().With(logger.KeyContainer, container.Name)
+		log.Info("Pruning the container")
+		// The daemon api can prune while jobs are running
+		unlock := destinationLocks.Lock(c.Config.Destination)
+		results, err := applyRetention(c.Config, container, hostname, c.Params.DryRun, log)
+		unlock()
+		if err != nil {
+			return summaries, err
+		}
+
+		for _, result := range results {
+			i, ok := index[result.Destination]
+			if !ok {
+				i = len(summaries)
+				index[result.Destination] = i
+				summaries = append(summaries, domain.PruneSummary{Destination: result.Destination})
+			}
+
+			summaries[i].Removed = summaries[i].Removed + len(result.Result.Removed)
+			summaries[i].FreedBytes = summaries[i].FreedBytes + result.Result.FreedBytes
+			summaries[i].Foreign = summaries[i].Foreign + len(result.Result.Foreign)
+		}
+	}
+
+	if c.Params.Container != "" && !found {
+		return summaries, errors.New(ErrPruneContainerNotFound)
+	}
+
+	return summaries, nil
+}
+
+// The outcome of retention on one destination for one container.
+type retainSummary struct {
+	Destination string
+	Container   string
+	Result      dest.RetainResult
+}
+
+// Applies the configured retention for the container on every destination.
+// The caller holds the destination lock.
+func applyRetention(config domain.Config, container domain.ContainerDocker, hostname string, dryRun bool, log *logger.Logger) ([]retainSummary, error) {
+	var summaries []retainSummary
+
+	for _, store := range dest.NewStores(config.Destination) {
+		client := dest.NewRetainClient(dest.RetainParams{
+			Store:         store,
+			Policy:        container.RetainPolicy(config.Destination.Retain),
+			ContainerName: container.Name,
+			Hostname:      hostname,
+			Pattern:       container.LegacyPattern(config.Destination.Retain),
+			DryRun:        dryRun,
+			Logger:        log,
+		})
+
+		result, err := client.Apply()
+		if err != nil {
+			return summaries, err
+		}
+
+		summaries = append(summaries, retainSummary{
+			Destination: store.Name(),
+			Container:   container.Name,
+			Result:      result,
+		})
+	}
+
+	return summaries, nil
+}
+
+func newQuotaContainer(config domain.Config, container domain.ContainerDocker) dest.QuotaContainer {
+	policy := container.RetainPolicy(config.Destination.Retain)
+	return dest.QuotaContainer{
+		Name:     container.Name,
+		Pattern:  container.LegacyPattern(config.Destination.Retain),
+		MinKeep:  policy.MinKeep,
+		MaxBytes: int64(policy.MaxBytes),
+	}
+}
+
+// Removes the oldest backups on every destination until a new backup of the given size fits.
+// The caller holds the destination lock until the backup has been moved.
+func makeRoom(config domain.Config, container domain.ContainerDocker, hostname string, size int64, log *logger.Logger) ([]retainSummary, error) {
+	var (
+		summaries  []retainSummary
+		containers []dest.QuotaContainer
+	)
+
+	for _, item := range config.Backup.Docker {
+		containers = append(containers, newQuotaContainer(config, item))
+	}
+
+	for _, store := range dest.NewStores(config.Destination) {
+		client := dest.NewQuotaClient(dest.QuotaParams{
+			Store:      store,
+			Hostname:   hostname,
+			Container:  newQuotaContainer(config, container),
+			Containers: containers,
+			Logger:     log,
+		})
+
+		result, err := client.MakeRoom(size)
+		if err != nil {
+			return summaries, err
+		}
+
+		summaries = append(summaries, retainSummary{
+			Destination: store.Name(),
+			Container:   container.Name,
+			Result:      result,
+		})
+	}
+
+	return summaries, nil
+}
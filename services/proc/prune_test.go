@@ -0,0 +1,116 @@
+package proc_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/proc"
+)
+
+func getPruneConfig(t *testing.T) domain.Config {
+	root := t.TempDir()
+
+	for _, name := range []string{
+		"webdav/data-20221129.0.tar",
+		"webdav/data-20221130.0.tar",
+		"webdav/data-20221201.0.tar",
+		"webdav/manual.tar",
+		"app-db/db-20221130.0.tar",
+		"app-db/db-20221201.0.tar",
+	} {
+		p := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile(p, []byte("backup"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return domain.Config{
+		Daemon: domain.ConfigDaemon{StateDir: t.TempDir()},
+		Backup: domain.BackupConfig{
+			Docker: []domain.ContainerDocker{
+				{Name: "webdav", Tar: domain.ConfigContainerTar{Pattern: "data-{{DATE}}"}},
+				{Name: "app-db", Tar: domain.ConfigContainerTar{Pattern: "db-{{DATE}}"}},
+			},
+		},
+		Destination: domain.ConfigDest{
+			Retain: domain.ConfigRetain{KeepLast: 1, AdoptLegacy: true},
+			Local:  domain.ConfigDestLocal{Path: root},
+		},
+	}
+}
+
+func TestPruneDryRun(t *testing.T) {
+	c := proc.NewPruneClient(proc.PruneParams{DryRun: true})
+	c.Config = getPruneConfig(t)
+
+	summaries, err := c.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(summaries) != 1 {
+		t.Fatalf("expected 1 destination but got %v", len(summaries))
+	}
+
+	if summaries[0].Removed != 3 || summaries[0].FreedBytes != 18 || summaries[0].Foreign != 1 {
+		t.Errorf("unexpected summary: %+v", summaries[0])
+	}
+
+	_, err = os.Stat(filepath.Join(c.Config.Destination.Local.Path, "webdav", "data-20221129.0.tar"))
+	if err != nil {
+		t.Error("the dry run removed a backup")
+	}
+}
+
+func TestPruneIgnoresBackupsWithoutManifest(t *testing.T) {
+	c := proc.NewPruneClient(proc.PruneParams{DryRun: true})
+	c.Config = getPruneConfig(t)
+	c.Config.Destination.Retain.AdoptLegacy = false
+
+	summaries, err := c.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Another host could have made them, so they are foreign without AdoptLegacy
+	if summaries[0].Removed != 0 || summaries[0].Foreign != 6 {
+		t.Errorf("unexpected summary: %+v", summaries[0])
+	}
+}
+
+func TestPruneContainer(t *testing.T) {
+	c := proc.NewPruneClient(proc.PruneParams{Container: "app-db"})
+	c.Config = getPruneConfig(t)
+
+	summaries, err := c.Prune()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if summaries[0].Removed != 1 {
+		t.Errorf("expected 1 backup to be removed but got %v", summaries[0].Removed)
+	}
+
+	_, err = os.Stat(filepath.Join(c.Config.Destination.Local.Path, "app-db", "db-20221130.0.tar"))
+	if err == nil {
+		t.Error("the old backup was not removed")
+	}
+}
+
+func TestPruneUnknownContainer(t *testing.T) {
+	c := proc.NewPruneClient(proc.PruneParams{Container: "missing"})
+	c.Config = getPruneConfig(t)
+
+	_, err := c.Prune()
+	if err == nil {
+		t.Error("expected an error for a container that is not in the config")
+	}
+}
@@ -0,0 +1,179 @@
+package proc
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+type RunSchedulerParams struct {
+	// What to do when a job is triggered while it is still running, skip or queue.
+	Overlap string
+
+	// How many jobs can run at the same time, defaults to 1.
+	MaxParallel int
+
+	// Called to run the job, the context is cancelled when the scheduler is shut down.
+	Run func(ctx context.Context, job domain.Job)
+
+	// Defaults to logger.Default.
+	Logger *logger.Logger
+}
+
+// The run scheduler makes sure a job never overlaps with itself and limits how many jobs run at once.
+type RunScheduler struct {
+	params RunSchedulerParams
+	slots  chan struct{}
+	wg     sync.WaitGroup
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+	active map[string]bool
+	queued map[string]domain.Job
+}
+
+func NewRunScheduler(params RunSchedulerParams) *RunScheduler {
+	if params.MaxParallel <= 0 {
+		params.MaxParallel = 1
+	}
+
+	if params.Overlap == "" {
+		params.Overlap = domain.DaemonOverlapSkip
+	}
+
+	if params.Logger == nil {
+		params.Logger = logger.Default()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &RunScheduler{
+		params: params,
+		slots:  make(chan struct{}, params.MaxParallel),
+		ctx:    ctx,
+		cancel: cancel,
+		active: make(map[string]bool),
+		queued: make(map[string]domain.Job),
+	}
+}
+
+// Starts the job in the background.
+// Returns false when the job is already running and the trigger was skipped or queued.
+func (s *RunScheduler) Trigger(job domain.Job) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		s.params.Logger.Warn("The job was not started because dvb is shutting down", logger.KeyJob, job.Name)
+		return false
+	}
+
+	if s.active[job.Name] {
+		if s.params.Overlap == domain.DaemonOverlapQueue {
+			s.params.Logger.Info("The job is still running, the trigger was queued", logger.KeyJob, job.Name)
+			s.queued[job.Name] = job
+			return false
+		}
+
+		s.params.Logger.Warn("The job is still running, the trigger was skipped", logger.KeyJob, job.Name)
+		return false
+	}
+
+	s.active[job.Name] = true
+	s.wg.Add(1)
+	go s.execute(job)
+	return true
+}
+
+// Returns true if the job is running or waiting for a free slot.
+func (s *RunScheduler) IsActive(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.active[name]
+}
+
+// Returns the names of the jobs that are running or waiting for a free slot.
+func (s *RunScheduler) Active() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+	for name := range s.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Blocks until every job, including queued triggers, has finished.
+func (s *RunScheduler) Wait() {
+	s.wg.Wait()
+}
+
+// Stops new jobs from starting and waits up to the grace period for running jobs to finish.
+// After that the running jobs are cancelled, and the names of the jobs that were interrupted are returned.
+func (s *RunScheduler) Shutdown(grace time.Duration) []string {
+	s.mu.Lock()
+	s.closed = true
+	s.queued = make(map[string]domain.Job)
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return nil
+	case <-timer.C:
+	}
+
+	interrupted := s.Active()
+	s.params.Logger.Warn("Cancelling the backups that are still running", "jobs", strings.Join(interrupted, ", "))
+	s.cancel()
+
+	// Give the jobs a chance to clean up, like starting the containers again
+	<-done
+	return interrupted
+}
+
+func (s *RunScheduler) execute(job domain.Job) {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case s.slots <- struct{}{}:
+			if s.ctx.Err() == nil {
+				s.params.Run(s.ctx, job)
+			} else {
+				s.params.Logger.Warn("The job was cancelled before it started", logger.KeyJob, job.Name)
+			}
+			<-s.slots
+		case <-s.ctx.Done():
+			s.params.Logger.Warn("The job was cancelled before it started", logger.KeyJob, job.Name)
+		}
+
+		// Run again if a trigger came in while we were busy
+		s.mu.Lock()
+		next, ok := s.queued[job.Name]
+		if !ok {
+			delete(s.active, job.Name)
+			s.mu.Unlock()
+			return
+		}
+		delete(s.queued, job.Name)
+		s.mu.Unlock()
+		job = next
+	}
+}
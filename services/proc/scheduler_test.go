@@ -0,0 +1,150 @@
+package proc_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/proc"
+)
+
+func TestRunSchedulerSkipsOverlap(t *testing.T) {
+	var runs int32
+	release := make(chan struct{})
+
+	s := proc.NewRunScheduler(proc.RunSchedulerParams{
+		Overlap: domain.DaemonOverlapSkip,
+		Run: func(ctx context.Context, job domain.Job) {
+			atomic.AddInt32(&runs, 1)
+			<-release
+		},
+	})
+
+	job := domain.Job{Name: "webdav"}
+	if !s.Trigger(job) {
+		t.Fatal("the first trigger should start the job")
+	}
+	if s.Trigger(job) {
+		t.Error("the second trigger should have been skipped")
+	}
+
+	close(release)
+	s.Wait()
+
+	if runs != 1 {
+		t.Errorf("expected 1 run but got %v", runs)
+	}
+}
+
+func TestRunSchedulerQueuesOverlap(t *testing.T) {
+	var runs int32
+	release := make(chan struct{})
+
+	s := proc.NewRunScheduler(proc.RunSchedulerParams{
+		Overlap: domain.DaemonOverlapQueue,
+		Run: func(ctx context.Context, job domain.Job) {
+			atomic.AddInt32(&runs, 1)
+			<-release
+		},
+	})
+
+	job := domain.Job{Name: "webdav"}
+	s.Trigger(job)
+	s.Trigger(job)
+	// Triggers are combined so only one run is queued
+	s.Trigger(job)
+
+	close(release)
+	s.Wait()
+
+	if runs != 2 {
+		t.Errorf("expected 2 runs but got %v", runs)
+	}
+}
+
+func TestRunSchedulerMaxParallel(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running int
+		peak    int
+	)
+
+	s := proc.NewRunScheduler(proc.RunSchedulerParams{
+		MaxParallel: 2,
+		Run: func(ctx context.Context, job domain.Job) {
+			mu.Lock()
+			running++
+			if running > peak {
+				peak = running
+			}
+			mu.Unlock()
+
+			time.Sleep(20 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+		},
+	})
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		s.Trigger(domain.Job{Name: name})
+	}
+	s.Wait()
+
+	if peak != 2 {
+		t.Errorf("expected at most 2 jobs at once but saw %v", peak)
+	}
+}
+
+func TestRunSchedulerShutdownWaits(t *testing.T) {
+	var finished int32
+
+	s := proc.NewRunScheduler(proc.RunSchedulerParams{
+		Run: func(ctx context.Context, job domain.Job) {
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&finished, 1)
+		},
+	})
+	s.Trigger(domain.Job{Name: "webdav"})
+
+	interrupted := s.Shutdown(time.Second)
+	if len(interrupted) != 0 {
+		t.Errorf("expected nothing to be interrupted but got %v", interrupted)
+	}
+
+	if finished != 1 {
+		t.Error("shutdown did not wait for the job to finish")
+	}
+
+	if s.Trigger(domain.Job{Name: "webdav"}) {
+		t.Error("a job was started after shutdown")
+	}
+}
+
+func TestRunSchedulerShutdownCancels(t *testing.T) {
+	var cleaned int32
+
+	s := proc.NewRunScheduler(proc.RunSchedulerParams{
+		MaxParallel: 1,
+		Run: func(ctx context.Context, job domain.Job) {
+			<-ctx.Done()
+			atomic.AddInt32(&cleaned, 1)
+		},
+	})
+	s.Trigger(domain.Job{Name: "app-db"})
+	s.Trigger(domain.Job{Name: "webdav"})
+
+	interrupted := s.Shutdown(20 * time.Millisecond)
+	if len(interrupted) != 2 || interrupted[0] != "app-db" || interrupted[1] != "webdav" {
+		t.Errorf("unexpected interrupted jobs %v", interrupted)
+	}
+
+	// Only the job that was running had something to clean up
+	if cleaned != 1 {
+		t.Errorf("expected 1 job to be cancelled but got %v", cleaned)
+	}
+}
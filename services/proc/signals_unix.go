@@ -0,0 +1,11 @@
+//go:build !windows
+
+package proc
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signals that run every job right away.
+var triggerAllSignals = []os.Signal{syscall.SIGUSR1}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package proc
+
+import "os"
+
+// Windows has no SIGUSR1, use dvb trigger instead.
+var triggerAllSignals = []os.Signal{}
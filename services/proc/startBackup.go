@@ -1,21 +1,22 @@
 package proc
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"os"
-	"os/signal"
-	"strings"
-	"syscall"
-
-	"github.com/robfig/cron/v3"
-	"gopkg.in/yaml.v3"
+	"time"
 
 	"github.com/jtom38/dvb/domain"
 	"github.com/jtom38/dvb/services/alerts"
 	"github.com/jtom38/dvb/services/cli"
+	"github.com/jtom38/dvb/services/common"
 	"github.com/jtom38/dvb/services/dest"
 	"github.com/jtom38/dvb/services/discovery"
+	"github.com/jtom38/dvb/services/history"
+	"github.com/jtom38/dvb/services/logger"
+	"github.com/jtom38/dvb/services/metrics"
+	"github.com/jtom38/dvb/services/mqtt"
+	"github.com/jtom38/dvb/services/state"
 	"github.com/jtom38/dvb/services/targets"
 )
 
@@ -27,6 +28,13 @@ type StartBackupParams struct {
 type StartBackupClient struct {
 	Config domain.Config
 	Params StartBackupParams
+
+	state   *state.StateClient
+	tracker *RunTracker
+	history *history.Store
+	metrics *metrics.Registry
+	mqtt    *mqtt.Publisher
+	logger  *logger.Logger
 }
 
 func NewStartBackupClient(params StartBackupParams) StartBackupClient {
@@ -44,11 +52,39 @@ func (c StartBackupClient) RunProcess() error {
 	}
 	c.SetConfig(*config)
 
+	err = ValidateConfig(c.Config)
+	if err != nil {
+		return err
+	}
+
+	c.logger, err = ConfigureLogger(c.Config)
+	if err != nil {
+		return err
+	}
+	defer c.logger.Close()
+
+	// Make sure we are the only dvb process touching the containers
+	lock, err := AcquireLock(c.Config)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	dir, err := common.StateDirectory(c.Config.Daemon.StateDir)
+	if err != nil {
+		return err
+	}
+	c.state = state.NewStateClient(dir)
+	c.history = history.NewStore(dir, c.Config.History)
+	c.tracker = NewRunTracker()
+	c.metrics = c.newMetrics()
+	c.mqtt = c.newMqtt(c.Config.HasSchedules())
+	defer c.mqtt.Close()
+
 	// If daemon is requested from param or config check
-	if c.Config.Daemon.Cron != "" {
-		log.Print("Daemon mode was requested.")
-		log.Printf("Backups will start at '%v'", c.Config.Daemon.Cron)
-		c.RunDaemon()
+	if c.Config.HasSchedules() {
+		c.log().Info("Daemon mode was requested.")
+		return c.RunDaemon()
 	} else {
 		err = c.RunSingle()
 		if err != nil {
@@ -62,183 +98,390 @@ func (c StartBackupClient) RunProcess() error {
 // This runs the tool once and closes down once its finished.
 func (c StartBackupClient) RunSingle() error {
 	// Process all requested docker containers
-	for _, container := range c.Config.Backup.Docker {
-		err := c.ProcessDockerContainers(container)
-		if err != nil {
-			log.Print(err)
-		}
+	scheduler := c.newScheduler()
+	for _, job := range NewJobs(c.Config) {
+		scheduler.Trigger(job)
 	}
+	scheduler.Wait()
 
 	return nil
 }
 
-func (c StartBackupClient) RunDaemon() error {
-	// Set when we want to run the backup job
-	cronClient := cron.New()
-	_, err := cronClient.AddFunc(c.Config.Daemon.Cron, func() {
-		log.Print("Cron was triggered")
-		go c.RunSingle()
+func (c StartBackupClient) newScheduler() *RunScheduler {
+	return NewRunScheduler(RunSchedulerParams{
+		Overlap:     c.Config.Daemon.Overlap,
+		MaxParallel: c.Config.Daemon.MaxParallel,
+		Run:         c.RunJob,
+		Logger:      c.log(),
 	})
+}
+
+// Returns the logger from the config, or the default logger before the config was loaded.
+func (c StartBackupClient) log() *logger.Logger {
+	if c.logger == nil {
+		return logger.Default()
+	}
+	return c.logger
+}
+
+// Runs the backup for a single job and records the result in the state file.
+func (c StartBackupClient) RunJob(ctx context.Context, job domain.Job) {
+	started := time.Now()
+	runId := NewRunId()
+
+	// Everything logged during the run is kept so the alert can show it
+	logs := c.log().
+		With(logger.KeyJob, job.Name, logger.KeyContainer, job.Container.Name, logger.KeyRun, runId).
+		WithRecorder(logger.NewRecorder())
+
+	c.tracker.Start(job, runId, started)
+	c.metrics.RunStarted(job.Container.Name)
+	c.mqtt.RunStarted(job.Container.Name, runId)
+	c.recordState(func(s *state.StateClient) error {
+		return s.RecordAttempt(job.Name, started)
+	})
+
+	err := c.ProcessDockerContainers(ctx, logs, job.Container)
+	c.tracker.Update(job.Name, func(record *domain.RunRecord) {
+		record.Errors = runErrors(logs.Records())
+	})
+	record, ok := c.tracker.Finish(job.Name, err)
+	if ok {
+		c.saveHistory(record)
+		c.mqtt.RunFinished(record)
+	}
+
+	finished := time.Now()
+	c.metrics.RunFinished(job.Container.Name, finished, finished.Sub(started), err == nil)
+	c.writeMetrics()
+
+	c.recordState(func(s *state.StateClient) error {
+		return s.RecordResult(job.Name, started, err)
+	})
+}
+
+// Saves the finished run to the history file.
+func (c StartBackupClient) saveHistory(record domain.RunRecord) {
+	if c.history == nil {
+		return
+	}
+
+	err := c.history.Add(record)
 	if err != nil {
-		log.Print(err)
-	}
-
-	cronClient.Start()
-
-	// Check if we get a request to stop the app
-	ch := make(chan os.Signal, 6)
-	signal.Notify(ch,
-		syscall.SIGTERM,
-		syscall.SIGINT,
-		syscall.SIGQUIT,
-	)
-
-	for {
-		req := <-ch
-		switch req {
-		case syscall.SIGTERM:
-			fallthrough
-		case syscall.SIGINT:
-			cronClient.Stop()
-			signal.Stop(ch)
-			return nil
-		case syscall.SIGQUIT:
-			signal.Stop(ch)
-			os.Exit(0)
+		c.log().Error("Unable to update the history", logger.KeyError, err)
+	}
+}
+
+// Returns every error that was logged during the run.
+func runErrors(records []domain.LogRecord) []string {
+	var errs []string
+	for _, record := range records {
+		if record.Level != domain.LogLevelError {
+			continue
 		}
+
+		message := record.Message
+		if value := record.Field(logger.KeyError); value != "" {
+			message = fmt.Sprintf("%v: %v", message, value)
+		}
+		errs = append(errs, message)
 	}
+	return errs
+}
+
+func (c StartBackupClient) recordState(record func(s *state.StateClient) error) {
+	if c.state == nil {
+		return
+	}
+
+	err := record(c.state)
+	if err != nil {
+		c.log().Error("Unable to update the state file", logger.KeyError, err)
+	}
+}
+
+// Creates the metrics registry with the last success of every job from the state file.
+// The textfile is written again by every run, so its counters carry on from the state file too.
+func (c StartBackupClient) newMetrics() *metrics.Registry {
+	registry := metrics.NewRegistry()
+	if c.state == nil {
+		return registry
+	}
+
+	s, err := c.state.Load()
+	if err != nil {
+		c.log().Warn("Unable to read the state file for metrics", logger.KeyError, err)
+		return registry
+	}
+
+	for _, job := range NewJobs(c.Config) {
+		registry.SetLastSuccess(job.Container.Name, s.Jobs[job.Name].LastSuccess)
+	}
+	if c.Config.Metrics.TextfilePath != "" {
+		registry.SeedCounters(s.Counters)
+	}
+	return registry
+}
+
+// Connects to the mqtt broker when it is configured and seeds the last success of every job from the state file.
+// The daemon marks itself online and offline, a single run does not and connects in the background.
+func (c StartBackupClient) newMqtt(daemon bool) *mqtt.Publisher {
+	if c.Config.Mqtt.Broker == "" {
+		return nil
+	}
+
+	host, _ := os.Hostname()
+	publisher := mqtt.NewPublisher(mqtt.PublisherParams{
+		Config:       c.Config.Mqtt,
+		Host:         host,
+		Availability: daemon,
+		Background:   !daemon,
+		Logger:       c.log(),
+	})
+
+	jobs := NewJobs(c.Config)
+	if c.state != nil {
+		s, err := c.state.Load()
+		if err != nil {
+			c.log().Warn("Unable to read the state file for mqtt", logger.KeyError, err)
+		} else {
+			for _, job := range jobs {
+				publisher.SetLastSuccess(job.Container.Name, s.Jobs[job.Name].LastSuccess)
+			}
+		}
+	}
+
+	containers := make([]string, len(jobs))
+	for i, job := range jobs {
+		containers[i] = job.Container.Name
+	}
+	err := publisher.Connect(containers)
+	if err != nil {
+		c.log().Warn("Unable to connect to the mqtt broker", logger.KeyError, err)
+	}
+	return publisher
+}
+
+// Writes the metrics for the textfile collector when it is configured.
+func (c StartBackupClient) writeMetrics() {
+	path := c.Config.Metrics.TextfilePath
+	if path == "" || c.metrics == nil {
+		return
+	}
+
+	c.recordState(func(s *state.StateClient) error {
+		return s.RecordCounters(c.metrics.Counters())
+	})
+
+	err := c.metrics.WriteFile(path)
+	if err != nil {
+		c.log().Error("Unable to write the metrics file", logger.KeyError, err)
+	}
+}
+
+// Keeps the process alive and runs each job on its schedule.
+func (c StartBackupClient) RunDaemon() error {
+	d := newDaemon(c)
+	return d.Run()
 }
 
 func (c *StartBackupClient) SetConfig(config domain.Config) {
 	c.Config = config
 }
 
-func (c StartBackupClient) ProcessDockerContainers(container domain.ContainerDocker) error {
-	logs := domain.NewLogs()
-	logs.Add("The container backup has started.")
+// Backs up the container and moves it to the destinations.
+// Everything is written to logs, the alert that is sent at the end shows what was recorded.
+func (c StartBackupClient) ProcessDockerContainers(ctx context.Context, logs *logger.Logger, container domain.ContainerDocker) error {
+	logs.Info("The container backup has started.")
+
+	// Sends the alert with what is known about the run and every record from it
+	alert := func(result error) {
+		record, ok := c.tracker.Record(container.Name)
+		if !ok {
+			record.Container = container.Name
+		}
+		record.FinishedAt = time.Now()
+		record.Success = result == nil
+		if result != nil {
+			record.Error = result.Error()
+		}
 
-	details := &domain.RunDetails{
-		ContainerName: container.Name,
+		slow := time.Duration(c.Config.Alert.SlowRun)
+		if slow > 0 && !record.StartedAt.IsZero() && record.Duration() > slow {
+			logs.Warn(fmt.Sprintf("The backup took %v, longer than the %v Alert.SlowRun.", record.Duration().Round(time.Second), slow))
+		}
+
+		c.SendAlert(domain.RunResult{
+			RunRecord: record,
+			Records:   logs.Records(),
+		})
 	}
 
 	// Based on the destination path, lets figure out what we should name the file
+	c.tracker.Phase(container.Name, PhaseRecon)
 	recon := discovery.NewReconClient(c.Config)
 	details, err := recon.DockerScout(container)
 	if err != nil {
-		logs.Error(err)
+		logs.Error("Unable to plan the backup", logger.KeyError, err)
 		return err
 	}
+	c.tracker.Update(container.Name, func(record *domain.RunRecord) {
+		record.Host = details.Hostname
+		record.FileName = details.Backup.FileName
+	})
 
 	// Start the backup process on the container
 	backupDockerClient := targets.NewDockerClient()
-	err = backupDockerClient.BackupDockerVolume(*details, container)
+	backupDockerClient.SetRetry(c.Config.Retry)
+	backupDockerClient.SetLogger(logs)
+
+	var stoppedAt time.Time
+	backupDockerClient.SetPhaseFunc(func(phase string) {
+		if phase == targets.PhaseQuiesce && stoppedAt.IsZero() {
+			stoppedAt = time.Now()
+		}
+		c.tracker.Phase(container.Name, phase)
+	})
+	attempts, err := backupDockerClient.BackupDockerVolume(ctx, *details, container)
+	c.tracker.Update(container.Name, func(record *domain.RunRecord) {
+		record.Attempts = attempts
+	})
+	if !stoppedAt.IsZero() {
+		c.metrics.SetDowntime(container.Name, time.Since(stoppedAt))
+	}
 	if err != nil {
-		logs.Error(err)
-		c.SendAlert(SendAlertParam{
-			Config:        c.Config.Alert,
-			Logs:          *logs,
-			IsError:       true,
-			ContainerName: container.Name,
-		})
+		logs.Error("The backup failed", logger.KeyError, err, "attempts", attempts)
+		alert(err)
 		return err
 	}
-	logs.Add(fmt.Sprintf("Backup was created. '%v.tar'", details.Backup.FileName))
+	logs.Info(fmt.Sprintf("Backup was created. '%v.tar'", details.Backup.FileName))
 
 	// run any post reboot requests after a backup was made
-	c.postRebootContainer(container.Post.Reboot)
+	c.tracker.Phase(container.Name, PhasePostReboot)
+	c.postRebootContainer(logs, container.Post.Reboot)
+
+	// Stop here if dvb is shutting down, the backup stays where it was made
+	if ctx.Err() != nil {
+		logs.Error("The backup was cancelled", logger.KeyError, ctx.Err())
+		logs.Info(fmt.Sprintf("The backup was left at '%v'.", details.Backup.FullFilePath))
+		alert(ctx.Err())
+		return ctx.Err()
+	}
 
-	err = c.MoveFile(*details, c.Config.Destination)
-	if err != nil {
-		logs.Error(err)
-		c.SendAlert(SendAlertParam{
-			Config:        c.Config.Alert,
-			Logs:          *logs,
-			IsError:       true,
-			ContainerName: container.Name,
+	// Make sure the backup fits before it is moved.
+	// The destinations stay locked until it is there, so another job can not take the room.
+	c.tracker.Phase(container.Name, PhaseMakeRoom)
+	unlock := destinationLocks.Lock(c.Config.Destination)
+	info, err := os.Stat(details.Backup.FullFilePath)
+	if err == nil {
+		c.metrics.SetArchiveSize(container.Name, info.Size())
+		c.tracker.Update(container.Name, func(record *domain.RunRecord) {
+			record.ArchiveSize = info.Size()
 		})
+		summaries, err := makeRoom(c.Config, container, details.Hostname, info.Size(), logs)
+		c.recordDeleted(container.Name, summaries)
+		if err != nil {
+			unlock()
+			logs.Error("There is not enough room for the backup", logger.KeyError, err)
+			logs.Info(fmt.Sprintf("The backup was left at '%v'.", details.Backup.FullFilePath))
+			alert(err)
+			return err
+		}
+		for _, summary := range summaries {
+			c.metrics.AddRetentionDeletions(container.Name, summary.Destination, len(summary.Result.Removed))
+			if len(summary.Result.Removed) >= 1 {
+				logs.Info(fmt.Sprintf("Removed %v old backup(s) from %v to make room, freeing %v.", len(summary.Result.Removed), summary.Destination, common.FormatBytes(summary.Result.FreedBytes)))
+			}
+		}
+	} else {
+		logs.Warn("Unable to read the size of the archive, the quota was not checked", logger.KeyError, err)
+	}
+
+	c.tracker.Phase(container.Name, PhaseTransfer)
+	attempts.Transfer, err = common.Retry(ctx, common.RetryParams{
+		Name:   PhaseTransfer,
+		Policy: c.Config.Retry.Transfer,
+		Logger: logs,
+	}, func() error {
+		return c.MoveFile(*details, c.Config.Destination)
+	})
+	unlock()
+	c.tracker.Update(container.Name, func(record *domain.RunRecord) {
+		record.Attempts = attempts
+	})
+	if err != nil {
+		logs.Error("The backup could not be moved", logger.KeyError, err, "attempts", attempts)
+		alert(err)
 		return err
 	}
-	logs.Add("Backup was moved.")
+	logs.Info("Backup was moved.", "attempts", attempts)
+	c.recordMove(container.Name, *details)
+	if info != nil && details.Dest.Local.Directory != "" {
+		c.metrics.AddUploaded(dest.LocalStoreName, info.Size())
+	}
 
 	// Check if we need to remove any old backups
-	if c.Config.Destination.Retain.Days == 0 {
-		c.SendAlert(SendAlertParam{
-			Config:        c.Config.Alert,
-			Logs:          *logs,
-			IsError:       false,
-			ContainerName: container.Name,
-		})
-		return nil
-	}
-	if c.Config.Destination.Local.Path == "" {
-		c.SendAlert(SendAlertParam{
-			Config:        c.Config.Alert,
-			Logs:          *logs,
-			IsError:       false,
-			ContainerName: container.Name,
-		})
+	if !container.RetainPolicy(c.Config.Destination.Retain).IsEnabled() {
+		alert(nil)
 		return nil
 	}
 
-	log.Print("Checking for expired files to remove")
-	retain := dest.NewLocalRetainClient(c.Config.Destination.Local, details.ContainerName, c.Config.Destination.Retain.Days)
-	for {
-
-		totalFiles, err := retain.CountFiles(".tar", retain.GetDirectoryPath())
-		if err != nil {
-			logs.Error(err)
-			c.SendAlert(SendAlertParam{
-				Config:        c.Config.Alert,
-				Logs:          *logs,
-				IsError:       true,
-				ContainerName: container.Name,
-			})
-			return err
+	logs.Debug("Checking for expired files to remove")
+	c.tracker.Phase(container.Name, PhaseRetention)
+	unlock = destinationLocks.Lock(c.Config.Destination)
+	summaries, err := applyRetention(c.Config, container, details.Hostname, false, logs)
+	unlock()
+	c.recordDeleted(container.Name, summaries)
+	if err != nil {
+		logs.Error("Retention failed", logger.KeyError, err)
+		alert(err)
+		return err
+	}
+	for _, summary := range summaries {
+		c.metrics.AddRetentionDeletions(container.Name, summary.Destination, len(summary.Result.Removed))
+		// Foreign files are normal on a shared destination, a warning would turn every run into a warning alert
+		if len(summary.Result.Foreign) >= 1 {
+			logs.Info(fmt.Sprintf("Retention ignored %v file(s) in %v that dvb did not create.", len(summary.Result.Foreign), summary.Destination))
 		}
-
-		if totalFiles <= c.Config.Destination.Retain.Days {
-			break
+		if len(summary.Result.Removed) >= 1 {
+			logs.Info(fmt.Sprintf("Retention removed %v old backup(s) from %v.", len(summary.Result.Removed), summary.Destination))
 		}
+	}
 
-		err = retain.Check(".tar")
-		if err != nil {
-			logs.Error(err)
-			c.SendAlert(SendAlertParam{
-				Config:        c.Config.Alert,
-				Logs:          *logs,
-				IsError:       true,
-				ContainerName: container.Name,
-			})
-			return err
-		}
+	logs.Info(fmt.Sprintf("No errors reported backing up '%v' 🎉", container.Name))
+	alert(nil)
+	return nil
+}
 
+// Adds where the backup was written and its checksum to the run record.
+func (c StartBackupClient) recordMove(name string, details domain.RunDetails) {
+	if details.Dest.Local.Directory == "" {
+		return
 	}
 
-	logs.Add(fmt.Sprintf("No errors reported backing up '%v' 🎉", container.Name))
+	manifest, err := dest.ReadManifest(details.Dest.Local.FullFilePath)
+	c.tracker.Update(name, func(record *domain.RunRecord) {
+		record.Destinations = append(record.Destinations, dest.LocalStoreName)
+		if err == nil {
+			record.Checksum = manifest.Checksum
+			record.ArchiveSize = manifest.Size
+		}
+	})
+}
 
-	c.SendAlert(SendAlertParam{
-		Config:        c.Config.Alert,
-		Logs:          *logs,
-		IsError:       false,
-		ContainerName: container.Name,
+// Adds the backups that were removed from each destination to the run record.
+func (c StartBackupClient) recordDeleted(name string, summaries []retainSummary) {
+	c.tracker.Update(name, func(record *domain.RunRecord) {
+		for _, summary := range summaries {
+			for _, file := range summary.Result.Removed {
+				record.Deleted = append(record.Deleted, fmt.Sprintf("%v:%v", summary.Destination, file.Name))
+			}
+		}
 	})
-	return nil
 }
 
 func (c StartBackupClient) LoadConfig(path string) (*domain.Config, error) {
-	var config domain.Config
-
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return &config, err
-	}
-
-	err = yaml.Unmarshal(content, &config)
-	if err != nil {
-		return &config, err
-	}
-
-	return &config, nil
+	return LoadConfig(path)
 }
 
 func (c StartBackupClient) MoveFile(details domain.RunDetails, config domain.ConfigDest) error {
@@ -260,109 +503,60 @@ func (c StartBackupClient) MoveFile(details domain.RunDetails, config domain.Con
 	return nil
 }
 
-type SendAlertParam struct {
-	Config        domain.ConfigAlert
-	Logs          domain.Logs
-	IsError       bool
-	ContainerName string
-}
-
-func (c StartBackupClient) SendAlert(params SendAlertParam) {
-	var err error
-
-	if len(params.Config.Discord.Webhooks) >= 1 {
-		log.Print("Sending discord alert")
-		err = c.sendDiscordAlert(params)
-		if err != nil {
-			log.Print(err)
-		}
-	}
+const (
+	PhaseRecon      = "recon"
+	PhasePostReboot = "post reboot"
+	PhaseMakeRoom   = "make room"
+	PhaseTransfer   = "transfer"
+	PhaseRetention  = "retention"
+	PhaseAlert      = "alert"
+)
 
-	if params.Config.Email.Account.Username != "" && params.Config.Email.Account.Password != "" {
-		log.Print("Sending email alert")
-		err = c.sendEmailAlert(params.Config.Email, params.Logs)
-		if err != nil {
-			log.Print(err)
-		}
+// Sends the result to every alert channel that is configured.
+func (c StartBackupClient) SendAlert(result domain.RunResult) {
+	notifiers := alerts.Route(c.Config.Alert, alerts.Notifiers(c.Config.Alert), result)
+	if len(notifiers) == 0 {
+		c.log().Debug("No alert channel wants the result", logger.KeyContainer, result.Container, "level", result.Level().String())
+		return
 	}
-}
-
-func (c StartBackupClient) sendDiscordAlert(params SendAlertParam) error {
-	var color int
 
-	discordAlert := alerts.NewDiscordEmbedMessage(params.Config.Discord)
-	hostname, err := os.Hostname()
-	if err != nil {
-		return err
-	}
+	outcomes := alerts.Dispatch(context.Background(), alerts.DispatchParams{
+		Notifiers: notifiers,
+		Timeout:   time.Duration(c.Config.Alert.Timeout),
+		Retry:     c.Config.Retry.Alert,
+		Logger:    c.log(),
+	}, result)
 
-	if params.IsError {
-		color = alerts.DiscordErrorColor
-	} else {
-		color = alerts.DiscordSuccessColor
+	for _, outcome := range outcomes {
+		if outcome.Error != "" {
+			c.metrics.AlertFailed(outcome.Channel)
+		}
 	}
 
-	discordAlert.AppendFields(alerts.DiscordEmbedFieldParams{
-		Name:   "Server",
-		Value:  hostname,
-		Inline: true,
+	c.tracker.Update(result.Job, func(record *domain.RunRecord) {
+		record.Alerts = append(record.Alerts, outcomes...)
 	})
-
-	discordAlert.AppendFields(alerts.DiscordEmbedFieldParams{
-		Name:   "Container",
-		Value:  params.ContainerName,
-		Inline: true,
-	})
-
-	m := strings.Join(params.Logs.Message, "\n")
-	discordAlert.SetBody(alerts.DiscordEmbedBodyParams{
-		Title:       "Backup Results",
-		Color:       color,
-		Description: m,
-	})
-
-	err = discordAlert.SendPayload()
-	if err != nil {
-		return err
-	}
-
-	log.Print("> OK")
-	return nil
-}
-
-func (c StartBackupClient) sendEmailAlert(config domain.ConfigAlertEmail, logs domain.Logs) error {
-	m := strings.Join(logs.Message, "<br>")
-
-	client := alerts.NewSmtpClient(config)
-	client.SetSubject(alerts.EmailSubjectSuccess)
-	client.SetBody(m)
-	err := client.SendAlert()
-	if err != nil {
-		return err
-	}
-	log.Print("> OK")
-	return nil
 }
 
-func (c StartBackupClient) postRebootContainer(names []string) {
+func (c StartBackupClient) postRebootContainer(logs *logger.Logger, names []string) {
 	if len(names) == 0 {
 		return
 	}
 
 	client := cli.NewDockerCliClient()
-	log.Print("Running Post Reboot requests")
+	logs.Info("Running Post Reboot requests")
 
 	for _, name := range names {
-		log.Printf("Stopping '%v'", name)
+		logs.Debug("Stopping a dependant container", "target", name)
 		output, err := client.StopContainer(name)
 		if err != nil {
-			log.Print(output)
+			logs.Warn("Unable to stop a dependant container", "target", name, logger.KeyError, output)
 		}
 
-		log.Printf("Starting '%v'", name)
+		logs.Debug("Starting a dependant container", "target", name)
 		output, err = client.StartContainer(name)
 		if err != nil {
-			log.Print(output)
+			logs.Warn("Unable to start a dependant container", "target", name, logger.KeyError, output)
 		}
 	}
 }
@@ -0,0 +1,64 @@
+package proc
+
+import (
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/state"
+)
+
+type StatusParams struct {
+	ConfigPath string
+}
+
+type StatusClient struct {
+	Config domain.Config
+	Params StatusParams
+}
+
+// The status client reports the state of every job without needing the daemon.
+func NewStatusClient(params StatusParams) StatusClient {
+	return StatusClient{
+		Params: params,
+	}
+}
+
+// Loads the config from the ConfigPath.
+func (c *StatusClient) LoadConfig() error {
+	config, err := LoadConfig(c.Params.ConfigPath)
+	if err != nil {
+		return err
+	}
+	c.Config = *config
+	return nil
+}
+
+func (c StatusClient) Status() ([]domain.JobStatus, error) {
+	var jobs []domain.JobStatus
+
+	dir, err := common.StateDirectory(c.Config.Daemon.StateDir)
+	if err != nil {
+		return jobs, err
+	}
+
+	s, err := state.NewStateClient(dir).Load()
+	if err != nil {
+		return jobs, err
+	}
+
+	return jobStatuses(c.Config, s, time.Now()), nil
+}
+
+func jobStatuses(config domain.Config, state domain.RunState, now time.Time) []domain.JobStatus {
+	var jobs []domain.JobStatus
+	for _, job := range NewJobs(config) {
+		jobs = append(jobs, domain.JobStatus{
+			Name:     job.Name,
+			Schedule: job.Schedule,
+			NextRun:  NextRun(job, now),
+			State:    state.Jobs[job.Name],
+		})
+	}
+	return jobs
+}
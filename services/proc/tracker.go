@@ -0,0 +1,195 @@
+package proc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	// How many finished runs are kept in memory.
+	trackerHistorySize = 200
+
+	// The phase of a job before it has done anything.
+	phaseStarting = "starting"
+)
+
+// The run tracker knows which backups are running, what step they are on and how the last runs ended.
+type RunTracker struct {
+	mu      sync.Mutex
+	runs    map[string]*trackedRun
+	history []domain.RunRecord
+}
+
+// A running job and the record that is filled in as it goes.
+type trackedRun struct {
+	progress domain.RunProgress
+	record   domain.RunRecord
+}
+
+func NewRunTracker() *RunTracker {
+	return &RunTracker{
+		runs: make(map[string]*trackedRun),
+	}
+}
+
+// Records that the job has started.
+func (t *RunTracker) Start(job domain.Job, id string, at time.Time) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.runs[job.Name] = &trackedRun{
+		progress: domain.RunProgress{
+			Id:             id,
+			Job:            job.Name,
+			Container:      job.Container.Name,
+			StartedAt:      at,
+			Phase:          phaseStarting,
+			PhaseStartedAt: at,
+		},
+		record: domain.RunRecord{
+			Id:        id,
+			Job:       job.Name,
+			Container: job.Container.Name,
+			StartedAt: at,
+		},
+	}
+}
+
+// Records the step the job has moved on to.
+func (t *RunTracker) Phase(name string, phase string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run, ok := t.runs[name]
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	run.endPhase(now)
+	run.progress.Phase = phase
+	run.progress.PhaseStartedAt = now
+}
+
+// Changes the record of a running job, like adding the archive size once it is known.
+func (t *RunTracker) Update(name string, change func(record *domain.RunRecord)) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run, ok := t.runs[name]
+	if !ok {
+		return
+	}
+	change(&run.record)
+}
+
+// Returns what has been recorded so far about a running job.
+func (t *RunTracker) Record(name string) (domain.RunRecord, bool) {
+	if t == nil {
+		return domain.RunRecord{}, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run, ok := t.runs[name]
+	if !ok {
+		return domain.RunRecord{}, false
+	}
+	return run.record, true
+}
+
+// Records how the job ended and moves it to the history.
+// Returns the finished record, false when the job was not running.
+func (t *RunTracker) Finish(name string, result error) (domain.RunRecord, bool) {
+	if t == nil {
+		return domain.RunRecord{}, false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	run, ok := t.runs[name]
+	if !ok {
+		return domain.RunRecord{}, false
+	}
+	delete(t.runs, name)
+
+	now := time.Now()
+	run.endPhase(now)
+
+	record := run.record
+	record.FinishedAt = now
+	record.Success = result == nil
+	if result != nil {
+		record.Error = result.Error()
+	}
+
+	t.history = append(t.history, record)
+	if len(t.history) > trackerHistorySize {
+		t.history = t.history[len(t.history)-trackerHistorySize:]
+	}
+	return record, true
+}
+
+// Adds how long the current phase took to the record.
+func (r *trackedRun) endPhase(now time.Time) {
+	if r.progress.Phase == phaseStarting {
+		return
+	}
+
+	r.record.Phases = append(r.record.Phases, domain.PhaseTiming{
+		Name:      r.progress.Phase,
+		StartedAt: r.progress.PhaseStartedAt,
+		Duration:  now.Sub(r.progress.PhaseStartedAt),
+	})
+}
+
+// Returns the running jobs sorted by name.
+func (t *RunTracker) Runs() []domain.RunProgress {
+	runs := []domain.RunProgress{}
+	if t == nil {
+		return runs
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, run := range t.runs {
+		runs = append(runs, run.progress)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Job < runs[j].Job
+	})
+	return runs
+}
+
+// Returns the finished runs newest first, limit <= 0 returns everything that is kept.
+func (t *RunTracker) History(container string, limit int) []domain.RunRecord {
+	records := []domain.RunRecord{}
+	if t == nil {
+		return records
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.history) - 1; i >= 0; i-- {
+		if container != "" && t.history[i].Container != container {
+			continue
+		}
+		records = append(records, t.history[i])
+		if limit > 0 && len(records) >= limit {
+			break
+		}
+	}
+	return records
+}
@@ -0,0 +1,59 @@
+package proc_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/proc"
+)
+
+func TestRunTracker(t *testing.T) {
+	tracker := proc.NewRunTracker()
+	webdav := domain.Job{Name: "webdav", Container: domain.ContainerDocker{Name: "webdav"}}
+	db := domain.Job{Name: "app-db", Container: domain.ContainerDocker{Name: "app-db"}}
+
+	tracker.Start(webdav, "a1", time.Now())
+	tracker.Start(db, "b2", time.Now())
+	tracker.Phase("webdav", "archive")
+
+	runs := tracker.Runs()
+	if len(runs) != 2 || runs[0].Job != "app-db" || runs[1].Phase != "archive" {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+
+	tracker.Update("webdav", func(record *domain.RunRecord) {
+		record.Checksum = "abc"
+	})
+	tracker.Phase("webdav", "transfer")
+
+	record, ok := tracker.Finish("webdav", nil)
+	if !ok || record.Checksum != "abc" || !record.Success {
+		t.Fatalf("unexpected record %+v", record)
+	}
+	if len(record.Phases) != 2 || record.Phases[0].Name != "archive" || record.Phases[1].Name != "transfer" {
+		t.Errorf("expected the archive and transfer phases but got %+v", record.Phases)
+	}
+
+	tracker.Finish("app-db", errors.New("docker is down"))
+
+	_, ok = tracker.Finish("app-db", nil)
+	if ok {
+		t.Error("expected a job that is not running to be ignored")
+	}
+
+	if len(tracker.Runs()) != 0 {
+		t.Error("expected no running jobs")
+	}
+
+	history := tracker.History("", 0)
+	if len(history) != 2 || history[0].Job != "app-db" || history[0].Success {
+		t.Fatalf("expected the failed app-db run first but got %+v", history)
+	}
+
+	history = tracker.History("webdav", 1)
+	if len(history) != 1 || !history[0].Success || history[0].Id != "a1" {
+		t.Errorf("expected the webdav run but got %+v", history)
+	}
+}
@@ -1,5 +1,357 @@
 package proc
 
-func ValidateAlertConfig() {
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
 
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/alerts"
+	"github.com/jtom38/dvb/services/logger"
+)
+
+const (
+	ErrConfigNoContainers  = "no containers are defined in Backup.Docker"
+	ErrConfigOverlap       = "Daemon.Overlap must be skip or queue"
+	ErrConfigApiToken      = "Daemon.Api.Token is required when the api is enabled"
+	ErrConfigApiTls        = "Daemon.Api.TlsCert and Daemon.Api.TlsKey must be set together"
+	ErrConfigEmailSecurity = "Alert.Email.Account.Security must be none, starttls or tls"
+	ErrConfigEmailUseTls   = "Alert.Email.Account.UseTls is no longer used, set Security to none, starttls or tls instead"
+	ErrConfigMqttBroker    = "Mqtt.Broker must be a url like tcp://broker:1883, ssl, ws and wss are also supported"
+)
+
+// Checks the config for anything that would stop a backup from working.
+func ValidateConfig(config domain.Config) error {
+	if len(config.Backup.Docker) == 0 {
+		return errors.New(ErrConfigNoContainers)
+	}
+
+	switch config.Daemon.Overlap {
+	case "", domain.DaemonOverlapSkip, domain.DaemonOverlapQueue:
+	default:
+		return errors.New(ErrConfigOverlap)
+	}
+
+	if config.Daemon.Cron != "" {
+		_, err := ParseSchedule(config.Daemon.Cron)
+		if err != nil {
+			return fmt.Errorf("Daemon.Cron: %v", err)
+		}
+	}
+
+	err := validateApi(config.Daemon.Api)
+	if err != nil {
+		return err
+	}
+
+	err = validateLog(config.Log)
+	if err != nil {
+		return err
+	}
+
+	err = validateMqtt(config.Mqtt)
+	if err != nil {
+		return err
+	}
+
+	names := make(map[string]bool)
+	for i, container := range config.Backup.Docker {
+		if container.Name == "" {
+			return fmt.Errorf("Backup.Docker[%v] is missing a Name", i)
+		}
+
+		if names[container.Name] {
+			return fmt.Errorf("'%v' is defined more than once", container.Name)
+		}
+		names[container.Name] = true
+
+		if container.Directory == "" {
+			return fmt.Errorf("'%v' is missing a Directory", container.Name)
+		}
+
+		if container.Tar.Pattern == "" {
+			return fmt.Errorf("'%v' is missing a Tar.Pattern", container.Name)
+		}
+
+		for _, spec := range container.Schedule {
+			_, err := ParseSchedule(spec)
+			if err != nil {
+				return fmt.Errorf("'%v': %v", container.Name, err)
+			}
+		}
+
+		err := validateRetain(container.RetainPolicy(config.Destination.Retain))
+		if err != nil {
+			return fmt.Errorf("'%v': %v", container.Name, err)
+		}
+	}
+
+	err = ValidateAlertConfig(config.Alert)
+	if err != nil {
+		return err
+	}
+
+	// A typo in a route would quietly drop the alerts of that container
+	for name, route := range alertRoutes(config.Alert) {
+		for _, container := range route.Containers {
+			if !names[container] {
+				return fmt.Errorf("%v.Containers has '%v' which is not in Backup.Docker", name, container)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateApi(config domain.ConfigDaemonApi) error {
+	if config.Listen == "" {
+		return nil
+	}
+
+	_, _, err := net.SplitHostPort(config.Listen)
+	if err != nil {
+		return fmt.Errorf("Daemon.Api.Listen: %v", err)
+	}
+
+	// Even on localhost any web page the operator opens could reach the api
+	if config.Token == "" {
+		return errors.New(ErrConfigApiToken)
+	}
+
+	if (config.TlsCert == "") != (config.TlsKey == "") {
+		return errors.New(ErrConfigApiTls)
+	}
+
+	return nil
+}
+
+func validateLog(config domain.ConfigLog) error {
+	_, err := domain.ParseLogLevel(config.Level)
+	if err != nil {
+		return fmt.Errorf("Log.Level: %v", err)
+	}
+
+	_, err = logger.ParseFormat(config.Format)
+	return err
+}
+
+func validateMqtt(config domain.ConfigMqtt) error {
+	if config.Broker == "" {
+		return nil
+	}
+
+	parsed, err := url.Parse(config.Broker)
+	if err != nil || parsed.Host == "" {
+		return errors.New(ErrConfigMqttBroker)
+	}
+
+	switch parsed.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return errors.New(ErrConfigMqttBroker)
+	}
+
+	return nil
+}
+
+func validateRetain(config domain.ConfigRetain) error {
+	values := []int{config.Days, config.KeepLast, config.KeepDaily, config.KeepWeekly, config.KeepMonthly, config.KeepYearly, config.MinKeep}
+	for _, value := range values {
+		if value < 0 {
+			return errors.New("retain values can not be negative")
+		}
+	}
+	return nil
+}
+
+// Checks that the alerts that are defined have what they need to send.
+func ValidateAlertConfig(config domain.ConfigAlert) error {
+	for name, route := range alertRoutes(config) {
+		_, err := domain.ParseAlertLevel(route.MinLevel)
+		if err != nil {
+			return fmt.Errorf("%v.MinLevel: %v", name, err)
+		}
+	}
+
+	if config.Discord.BaseUrl != "" {
+		err := validateAlertUrl("Alert.Discord.BaseUrl", config.Discord.BaseUrl)
+		if err != nil {
+			return err
+		}
+	}
+	for _, uri := range config.Discord.Webhooks {
+		err := alerts.ValidateDiscordWebhook(config.Discord.BaseUrl, uri)
+		if err != nil {
+			return fmt.Errorf("Alert.Discord has an invalid webhook '%v'", uri)
+		}
+	}
+
+	err := validateEmail(config.Email)
+	if err != nil {
+		return err
+	}
+
+	for _, uri := range config.Slack.Webhooks {
+		err := validateAlertUrl("Alert.Slack", uri)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Ntfy.Url != "" || config.Ntfy.Topic != "" {
+		err := validateAlertUrl("Alert.Ntfy.Url", config.Ntfy.Url)
+		if err != nil {
+			return err
+		}
+		if config.Ntfy.Topic == "" {
+			return errors.New("Alert.Ntfy is missing a Topic")
+		}
+		err = validatePriority("Alert.Ntfy", 1, 5, config.Ntfy.SuccessPriority, config.Ntfy.ErrorPriority)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Gotify.Url != "" || config.Gotify.Token != "" {
+		err := validateAlertUrl("Alert.Gotify.Url", config.Gotify.Url)
+		if err != nil {
+			return err
+		}
+		if config.Gotify.Token == "" {
+			return errors.New("Alert.Gotify is missing a Token")
+		}
+		for _, priority := range []*int{config.Gotify.SuccessPriority, config.Gotify.ErrorPriority} {
+			if priority == nil {
+				continue
+			}
+			err = validatePriority("Alert.Gotify", 0, 10, *priority)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, uri := range config.Teams.Webhooks {
+		err := validateAlertUrl("Alert.Teams", uri)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Webhook.Url != "" {
+		err := validateAlertUrl("Alert.Webhook.Url", config.Webhook.Url)
+		if err != nil {
+			return err
+		}
+
+		_, err = alerts.ParseWebhookTemplate(config.Webhook.Body)
+		if err != nil {
+			return fmt.Errorf("Alert.Webhook.Body is not a valid template: %v", err)
+		}
+	}
+
+	if config.Telegram.Token != "" && len(config.Telegram.ChatIds) == 0 {
+		return errors.New("Alert.Telegram is missing ChatIds")
+	}
+	if config.Telegram.ApiUrl != "" {
+		err := validateAlertUrl("Alert.Telegram.ApiUrl", config.Telegram.ApiUrl)
+		if err != nil {
+			return err
+		}
+	}
+
+	if config.Matrix.Homeserver != "" {
+		err := validateAlertUrl("Alert.Matrix.Homeserver", config.Matrix.Homeserver)
+		if err != nil {
+			return err
+		}
+		if config.Matrix.AccessToken == "" || config.Matrix.RoomId == "" {
+			return errors.New("Alert.Matrix needs an AccessToken and a RoomId")
+		}
+	}
+
+	return nil
+}
+
+func validateEmail(config domain.ConfigAlertEmail) error {
+	if config.Account.Username != "" && config.Account.Host == "" {
+		return errors.New("Alert.Email.Account is missing a Host")
+	}
+	if config.Account.Host == "" {
+		return nil
+	}
+
+	if len(config.To)+len(config.Cc)+len(config.Bcc) == 0 {
+		return errors.New("Alert.Email needs at least one To, Cc or Bcc address")
+	}
+	if config.From == "" {
+		return errors.New("Alert.Email is missing a From address")
+	}
+
+	// UseTls used to turn off the certificate check, it is not quietly ignored
+	if config.Account.UseTls && config.Account.Security == "" {
+		return errors.New(ErrConfigEmailUseTls)
+	}
+
+	switch alerts.EmailSecurity(config.Account) {
+	case domain.EmailSecurityNone, domain.EmailSecurityStartTls, domain.EmailSecurityTls:
+	default:
+		return errors.New(ErrConfigEmailSecurity)
+	}
+
+	if alerts.EmailSecurity(config.Account) == domain.EmailSecurityNone && config.Account.Username != "" && !alerts.EmailPlaintextAuthAllowed(config.Account) {
+		return fmt.Errorf("Alert.Email.Account: %v", alerts.ErrSmtpPlaintextAuth)
+	}
+
+	_, err := alerts.EmailTlsConfig(config.Account)
+	if err != nil {
+		return fmt.Errorf("Alert.Email.Account.CaFile: %v", err)
+	}
+
+	for name, subject := range map[string]string{"SubjectSuccess": config.SubjectSuccess, "SubjectError": config.SubjectError} {
+		_, err := alerts.ParseEmailSubject(subject)
+		if err != nil {
+			return fmt.Errorf("Alert.Email.%v is not a valid template: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Returns the route of every channel by its name in the config.
+func alertRoutes(config domain.ConfigAlert) map[string]domain.ConfigAlertRoute {
+	return map[string]domain.ConfigAlertRoute{
+		"Alert.Discord":  config.Discord.ConfigAlertRoute,
+		"Alert.Email":    config.Email.ConfigAlertRoute,
+		"Alert.Slack":    config.Slack.ConfigAlertRoute,
+		"Alert.Ntfy":     config.Ntfy.ConfigAlertRoute,
+		"Alert.Gotify":   config.Gotify.ConfigAlertRoute,
+		"Alert.Teams":    config.Teams.ConfigAlertRoute,
+		"Alert.Webhook":  config.Webhook.ConfigAlertRoute,
+		"Alert.Telegram": config.Telegram.ConfigAlertRoute,
+		"Alert.Matrix":   config.Matrix.ConfigAlertRoute,
+	}
+}
+
+// A zero value means the priority is not set and is always allowed.
+func validatePriority(name string, min int, max int, values ...int) error {
+	for _, value := range values {
+		if value == 0 {
+			continue
+		}
+		if value < min || value > max {
+			return fmt.Errorf("%v priorities must be between %v and %v", name, min, max)
+		}
+	}
+	return nil
+}
+
+// Checks that the alert url is a full http or https url.
+func validateAlertUrl(name string, value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%v has an invalid url '%v'", name, value)
+	}
+	return nil
 }
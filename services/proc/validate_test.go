@@ -0,0 +1,128 @@
+package proc_test
+
+import (
+	"testing"
+
+	"github.com/jtom38/dvb/domain"
+	"github.com/jtom38/dvb/services/proc"
+)
+
+func getValidConfig() domain.Config {
+	return domain.Config{
+		Daemon: domain.ConfigDaemon{Cron: "0 0 * * *"},
+		Backup: domain.BackupConfig{
+			Docker: []domain.ContainerDocker{
+				{
+					Name:      "webdav",
+					Directory: "/var/lib/dav",
+					Tar:       domain.ConfigContainerTar{Pattern: "data-{{DATE}}"},
+					Schedule:  domain.StringList{"@every 6h"},
+				},
+			},
+		},
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	err := proc.ValidateConfig(getValidConfig())
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfigApiLocalhost(t *testing.T) {
+	config := getValidConfig()
+	config.Daemon.Api.Listen = "127.0.0.1:8080"
+
+	err := proc.ValidateConfig(config)
+	if err == nil || err.Error() != proc.ErrConfigApiToken {
+		t.Errorf("expected the token to be required on localhost too but got %v", err)
+	}
+
+	config.Daemon.Api.Token = "secret"
+	err = proc.ValidateConfig(config)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestValidateConfigErrors(t *testing.T) {
+	cases := map[string]func(c *domain.Config){
+		"no containers":      func(c *domain.Config) { c.Backup.Docker = nil },
+		"bad global cron":    func(c *domain.Config) { c.Daemon.Cron = "every day" },
+		"bad schedule":       func(c *domain.Config) { c.Backup.Docker[0].Schedule = domain.StringList{"61 * * * *"} },
+		"bad overlap":        func(c *domain.Config) { c.Daemon.Overlap = "wait" },
+		"missing pattern":    func(c *domain.Config) { c.Backup.Docker[0].Tar.Pattern = "" },
+		"duplicate name":     func(c *domain.Config) { c.Backup.Docker = append(c.Backup.Docker, c.Backup.Docker[0]) },
+		"negative retain":    func(c *domain.Config) { c.Destination.Retain.KeepDaily = -1 },
+		"bad webhook":        func(c *domain.Config) { c.Alert.Discord.Webhooks = []string{"http://example.com"} },
+		"email missing host": func(c *domain.Config) { c.Alert.Email.Account.Username = "dvb" },
+		"email no recipients": func(c *domain.Config) {
+			c.Alert.Email = domain.ConfigAlertEmail{Account: domain.ConfigAlertEmailAccount{Host: "smtp.example.com"}, From: "dvb@example.com"}
+		},
+		"email bad security": func(c *domain.Config) {
+			c.Alert.Email = domain.ConfigAlertEmail{
+				Account: domain.ConfigAlertEmailAccount{Host: "smtp.example.com", Security: "ssl"},
+				From:    "dvb@example.com",
+				To:      domain.StringList{"admin@example.com"},
+			}
+		},
+		"email use tls": func(c *domain.Config) {
+			c.Alert.Email = domain.ConfigAlertEmail{
+				Account: domain.ConfigAlertEmailAccount{Host: "smtp.example.com", UseTls: true},
+				From:    "dvb@example.com",
+				To:      domain.StringList{"admin@example.com"},
+			}
+		},
+		"email plaintext password": func(c *domain.Config) {
+			c.Alert.Email = domain.ConfigAlertEmail{
+				Account: domain.ConfigAlertEmailAccount{Host: "smtp.example.com", Security: "none", Username: "dvb"},
+				From:    "dvb@example.com",
+				To:      domain.StringList{"admin@example.com"},
+			}
+		},
+		"email missing ca file": func(c *domain.Config) {
+			c.Alert.Email = domain.ConfigAlertEmail{
+				Account: domain.ConfigAlertEmailAccount{Host: "smtp.example.com", CaFile: "/does/not/exist.pem"},
+				From:    "dvb@example.com",
+				To:      domain.StringList{"admin@example.com"},
+			}
+		},
+		"bad slack webhook":  func(c *domain.Config) { c.Alert.Slack.Webhooks = []string{"hooks.slack.com/services/T0"} },
+		"ntfy missing topic": func(c *domain.Config) { c.Alert.Ntfy.Url = "https://ntfy.sh" },
+		"ntfy bad priority": func(c *domain.Config) {
+			c.Alert.Ntfy = domain.ConfigAlertNtfy{Url: "https://ntfy.sh", Topic: "dvb", ErrorPriority: 9}
+		},
+		"ntfy negative priority": func(c *domain.Config) {
+			c.Alert.Ntfy = domain.ConfigAlertNtfy{Url: "https://ntfy.sh", Topic: "dvb", SuccessPriority: -1}
+		},
+		"gotify missing token": func(c *domain.Config) { c.Alert.Gotify.Url = "https://gotify.example.com" },
+		"telegram no chats":    func(c *domain.Config) { c.Alert.Telegram.Token = "123:abc" },
+		"matrix missing room": func(c *domain.Config) {
+			c.Alert.Matrix = domain.ConfigAlertMatrix{Homeserver: "https://matrix.example.com", AccessToken: "syt"}
+		},
+		"bad webhook template": func(c *domain.Config) {
+			c.Alert.Webhook = domain.ConfigAlertWebhook{Url: "https://example.com/hook", Body: "{{.Container"}
+		},
+		"api without token": func(c *domain.Config) { c.Daemon.Api.Listen = ":8080" },
+		"api bad listen":    func(c *domain.Config) { c.Daemon.Api = domain.ConfigDaemonApi{Listen: "8080", Token: "secret"} },
+		"bad log level":     func(c *domain.Config) { c.Log.Level = "loud" },
+		"bad log format":    func(c *domain.Config) { c.Log.Format = "xml" },
+		"bad mqtt broker":   func(c *domain.Config) { c.Mqtt.Broker = "broker.local:1883" },
+		"bad alert level":   func(c *domain.Config) { c.Alert.Email.MinLevel = "critical" },
+		"unknown route":     func(c *domain.Config) { c.Alert.Discord.Containers = domain.StringList{"not-a-container"} },
+		"api missing key": func(c *domain.Config) {
+			c.Daemon.Api = domain.ConfigDaemonApi{Listen: "127.0.0.1:8080", TlsCert: "dvb.crt"}
+		},
+	}
+
+	for name, change := range cases {
+		config := getValidConfig()
+		change(&config)
+
+		err := proc.ValidateConfig(config)
+		if err == nil {
+			t.Errorf("%v: expected the config to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jtom38/dvb/domain"
+)
+
+const (
+	StateFileName = "state.json"
+)
+
+// The state client keeps track of the last attempt and the last success of every job.
+type StateClient struct {
+	path string
+	mu   sync.Mutex
+}
+
+func NewStateClient(dir string) *StateClient {
+	return &StateClient{
+		path: filepath.Join(dir, StateFileName),
+	}
+}
+
+// Reads the state file, a missing file returns an empty state.
+func (c *StateClient) Load() (domain.RunState, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load()
+}
+
+// Returns the state of a single job.
+func (c *StateClient) Job(name string) (domain.JobState, error) {
+	state, err := c.Load()
+	if err != nil {
+		return domain.JobState{}, err
+	}
+	return state.Jobs[name], nil
+}
+
+// Records that the job has started.
+func (c *StateClient) RecordAttempt(name string, at time.Time) error {
+	return c.update(name, func(job *domain.JobState) {
+		job.LastAttempt = at
+	})
+}
+
+// Records how the job finished.
+func (c *StateClient) RecordResult(name string, at time.Time, result error) error {
+	return c.update(name, func(job *domain.JobState) {
+		if result != nil {
+			job.LastError = result.Error()
+			return
+		}
+		job.LastSuccess = at
+		job.LastError = ""
+	})
+}
+
+// Replaces the metric counters that are kept between runs.
+func (c *StateClient) RecordCounters(counters map[string]map[string]float64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	state.Counters = counters
+	return c.save(state)
+}
+
+func (c *StateClient) update(name string, change func(job *domain.JobState)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	state, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	job := state.Jobs[name]
+	change(&job)
+	state.Jobs[name] = job
+
+	return c.save(state)
+}
+
+func (c *StateClient) load() (domain.RunState, error) {
+	state := domain.RunState{Jobs: make(map[string]domain.JobState)}
+
+	content, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+
+	err = json.Unmarshal(content, &state)
+	if err != nil {
+		return state, err
+	}
+
+	if state.Jobs == nil {
+		state.Jobs = make(map[string]domain.JobState)
+	}
+	return state, nil
+}
+
+// Writes to a temp file first so a crash never leaves a broken state file.
+func (c *StateClient) save(state domain.RunState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	err = os.WriteFile(tmp, content, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, c.path)
+}
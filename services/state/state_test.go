@@ -0,0 +1,84 @@
+package state_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jtom38/dvb/services/state"
+)
+
+func TestStateRecord(t *testing.T) {
+	c := state.NewStateClient(t.TempDir())
+	now := time.Date(2022, 12, 1, 3, 0, 0, 0, time.UTC)
+
+	err := c.RecordAttempt("webdav", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.RecordResult("webdav", now.Add(time.Minute), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.RecordResult("webdav", now.Add(time.Hour), errors.New("docker is down"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := c.Job("webdav")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !job.LastAttempt.Equal(now) {
+		t.Errorf("unexpected last attempt %v", job.LastAttempt)
+	}
+
+	// A failure does not change the last success
+	if !job.LastSuccess.Equal(now.Add(time.Minute)) {
+		t.Errorf("unexpected last success %v", job.LastSuccess)
+	}
+
+	if job.LastError != "docker is down" {
+		t.Errorf("unexpected last error %v", job.LastError)
+	}
+}
+
+func TestStateMissingFile(t *testing.T) {
+	c := state.NewStateClient(t.TempDir())
+	s, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Jobs) != 0 {
+		t.Errorf("expected an empty state but got %v", s.Jobs)
+	}
+}
+
+func TestStateConcurrentJobs(t *testing.T) {
+	c := state.NewStateClient(t.TempDir())
+	names := []string{"a", "b", "c", "d", "e", "f"}
+
+	var wg sync.WaitGroup
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			c.RecordResult(name, time.Now(), nil)
+		}(name)
+	}
+	wg.Wait()
+
+	s, err := c.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Jobs) != len(names) {
+		t.Errorf("expected %v jobs but got %v", len(names), len(s.Jobs))
+	}
+}
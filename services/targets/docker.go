@@ -1,66 +1,152 @@
 package targets
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/jtom38/dvb/domain"
-	"github.com/jtom38/dvb/services/common"
 	"github.com/jtom38/dvb/services/cli"
+	"github.com/jtom38/dvb/services/common"
+	"github.com/jtom38/dvb/services/logger"
 )
 
 type DockerClient struct {
 	FileExtension string
+
+	retry   domain.ConfigRetry
+	onPhase func(phase string)
+	log     *logger.Logger
 }
 
 func NewDockerClient() *DockerClient {
 	c := DockerClient{
 		FileExtension: "tar",
+		log:           logger.Default(),
 	}
 	return &c
 }
 
+// Sets how the quiesce and archive phases are retried.
+func (c *DockerClient) SetRetry(config domain.ConfigRetry) {
+	c.retry = config
+}
+
+// Sets the logger used for the backup, every failed attempt is logged to it.
+func (c *DockerClient) SetLogger(log *logger.Logger) {
+	c.log = log
+}
+
+// Sets a func that is called every time the backup moves on to the next phase.
+func (c *DockerClient) SetPhaseFunc(onPhase func(phase string)) {
+	c.onPhase = onPhase
+}
+
+func (c DockerClient) phase(name string) {
+	if c.onPhase != nil {
+		c.onPhase(name)
+	}
+}
+
+// How long we wait for a container to come back online after a backup was cancelled.
+const restartTimeout = 2 * time.Minute
+
+const (
+	PhaseQuiesce = "quiesce"
+	PhaseArchive = "archive"
+	PhaseRestart = "restart"
+)
+
 // This will return the location of the new file on disk if it was successful
-func (c DockerClient) BackupDockerVolume(details domain.RunDetails, config domain.ContainerDocker) error {
-	client := cli.NewDockerCliClient()
+// If the context is cancelled the backup is stopped and the container is started again.
+func (c DockerClient) BackupDockerVolume(ctx context.Context, details domain.RunDetails, config domain.ContainerDocker) (attempts domain.PhaseAttempts, err error) {
+	client := cli.NewDockerCliClient().WithContext(ctx)
 
-	log.Printf("> Checking for %v", config.Name)
-	inspect, err := client.InspectContainer(config.Name)
+	c.log.Debug("Checking for the container")
+	_, err = client.InspectContainer(config.Name)
 	if err != nil {
-		return errors.New(inspect)
+		return attempts, err
 	}
 
-	log.Print("> Stopping container")
-	out, err := client.StopContainer(config.Name)
+	// Killing the docker cli does not stop the container running tar, it is removed by name
+	helper := fmt.Sprintf("dvb-%v-%v", config.Name, time.Now().UnixNano())
+
+	// Never leave the container offline, even if the backup failed or was cancelled
+	started := false
+	defer func() {
+		if started {
+			return
+		}
+
+		restartCtx, cancel := context.WithTimeout(context.Background(), restartTimeout)
+		defer cancel()
+		restartClient := cli.NewDockerCliClient().WithContext(restartCtx)
+
+		if ctx.Err() != nil {
+			c.log.Warn("Removing the archive container after the backup was cancelled", "container", helper)
+			out, rmErr := restartClient.RemoveContainer(helper)
+			if rmErr != nil && !strings.Contains(out, "No such container") {
+				c.log.Error("Failed to remove the archive container", "container", helper, logger.KeyError, rmErr)
+			}
+		}
+
+		c.log.Warn("Starting the container after the backup was interrupted")
+		_, startErr := restartClient.StartContainer(config.Name)
+		if startErr != nil {
+			err = fmt.Errorf("%v, the container failed to start again: %v", err, startErr)
+		}
+	}()
+
+	c.log.Info("Stopping the container")
+	c.phase(PhaseQuiesce)
+	attempts.Quiesce, err = common.Retry(ctx, c.retryParams(PhaseQuiesce, c.retry.Quiesce), func() error {
+		_, err := client.StopContainer(config.Name)
+		return err
+	})
 	if err != nil {
-		return errors.New(out)
+		return attempts, err
 	}
 
-	log.Printf("Backup will generate as '%v'", details.Backup.FileNameWithExtension)
-
 	// backup volume
-	log.Print("> Starting to backup the volume")
-	backedResults, err := client.BackupDockerVolume(cli.DockerBackupVolumeParams{
-		ContainerName:  config.Name,
-		BackupFolder:   details.Backup.LocalDirectory,
-		BackupFilename: details.Backup.FileName,
-		TargetFolder:   details.Backup.TargetDirectory,
+	c.log.Info("Starting to backup the volume", "file", details.Backup.FileNameWithExtension)
+	c.phase(PhaseArchive)
+	attempts.Archive, err = common.Retry(ctx, c.retryParams(PhaseArchive, c.retry.Archive), func() error {
+		_, err := client.BackupDockerVolume(cli.DockerBackupVolumeParams{
+			ContainerName:  config.Name,
+			HelperName:     helper,
+			BackupFolder:   details.Backup.LocalDirectory,
+			BackupFilename: details.Backup.FileName,
+			TargetFolder:   details.Backup.TargetDirectory,
+		})
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
 	})
 	if err != nil {
-		return errors.New(backedResults)
+		return attempts, err
 	}
 
 	// start container
-	log.Print("> Starting container")
-	out, err = client.StartContainer(config.Name)
+	c.log.Info("Starting the container")
+	c.phase(PhaseRestart)
+	_, err = client.StartContainer(config.Name)
 	if err != nil {
-		return errors.New(out)
+		return attempts, err
 	}
+	started = true
 
-	return nil
+	return attempts, nil
+}
+
+func (c DockerClient) retryParams(phase string, policy domain.ConfigRetryPolicy) common.RetryParams {
+	return common.RetryParams{
+		Name:   phase,
+		Policy: policy,
+		Logger: c.log,
+	}
 }
 
 //func (c DockerClient) GetDirectoryPath(value string) (string, error) {